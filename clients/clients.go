@@ -2,18 +2,27 @@ package clients
 
 import (
 	"context"
+	"crypto/tls"
+	"net/http"
 	"os"
+	"sync"
 
 	"github.com/urfave/cli"
 
+	"google.golang.org/grpc"
+
 	zapi "zvelo.io/go-zapi"
 	"zvelo.io/zapi/tokensourcer"
+	"zvelo.io/zapi/tracing"
 )
 
 type Clients interface {
 	Flags() []cli.Flag
+	AddScopes(...string)
 	RESTv1() zapi.RESTv1Client
 	GRPCv1(context.Context) (zapi.GRPCv1Client, error)
+	GraphQL() (GraphQLClient, error)
+	GraphQLv1() (GraphQLv1Client, error)
 }
 
 func New(tokenSourcer tokensourcer.TokenSourcer, debug, insecureSkipVerify *bool) Clients {
@@ -25,9 +34,12 @@ func New(tokenSourcer tokensourcer.TokenSourcer, debug, insecureSkipVerify *bool
 }
 
 type data struct {
-	// cached data
-	restV1 zapi.RESTv1Client
-	grpcV1 zapi.GRPCv1Client
+	// cached data, the clients are created the first time they are used,
+	// which may be from several goroutines at once
+	mu      sync.Mutex
+	restV1  zapi.RESTv1Client
+	grpcV1  zapi.GRPCv1Client
+	graphQL GraphQLClient
 
 	// passed to constructor
 	tokensourcer.TokenSourcer
@@ -90,10 +102,25 @@ func (d *data) zapiOpts() []zapi.Option {
 		zapiOpts = append(zapiOpts, zapi.WithoutHTTP2())
 	}
 
+	if tracing.Enabled() {
+		// zapi only configures tls and http/2 for an *http.Transport, so the
+		// transport being wrapped has to be configured here instead
+		zapiOpts = append(zapiOpts, zapi.WithTransport(tracing.Transport(&http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			ForceAttemptHTTP2: !d.noHTTP2,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: *d.insecureSkipVerify, // #nosec
+			},
+		})))
+	}
+
 	return zapiOpts
 }
 
 func (d *data) RESTv1() zapi.RESTv1Client {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.restV1 == nil {
 		d.restV1 = zapi.NewRESTv1(d.TokenSource(), d.zapiOpts()...)
 	}
@@ -102,6 +129,9 @@ func (d *data) RESTv1() zapi.RESTv1Client {
 }
 
 func (d *data) GRPCv1(ctx context.Context) (zapi.GRPCv1Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	if d.grpcV1 != nil {
 		return d.grpcV1, nil
 	}
@@ -109,6 +139,9 @@ func (d *data) GRPCv1(ctx context.Context) (zapi.GRPCv1Client, error) {
 	grpcDialer := zapi.NewGRPCv1(d.TokenSource(), d.zapiOpts()...)
 
 	var err error
-	d.grpcV1, err = grpcDialer.Dial(ctx)
+	d.grpcV1, err = grpcDialer.Dial(ctx,
+		grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(tracing.StreamClientInterceptor()),
+	)
 	return d.grpcV1, err
 }
@@ -0,0 +1,221 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+
+	"google.golang.org/grpc/metadata"
+
+	"zvelo.io/zapi/tracing"
+)
+
+// GraphQLRequest is the body of a request to the graphql endpoint
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLLocation is a location in a graphql document
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an error returned by the graphql endpoint
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	Path      []interface{}     `json:"path,omitempty"`
+}
+
+func (e GraphQLError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString(e.Message)
+
+	for _, l := range e.Locations {
+		fmt.Fprintf(&buf, " (line %d, column %d)", l.Line, l.Column)
+	}
+
+	if len(e.Path) > 0 {
+		parts := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			parts[i] = fmt.Sprint(p)
+		}
+		fmt.Fprintf(&buf, " at %s", strings.Join(parts, "."))
+	}
+
+	return buf.String()
+}
+
+// GraphQLResponse is the response received from the graphql endpoint
+type GraphQLResponse struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []GraphQLError  `json:"errors,omitempty"`
+}
+
+// Err returns the errors in the response, if any, as a single error
+func (r *GraphQLResponse) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		msgs[i] = e.Error()
+	}
+
+	return errors.Errorf("graphql error: %s", strings.Join(msgs, "; "))
+}
+
+// GraphQLClient makes requests to the graphql endpoint. Unlike
+// zapi.RESTv1Client.GraphQL it supports variables and operation names.
+type GraphQLClient interface {
+	Do(ctx context.Context, req *GraphQLRequest) (*GraphQLResponse, error)
+	URL() string
+}
+
+type graphQLClient struct {
+	url    string
+	client *http.Client
+}
+
+func (d *data) graphQLURL() (string, error) {
+	base := d.restBaseURL
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	if d.noTLS {
+		u.Scheme = "http"
+	}
+
+	u.Path = path.Join("/", u.Path, "graphql")
+
+	return u.String(), nil
+}
+
+func (d *data) GraphQL() (GraphQLClient, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.graphQL != nil {
+		return d.graphQL, nil
+	}
+
+	u, err := d.graphQLURL()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := tracing.Transport(&http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		ForceAttemptHTTP2: !d.noHTTP2,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: *d.insecureSkipVerify, // #nosec
+		},
+	})
+
+	if ts := d.TokenSource(); ts != nil {
+		transport = &oauth2.Transport{Source: ts, Base: transport}
+	}
+
+	if *d.debug {
+		transport = debugTransport{transport}
+	}
+
+	d.graphQL = &graphQLClient{
+		url:    u,
+		client: &http.Client{Transport: transport},
+	}
+
+	return d.graphQL, nil
+}
+
+func (c *graphQLClient) URL() string {
+	return c.url
+}
+
+func (c *graphQLClient) Do(ctx context.Context, in *GraphQLRequest) (*GraphQLResponse, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// forward outgoing metadata (e.g. tracing and cache headers) the same way
+	// that zapi.RESTv1Client does
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }() // #nosec
+
+	var out GraphQLResponse
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("http error: %s", resp.Status)
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK && len(out.Errors) == 0 {
+		return nil, errors.Errorf("http error: %s", resp.Status)
+	}
+
+	return &out, nil
+}
+
+type debugTransport struct {
+	http.RoundTripper
+}
+
+func (t debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		fmt.Fprintf(os.Stderr, "%s\n", dump) // #nosec
+	}
+
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		fmt.Fprintf(os.Stderr, "%s\n", dump) // #nosec
+	}
+
+	return resp, nil
+}
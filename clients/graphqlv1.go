@@ -0,0 +1,306 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// GraphQLResultQuery is the graphql document used to retrieve the result of a
+// query. It takes a single variable, requestID.
+const GraphQLResultQuery = `query Result($requestID: ID!) {
+  result(requestID: $requestID) {
+    requestID
+    responseDataset {
+      categorization { value error { code message } }
+      malicious { category error { code message } }
+      echo { url error { code message } }
+      language { code error { code message } }
+    }
+    queryStatus {
+      complete
+      error { code message }
+      fetchCode
+      location
+    }
+  }
+}`
+
+// GraphQLv1Client makes the same query and result requests as
+// zapi.RESTv1Client and zapi.GRPCv1Client, but uses the graphql endpoint
+type GraphQLv1Client interface {
+	Query(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error)
+	Result(ctx context.Context, reqID string) (*msg.QueryResult, error)
+}
+
+type graphQLv1Client struct {
+	client GraphQLClient
+}
+
+// NewGraphQLv1 returns a GraphQLv1Client that makes its requests with client
+func NewGraphQLv1(client GraphQLClient) GraphQLv1Client {
+	return graphQLv1Client{client: client}
+}
+
+func (d *data) GraphQLv1() (GraphQLv1Client, error) {
+	client, err := d.GraphQL()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewGraphQLv1(client), nil
+}
+
+type graphQLStatus struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *graphQLStatus) proto() *msg.Status {
+	if s == nil {
+		return nil
+	}
+
+	return &msg.Status{Code: s.Code, Message: s.Message}
+}
+
+type graphQLQueryReply struct {
+	RequestID string         `json:"requestID"`
+	Error     *graphQLStatus `json:"error"`
+}
+
+type graphQLHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type graphQLURLContent struct {
+	URL     string          `json:"url,omitempty"`
+	Header  []graphQLHeader `json:"header,omitempty"`
+	Content string          `json:"content"`
+}
+
+// Query makes a single graphql request containing an aliased queryUrl or
+// queryContent field for each url and content in the request
+func (c graphQLv1Client) Query(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+	datasets := make([]string, len(in.Dataset))
+	for i, dst := range in.Dataset {
+		datasets[i] = dst.String()
+	}
+
+	vars := map[string]interface{}{
+		"dataset": datasets,
+	}
+
+	if in.Callback != "" {
+		vars["callback"] = in.Callback
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("query Query($dataset: [DatasetType!]!, $callback: String")
+
+	for i := range in.Url {
+		fmt.Fprintf(&buf, ", $url%d: String!", i)
+	}
+
+	for i := range in.Content {
+		fmt.Fprintf(&buf, ", $content%d: URLContent!", i)
+	}
+
+	buf.WriteString(") {\n")
+
+	var aliases []string
+
+	for i, u := range in.Url {
+		alias := fmt.Sprintf("url%d", i)
+		aliases = append(aliases, alias)
+		vars[alias] = u
+		fmt.Fprintf(&buf, "  %s: queryUrl(url: $%s, callback: $callback, dataset: $dataset) { requestID error { code message } }\n", alias, alias)
+	}
+
+	for i, content := range in.Content {
+		alias := fmt.Sprintf("content%d", i)
+		aliases = append(aliases, alias)
+
+		uc := graphQLURLContent{
+			URL:     content.Url,
+			Content: content.Content,
+		}
+
+		// sort the headers so that requests are reproducible
+		names := make([]string, 0, len(content.Header))
+		for name := range content.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			uc.Header = append(uc.Header, graphQLHeader{Name: name, Value: content.Header[name]})
+		}
+
+		vars[alias] = uc
+		fmt.Fprintf(&buf, "  %s: queryContent(content: $%s, callback: $callback, dataset: $dataset) { requestID error { code message } }\n", alias, alias)
+	}
+
+	buf.WriteString("}")
+
+	resp, err := c.client.Do(ctx, &GraphQLRequest{
+		Query:         buf.String(),
+		OperationName: "Query",
+		Variables:     vars,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = resp.Err(); err != nil {
+		return nil, err
+	}
+
+	var data map[string]*graphQLQueryReply
+	if err = json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, errors.Wrap(err, "error parsing query replies")
+	}
+
+	replies := msg.QueryReplies{}
+
+	for _, alias := range aliases {
+		reply := data[alias]
+		if reply == nil {
+			return nil, errors.Errorf("missing reply for %s", alias)
+		}
+
+		replies.Reply = append(replies.Reply, &msg.QueryReply{
+			RequestId: reply.RequestID,
+			Error:     reply.Error.proto(),
+		})
+	}
+
+	return &replies, nil
+}
+
+type graphQLQueryResult struct {
+	Result *struct {
+		RequestID       string `json:"requestID"`
+		ResponseDataset *struct {
+			Categorization *struct {
+				Value []string       `json:"value"`
+				Error *graphQLStatus `json:"error"`
+			} `json:"categorization"`
+			Malicious *struct {
+				Category []string       `json:"category"`
+				Error    *graphQLStatus `json:"error"`
+			} `json:"malicious"`
+			Echo *struct {
+				URL   string         `json:"url"`
+				Error *graphQLStatus `json:"error"`
+			} `json:"echo"`
+			Language *struct {
+				Code  string         `json:"code"`
+				Error *graphQLStatus `json:"error"`
+			} `json:"language"`
+		} `json:"responseDataset"`
+		QueryStatus *struct {
+			Complete  bool           `json:"complete"`
+			Error     *graphQLStatus `json:"error"`
+			FetchCode int32          `json:"fetchCode"`
+			Location  string         `json:"location"`
+		} `json:"queryStatus"`
+	} `json:"result"`
+}
+
+func parseCategories(names []string) []msg.Category {
+	var cats []msg.Category
+
+	for _, name := range names {
+		cats = append(cats, msg.ParseCategory(name))
+	}
+
+	return cats
+}
+
+func (r *graphQLQueryResult) proto() *msg.QueryResult {
+	in := r.Result
+
+	result := msg.QueryResult{
+		RequestId: in.RequestID,
+	}
+
+	if s := in.QueryStatus; s != nil {
+		result.QueryStatus = &msg.QueryStatus{
+			Complete:  s.Complete,
+			Error:     s.Error.proto(),
+			FetchCode: s.FetchCode,
+			Location:  s.Location,
+		}
+	}
+
+	ds := in.ResponseDataset
+	if ds == nil {
+		return &result
+	}
+
+	result.ResponseDataset = &msg.Dataset{}
+
+	if c := ds.Categorization; c != nil {
+		result.ResponseDataset.Categorization = &msg.Dataset_Categorization{
+			Value: parseCategories(c.Value),
+			Error: c.Error.proto(),
+		}
+	}
+
+	if m := ds.Malicious; m != nil {
+		result.ResponseDataset.Malicious = &msg.Dataset_Malicious{
+			Category: parseCategories(m.Category),
+			Error:    m.Error.proto(),
+		}
+	}
+
+	if e := ds.Echo; e != nil {
+		result.ResponseDataset.Echo = &msg.Dataset_Echo{
+			Url:   e.URL,
+			Error: e.Error.proto(),
+		}
+	}
+
+	if l := ds.Language; l != nil {
+		result.ResponseDataset.Language = &msg.Dataset_Language{
+			Code:  l.Code,
+			Error: l.Error.proto(),
+		}
+	}
+
+	return &result
+}
+
+func (c graphQLv1Client) Result(ctx context.Context, reqID string) (*msg.QueryResult, error) {
+	resp, err := c.client.Do(ctx, &GraphQLRequest{
+		Query:         GraphQLResultQuery,
+		OperationName: "Result",
+		Variables:     map[string]interface{}{"requestID": reqID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = resp.Err(); err != nil {
+		return nil, err
+	}
+
+	var data graphQLQueryResult
+	if err = json.Unmarshal(resp.Data, &data); err != nil {
+		return nil, errors.Wrap(err, "error parsing result")
+	}
+
+	if data.Result == nil {
+		return nil, errors.Errorf("no result for %s", reqID)
+	}
+
+	return data.proto(), nil
+}
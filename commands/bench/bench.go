@@ -0,0 +1,537 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	zapi "zvelo.io/go-zapi"
+	"zvelo.io/msg/mock"
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/poller"
+	"zvelo.io/zapi/results"
+)
+
+// The operations that can be benchmarked
+const (
+	opQuery    = "query"
+	opResult   = "result"
+	opSuggest  = "suggest"
+	opComplete = "complete"
+)
+
+// maxPool is the maximum number of request ids kept for result operations
+const maxPool = 1000
+
+type cmd struct {
+	opts    *options.Options
+	clients clients.Clients
+	poller  poller.Poller
+
+	ops               cli.StringSlice
+	rate              float64
+	concurrency       int
+	duration          time.Duration
+	maxRequests       int64
+	urlFile           string
+	urlPattern        string
+	batchSize         int
+	stream            bool
+	suggestCategories cli.StringSlice
+	mockCompleteAfter time.Duration
+
+	urls       []string
+	next       int64
+	categories []msg.Category
+
+	mu   sync.Mutex
+	pool []string
+}
+
+func (c *cmd) Flags() []cli.Flag {
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	flags = append(flags, c.poller.Flags()...)
+	return append(flags,
+		cli.StringSliceFlag{
+			Name:  "op",
+			Usage: "operation to benchmark, query, result, suggest or complete (query and poll until the result is complete). operations are made in turn when repeated (default: query)",
+			Value: &c.ops,
+		},
+		cli.Float64Flag{
+			Name:        "rate",
+			Usage:       "target number of operations per second, 0 makes them as fast as the concurrency allows",
+			Destination: &c.rate,
+		},
+		cli.IntFlag{
+			Name:        "concurrency",
+			Usage:       "number of operations that may be in flight at once",
+			Value:       10,
+			Destination: &c.concurrency,
+		},
+		cli.DurationFlag{
+			Name:        "duration",
+			Usage:       "how long to run the benchmark",
+			Value:       10 * time.Second,
+			Destination: &c.duration,
+		},
+		cli.Int64Flag{
+			Name:        "requests",
+			Usage:       "stop after this many operations, 0 for no limit",
+			Destination: &c.maxRequests,
+		},
+		cli.StringFlag{
+			Name:        "url-file",
+			Usage:       "file with the urls to use, one per line, - reads from stdin. urls are used in turn",
+			Destination: &c.urlFile,
+		},
+		cli.StringFlag{
+			Name:        "url-pattern",
+			Usage:       "pattern of the urls to generate when --url-file isn't given, %d is replaced with a sequence number",
+			Value:       "http://example.com/zapi-bench/%d",
+			Destination: &c.urlPattern,
+		},
+		cli.IntFlag{
+			Name:        "batch-size",
+			Usage:       "number of urls in each query operation",
+			Value:       1,
+			Destination: &c.batchSize,
+		},
+		cli.BoolFlag{
+			Name:        "stream",
+			Usage:       "also receive results from the stream endpoint for the duration of the benchmark",
+			Destination: &c.stream,
+		},
+		cli.StringSliceFlag{
+			Name:  "suggest-category",
+			Usage: "category to suggest for each url in suggest operations (default: the category is left unchanged, may be repeated)",
+			Value: &c.suggestCategories,
+		},
+		cli.DurationFlag{
+			Name:        "mock-complete-after",
+			Usage:       "when benchmarking the mock server, results will not be marked complete until this much time has passed since the query",
+			Destination: &c.mockCompleteAfter,
+		},
+	)
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
+	c.poller = poller.New(opts, c.clients)
+
+	return cli.Command{
+		Name:   "bench",
+		Usage:  "load test zvelo api, or zapi mock, and report latency, errors and throughput",
+		Before: opts.Before(c.setup),
+		Action: c.action,
+		Flags:  c.Flags(),
+	}
+}
+
+// readURLs reads the non-empty lines of r that aren't comments
+func readURLs(r io.Reader) ([]string, error) {
+	var urls []string
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.Contains(line, "://") {
+			line = "http://" + line
+		}
+
+		urls = append(urls, line)
+	}
+
+	return urls, s.Err()
+}
+
+func (c *cmd) setup(_ *cli.Context) error {
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
+	if c.stream {
+		// the stream endpoint requires its own scope
+		c.clients.AddScopes("zvelo.stream")
+	}
+
+	if c.poller.Transport() == poller.TransportGraphQL {
+		return errors.New("bench does not support the graphql transport")
+	}
+
+	if len(c.ops) == 0 {
+		c.ops = []string{opQuery}
+	}
+
+	for _, op := range c.ops {
+		switch op {
+		case opQuery, opResult, opSuggest, opComplete:
+		default:
+			return errors.Errorf("invalid op: %s", op)
+		}
+	}
+
+	if c.concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+
+	if c.batchSize < 1 {
+		return errors.New("batch-size must be at least 1")
+	}
+
+	if c.rate < 0 {
+		return errors.New("rate can't be negative")
+	}
+
+	var err error
+	if c.categories, err = results.ParseCategories(c.suggestCategories); err != nil {
+		return err
+	}
+
+	if c.urlFile != "" {
+		r := io.Reader(os.Stdin)
+
+		if c.urlFile != "-" {
+			f, err := os.Open(c.urlFile) // #nosec
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }() // #nosec
+			r = f
+		}
+
+		urls, err := readURLs(r)
+		if err != nil {
+			return err
+		}
+
+		if len(urls) == 0 {
+			return errors.Errorf("no urls in %s", c.urlFile)
+		}
+
+		c.urls = urls
+	} else if !strings.Contains(c.urlPattern, "%d") {
+		return errors.New("url-pattern must contain %d")
+	}
+
+	return nil
+}
+
+// nextURLs returns the next n urls from the url file, or generated by the
+// url pattern
+func (c *cmd) nextURLs(n int) []string {
+	urls := make([]string, n)
+
+	for i := range urls {
+		seq := atomic.AddInt64(&c.next, 1) - 1
+
+		if len(c.urls) > 0 {
+			urls[i] = c.urls[seq%int64(len(c.urls))]
+		} else {
+			urls[i] = fmt.Sprintf(c.urlPattern, seq)
+		}
+	}
+
+	return urls
+}
+
+func (c *cmd) addToPool(replies *msg.QueryReplies) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, reply := range replies.Reply {
+		if reply.RequestId == "" {
+			continue
+		}
+
+		if len(c.pool) < maxPool {
+			c.pool = append(c.pool, reply.RequestId)
+		} else {
+			c.pool[rand.Intn(maxPool)] = reply.RequestId // #nosec
+		}
+	}
+}
+
+func (c *cmd) fromPool() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pool) == 0 {
+		return ""
+	}
+
+	return c.pool[rand.Intn(len(c.pool))] // #nosec
+}
+
+func (c *cmd) query(ctx context.Context, client client, n int) (*msg.QueryReplies, error) {
+	replies, err := client.Query(ctx, &msg.QueryRequests{
+		Url:     c.nextURLs(n),
+		Dataset: []msg.DatasetType{msg.CATEGORIZATION},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.addToPool(replies)
+
+	return replies, nil
+}
+
+// complete queries a url and polls for its result until it is complete
+func (c *cmd) complete(ctx context.Context, client client) error {
+	replies, err := c.query(ctx, client, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(replies.Reply) == 0 {
+		return errors.New("query returned no replies")
+	}
+
+	reqID := replies.Reply[0].RequestId
+
+	for {
+		result, err := client.Result(ctx, reqID)
+		if err != nil {
+			return err
+		}
+
+		if zvelo.IsComplete(result) {
+			return nil
+		}
+
+		select {
+		case <-time.After(c.poller.PollInterval()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *cmd) do(ctx context.Context, client client, op string) error {
+	switch op {
+	case opResult:
+		reqID := c.fromPool()
+		if reqID == "" {
+			return errors.New("no request ids to get results for")
+		}
+
+		_, err := client.Result(ctx, reqID)
+		return err
+	case opSuggest:
+		s := msg.Suggestion{Url: c.nextURLs(1)[0]}
+
+		if len(c.categories) > 0 {
+			s.Dataset = &msg.Dataset{
+				Categorization: &msg.Dataset_Categorization{Value: c.categories},
+			}
+		}
+
+		return client.Suggest(ctx, &s)
+	case opComplete:
+		return c.complete(ctx, client)
+	}
+
+	_, err := c.query(ctx, client, c.batchSize)
+	return err
+}
+
+// receive counts the results received from the stream endpoint until ctx is
+// done
+func (c *cmd) receive(ctx context.Context, client client, rec *recorder) {
+	for ctx.Err() == nil {
+		stream, err := client.Stream(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				rec.streamError(err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for {
+			if _, err = stream.Recv(); err != nil {
+				if err != io.EOF && ctx.Err() == nil {
+					rec.streamError(err)
+				}
+				break
+			}
+
+			rec.streamResult()
+		}
+	}
+}
+
+// run makes operations from concurrency goroutines until ctx is done or the
+// maximum number of requests have been made
+func (c *cmd) run(ctx context.Context, client client, rec *recorder) {
+	var tokens <-chan time.Time
+
+	if c.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / c.rate))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	var n int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-ctx.Done():
+						return
+					}
+				}
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				i := atomic.AddInt64(&n, 1)
+				if c.maxRequests > 0 && i > c.maxRequests {
+					return
+				}
+
+				op := c.ops[(i-1)%int64(len(c.ops))]
+
+				start := time.Now()
+				err := c.do(ctx, client, op)
+
+				if err != nil && ctx.Err() != nil {
+					// interrupted by the end of the benchmark
+					return
+				}
+
+				rec.record(op, time.Since(start), err)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (c *cmd) client(ctx context.Context) (client, error) {
+	if c.poller.Transport() == poller.TransportREST {
+		return restClient{client: c.clients.RESTv1()}, nil
+	}
+
+	client, err := c.clients.GRPCv1(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpcClient{client: client}, nil
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	var mockOpts []mock.ContextOption
+	if c.mockCompleteAfter > 0 {
+		mockOpts = append(mockOpts, mock.WithCompleteAfter(c.mockCompleteAfter))
+	}
+
+	ctx := mock.QueryContext(context.Background(), mockOpts...)
+	ctx, cancel := c.opts.WithTimeout(ctx)
+	defer cancel()
+
+	client, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range c.ops {
+		if op != opResult {
+			continue
+		}
+
+		// result operations need request ids to get results for
+		if _, err = c.query(ctx, client, c.batchSize); err != nil {
+			return errors.Wrap(err, "error querying for request ids")
+		}
+
+		break
+	}
+
+	rec := newRecorder()
+
+	runCtx, stop := context.WithTimeout(ctx, c.duration)
+	defer stop()
+
+	var streamDone chan struct{}
+
+	if c.stream {
+		streamDone = make(chan struct{})
+
+		go func() {
+			defer close(streamDone)
+			c.receive(runCtx, client, rec)
+		}()
+	}
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stderr)
+	printf("benchmarking %s for %s with concurrency %d\n", strings.Join(c.ops, ", "), c.duration, c.concurrency)
+
+	start := time.Now()
+	c.run(runCtx, client, rec)
+	elapsed := time.Since(start)
+
+	stop()
+
+	if streamDone != nil {
+		<-streamDone
+	}
+
+	rep := rec.report(elapsed)
+	rep.Transport = c.poller.Transport()
+	rep.TargetRate = c.rate
+	rep.Concurrency = c.concurrency
+
+	if c.stream {
+		rep.Stream = &streamReport{
+			Results: rec.streamResults,
+			Rate:    float64(rec.streamResults) / elapsed.Seconds(),
+			Errors:  rec.streamErrors,
+		}
+	}
+
+	if c.opts.JSON {
+		data, err := json.Marshal(rep)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "%s\n", data) // #nosec
+		return nil
+	}
+
+	rep.Print(os.Stdout)
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package bench
+
+import (
+	"context"
+
+	zapi "zvelo.io/go-zapi"
+	msg "zvelo.io/msg/msgpb"
+)
+
+// client makes the api calls being benchmarked using either transport
+type client interface {
+	Query(context.Context, *msg.QueryRequests) (*msg.QueryReplies, error)
+	Result(context.Context, string) (*msg.QueryResult, error)
+	Suggest(context.Context, *msg.Suggestion) error
+	Stream(context.Context) (streamClient, error)
+}
+
+type streamClient interface {
+	Recv() (*msg.QueryResult, error)
+}
+
+type grpcClient struct {
+	client zapi.GRPCv1Client
+}
+
+func (c grpcClient) Query(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+	return c.client.Query(ctx, in)
+}
+
+func (c grpcClient) Result(ctx context.Context, reqID string) (*msg.QueryResult, error) {
+	return c.client.Result(ctx, &msg.RequestID{RequestId: reqID})
+}
+
+func (c grpcClient) Suggest(ctx context.Context, in *msg.Suggestion) error {
+	_, err := c.client.Suggest(ctx, in)
+	return err
+}
+
+func (c grpcClient) Stream(ctx context.Context) (streamClient, error) {
+	return c.client.Stream(ctx, nil)
+}
+
+type restClient struct {
+	client zapi.RESTv1Client
+}
+
+func (c restClient) Query(ctx context.Context, in *msg.QueryRequests) (*msg.QueryReplies, error) {
+	return c.client.Query(ctx, in)
+}
+
+func (c restClient) Result(ctx context.Context, reqID string) (*msg.QueryResult, error) {
+	return c.client.Result(ctx, reqID)
+}
+
+func (c restClient) Suggest(ctx context.Context, in *msg.Suggestion) error {
+	return c.client.Suggest(ctx, in)
+}
+
+func (c restClient) Stream(ctx context.Context) (streamClient, error) {
+	return c.client.Stream(ctx)
+}
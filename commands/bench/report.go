@@ -0,0 +1,388 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var httpErrorRe = regexp.MustCompile(`^http error: (\d{3})`)
+
+// buckets are the upper bounds of the latency histogram buckets. The last
+// bucket is unbounded.
+var buckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// errorCode returns the grpc code of err or, for rest errors that aren't grpc
+// errors, the http status code
+func errorCode(err error) string {
+	err = errors.Cause(err)
+
+	switch err {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded.String()
+	case context.Canceled:
+		return codes.Canceled.String()
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return s.Code().String()
+	}
+
+	if m := httpErrorRe.FindStringSubmatch(err.Error()); m != nil {
+		return "HTTP " + m[1]
+	}
+
+	return codes.Unknown.String()
+}
+
+type opStats struct {
+	durations []time.Duration
+	errors    map[string]int
+}
+
+// recorder collects the latency and errors of each operation
+type recorder struct {
+	mu            sync.Mutex
+	ops           map[string]*opStats
+	streamResults int
+	streamErrors  map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		ops:          map[string]*opStats{},
+		streamErrors: map[string]int{},
+	}
+}
+
+func (r *recorder) record(op string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.ops[op]
+	if !ok {
+		s = &opStats{errors: map[string]int{}}
+		r.ops[op] = s
+	}
+
+	s.durations = append(s.durations, d)
+
+	if err != nil {
+		s.errors[errorCode(err)]++
+	}
+}
+
+func (r *recorder) streamResult() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.streamResults++
+}
+
+func (r *recorder) streamError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.streamErrors[errorCode(err)]++
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type latency struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+func (l latency) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{
+		"mean": ms(l.Mean),
+		"p50":  ms(l.P50),
+		"p90":  ms(l.P90),
+		"p99":  ms(l.P99),
+		"max":  ms(l.Max),
+	})
+}
+
+// percentile returns the nearest rank percentile p of sorted
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+type bucket struct {
+	LE    time.Duration
+	Count int
+}
+
+func (b bucket) MarshalJSON() ([]byte, error) {
+	var le interface{} = "+Inf"
+	if b.LE > 0 {
+		le = ms(b.LE)
+	}
+
+	return json.Marshal(struct {
+		LE    interface{} `json:"le_ms"`
+		Count int         `json:"count"`
+	}{le, b.Count})
+}
+
+func (b bucket) String() string {
+	if b.LE == 0 {
+		return fmt.Sprintf("> %s", buckets[len(buckets)-1])
+	}
+
+	return fmt.Sprintf("<= %s", b.LE)
+}
+
+type opReport struct {
+	Operation string         `json:"operation"`
+	Requests  int            `json:"requests"`
+	Errors    map[string]int `json:"errors,omitempty"`
+	ErrorRate float64        `json:"error_rate"`
+	QPS       float64        `json:"qps"`
+	Latency   latency        `json:"latency_ms"`
+	Histogram []bucket       `json:"histogram"`
+}
+
+func newOpReport(op string, s *opStats, elapsed time.Duration) opReport {
+	r := opReport{
+		Operation: op,
+		Requests:  len(s.durations),
+		Errors:    s.errors,
+	}
+
+	if r.Requests == 0 {
+		return r
+	}
+
+	var errs int
+	for _, n := range s.errors {
+		errs += n
+	}
+
+	r.ErrorRate = float64(errs) / float64(r.Requests)
+
+	if elapsed > 0 {
+		r.QPS = float64(r.Requests) / elapsed.Seconds()
+	}
+
+	sorted := append([]time.Duration{}, s.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	r.Latency = latency{
+		Mean: total / time.Duration(len(sorted)),
+		P50:  percentile(sorted, 50),
+		P90:  percentile(sorted, 90),
+		P99:  percentile(sorted, 99),
+		Max:  percentile(sorted, 100),
+	}
+
+	r.Histogram = make([]bucket, len(buckets)+1)
+	for i, le := range buckets {
+		r.Histogram[i].LE = le
+	}
+
+	for _, d := range sorted {
+		i := sort.Search(len(buckets), func(i int) bool { return d <= buckets[i] })
+		r.Histogram[i].Count++
+	}
+
+	return r
+}
+
+type streamReport struct {
+	Results int            `json:"results"`
+	Rate    float64        `json:"rate"`
+	Errors  map[string]int `json:"errors,omitempty"`
+}
+
+// report is the outcome of a benchmark run
+type report struct {
+	Transport   string        `json:"transport"`
+	Elapsed     time.Duration `json:"-"`
+	TargetRate  float64       `json:"target_rate,omitempty"`
+	Concurrency int           `json:"concurrency"`
+	Requests    int           `json:"requests"`
+	Errors      int           `json:"errors"`
+	QPS         float64       `json:"qps"`
+	Operations  []opReport    `json:"operations"`
+	Stream      *streamReport `json:"stream,omitempty"`
+}
+
+func (r report) MarshalJSON() ([]byte, error) {
+	type alias report
+
+	return json.Marshal(struct {
+		alias
+		ElapsedMS float64 `json:"elapsed_ms"`
+	}{alias(r), ms(r.Elapsed)})
+}
+
+func (r *recorder) report(elapsed time.Duration) report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := report{Elapsed: elapsed}
+
+	ops := make([]string, 0, len(r.ops))
+	for op := range r.ops {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	for _, op := range ops {
+		o := newOpReport(op, r.ops[op], elapsed)
+		rep.Operations = append(rep.Operations, o)
+		rep.Requests += o.Requests
+
+		for _, n := range o.Errors {
+			rep.Errors += n
+		}
+	}
+
+	if elapsed > 0 {
+		rep.QPS = float64(rep.Requests) / elapsed.Seconds()
+	}
+
+	return rep
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= 10*time.Millisecond {
+		return d.Round(time.Millisecond)
+	}
+
+	return d.Round(time.Microsecond)
+}
+
+func errorList(errs map[string]int) string {
+	var list []string
+	for code, n := range errs {
+		list = append(list, fmt.Sprintf("%s %d", code, n))
+	}
+	sort.Strings(list)
+
+	return strings.Join(list, ", ")
+}
+
+// Print writes a table of the results of each operation followed by their
+// latency histograms
+func (r report) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	target := "unlimited"
+	if r.TargetRate > 0 {
+		target = fmt.Sprintf("%.1f/s", r.TargetRate)
+	}
+
+	fmt.Fprintf(tw, "Transport:\t%s\n", r.Transport)                                               // #nosec
+	fmt.Fprintf(tw, "Duration:\t%s\n", round(r.Elapsed))                                           // #nosec
+	fmt.Fprintf(tw, "Concurrency:\t%d\n", r.Concurrency)                                           // #nosec
+	fmt.Fprintf(tw, "Target Rate:\t%s\n", target)                                                  // #nosec
+	fmt.Fprintf(tw, "Achieved QPS:\t%.1f (%d requests, %d errors)\n", r.QPS, r.Requests, r.Errors) // #nosec
+
+	if r.Stream != nil {
+		fmt.Fprintf(tw, "Stream Results:\t%d (%.1f/s)\n", r.Stream.Results, r.Stream.Rate) // #nosec
+		if len(r.Stream.Errors) > 0 {
+			fmt.Fprintf(tw, "Stream Errors:\t%s\n", errorList(r.Stream.Errors)) // #nosec
+		}
+	}
+
+	fmt.Fprintf(tw, "\nOPERATION\tREQUESTS\tERRORS\tQPS\tMEAN\tP50\tP90\tP99\tMAX\n") // #nosec
+
+	for _, o := range r.Operations {
+		fmt.Fprintf(tw, "%s\t%d\t%.2f%%\t%.1f\t%s\t%s\t%s\t%s\t%s\n", // #nosec
+			o.Operation, o.Requests, 100*o.ErrorRate, o.QPS,
+			round(o.Latency.Mean), round(o.Latency.P50), round(o.Latency.P90), round(o.Latency.P99), round(o.Latency.Max))
+	}
+
+	_ = tw.Flush() // #nosec
+
+	for _, o := range r.Operations {
+		if len(o.Errors) > 0 {
+			fmt.Fprintf(w, "\n%s errors: %s\n", o.Operation, errorList(o.Errors)) // #nosec
+		}
+
+		if o.Requests == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s latency:\n", o.Operation) // #nosec
+
+		max := 0
+		for _, b := range o.Histogram {
+			if b.Count > max {
+				max = b.Count
+			}
+		}
+
+		// only show the buckets from the first to the last that aren't empty
+		first, last := len(o.Histogram), -1
+		for i, b := range o.Histogram {
+			if b.Count == 0 {
+				continue
+			}
+
+			if i < first {
+				first = i
+			}
+			last = i
+		}
+
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, b := range o.Histogram[first : last+1] {
+			bar := ""
+			if max > 0 {
+				bar = strings.Repeat("#", (b.Count*40+max-1)/max)
+			}
+
+			fmt.Fprintf(tw, "  %s\t%d\t %s\n", b, b.Count, bar) // #nosec
+		}
+		_ = tw.Flush() // #nosec
+	}
+}
@@ -0,0 +1,139 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{status.Error(codes.Unavailable, "unavailable"), "Unavailable"},
+		{errors.Wrap(status.Error(codes.NotFound, "not found"), "error"), "NotFound"},
+		{errors.New("http error: 503 Service Unavailable"), "HTTP 503"},
+		{errors.Wrap(context.DeadlineExceeded, "error"), "DeadlineExceeded"},
+		{context.Canceled, "Canceled"},
+		{errors.New("connection refused"), "Unknown"},
+	}
+
+	for _, tt := range tests {
+		if code := errorCode(tt.err); code != tt.code {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.code, code)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	rec := newRecorder()
+
+	for i := 1; i <= 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = status.Error(codes.Unavailable, "unavailable")
+		}
+
+		rec.record(opQuery, time.Duration(i)*time.Millisecond, err)
+	}
+
+	rec.record(opSuggest, 20*time.Second, errors.New("http error: 503 Service Unavailable"))
+
+	rep := rec.report(10 * time.Second)
+
+	if rep.Requests != 101 || rep.Errors != 11 || rep.QPS != 10.1 {
+		t.Errorf("unexpected report: %+v", rep)
+	}
+
+	if len(rep.Operations) != 2 || rep.Operations[0].Operation != opQuery || rep.Operations[1].Operation != opSuggest {
+		t.Fatalf("unexpected operations: %+v", rep.Operations)
+	}
+
+	q := rep.Operations[0]
+
+	if q.ErrorRate != 0.1 || q.Errors["Unavailable"] != 10 {
+		t.Errorf("unexpected errors: %v, %v", q.ErrorRate, q.Errors)
+	}
+
+	l := q.Latency
+	if l.P50 != 50*time.Millisecond || l.P90 != 90*time.Millisecond || l.P99 != 99*time.Millisecond || l.Max != 100*time.Millisecond {
+		t.Errorf("unexpected latency: %+v", l)
+	}
+
+	// 1, 2, 3-5, 6-10, 11-25, 26-50 and 51-100ms
+	expected := []int{1, 1, 3, 5, 15, 25, 50, 0, 0, 0, 0, 0, 0, 0}
+	for i, b := range q.Histogram {
+		if b.Count != expected[i] {
+			t.Errorf("bucket %s: expected %d, got %d", b, expected[i], b.Count)
+		}
+	}
+
+	if s := rep.Operations[1]; s.Histogram[len(buckets)].Count != 1 || s.Errors["HTTP 503"] != 1 {
+		t.Errorf("unexpected suggest report: %+v", s)
+	}
+
+	data, err := json.Marshal(rep)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded struct {
+		ElapsedMS  float64 `json:"elapsed_ms"`
+		Operations []struct {
+			Latency   map[string]float64       `json:"latency_ms"`
+			Histogram []map[string]interface{} `json:"histogram"`
+		} `json:"operations"`
+	}
+
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.ElapsedMS != 10000 || decoded.Operations[0].Latency["p90"] != 90 {
+		t.Errorf("unexpected json: %s", data)
+	}
+
+	if h := decoded.Operations[0].Histogram; h[0]["le_ms"] != float64(1) || h[len(h)-1]["le_ms"] != "+Inf" {
+		t.Errorf("unexpected histogram: %v", h)
+	}
+
+	var buf bytes.Buffer
+	rep.Print(&buf)
+
+	for _, s := range []string{"Achieved QPS:", "query errors: Unavailable 10", "suggest errors: HTTP 503 1", "> 10s"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("output is missing %q:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestURLs(t *testing.T) {
+	urls, err := readURLs(strings.NewReader("# comment\nexample.com\n\n  https://example.org/a  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(urls) != 2 || urls[0] != "http://example.com" || urls[1] != "https://example.org/a" {
+		t.Fatalf("unexpected urls: %v", urls)
+	}
+
+	c := cmd{urls: urls}
+	if next := c.nextURLs(3); next[0] != urls[0] || next[1] != urls[1] || next[2] != urls[0] {
+		t.Errorf("unexpected urls: %v", next)
+	}
+
+	c = cmd{urlPattern: "http://example.com/%d"}
+	c.nextURLs(1)
+	if next := c.nextURLs(1); next[0] != "http://example.com/1" {
+		t.Errorf("unexpected urls: %v", next)
+	}
+}
@@ -0,0 +1,339 @@
+package diff
+
+import (
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/results"
+)
+
+// The output formats
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+)
+
+// The status of a url in the new results compared to the old ones
+const (
+	statusAdded     = "added"
+	statusRemoved   = "removed"
+	statusChanged   = "changed"
+	statusUnchanged = "unchanged"
+)
+
+type cmd struct {
+	opts   *options.Options
+	format string
+	all    bool
+	matrix bool
+	old    string
+	new    string
+}
+
+func (c *cmd) Flags() []cli.Flag {
+	return append(c.opts.Flags(options.FlagJSON),
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "output format, text, json or csv (default: text, or json if --json is given)",
+			Destination: &c.format,
+		},
+		cli.BoolFlag{
+			Name:        "all",
+			Usage:       "list every url, not just those that changed",
+			Destination: &c.all,
+		},
+		cli.BoolFlag{
+			Name:        "matrix",
+			Usage:       "with csv, write the confusion matrix of each category instead of the changes to each url",
+			Destination: &c.matrix,
+		},
+	)
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+
+	return cli.Command{
+		Name:      "diff",
+		Usage:     "compare two sets of results saved with --json and report what changed for each url",
+		ArgsUsage: "OLD.jsonl NEW.jsonl",
+		Before:    opts.Before(c.setup),
+		Action:    c.action,
+		Flags:     c.Flags(),
+	}
+}
+
+func (c *cmd) setup(cli *cli.Context) error {
+	if cli.NArg() != 2 {
+		return errors.New("the old and new result files are required")
+	}
+
+	c.old, c.new = cli.Args().Get(0), cli.Args().Get(1)
+
+	if c.old == "-" && c.new == "-" {
+		return errors.New("only one of the result files can be read from stdin")
+	}
+
+	if c.format == "" {
+		c.format = formatText
+
+		if c.opts.JSON {
+			c.format = formatJSON
+		}
+	}
+
+	switch c.format {
+	case formatText, formatJSON, formatCSV:
+	default:
+		return errors.Errorf("invalid format: %s", c.format)
+	}
+
+	if c.matrix && c.format != formatCSV {
+		return errors.New("matrix can only be used with the csv format")
+	}
+
+	return nil
+}
+
+func readResults(name string) (map[string]*msg.QueryResult, error) {
+	saved, err := results.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return results.Latest(saved), nil
+}
+
+// urlDiff is the difference between the old and new results of a url
+type urlDiff struct {
+	URL         string
+	Status      string
+	ErrorBefore string
+	ErrorAfter  string
+	results.Change
+}
+
+// compare returns the differences between the old and new results of a url.
+// The datasets aren't compared if either of the results have an error.
+func compare(url string, before, after *msg.QueryResult) urlDiff {
+	d := urlDiff{URL: url}
+
+	switch {
+	case before == nil:
+		d.Status = statusAdded
+		return d
+	case after == nil:
+		d.Status = statusRemoved
+		return d
+	}
+
+	d.ErrorBefore, d.ErrorAfter = results.ErrorCode(before), results.ErrorCode(after)
+
+	if d.ErrorBefore == "" && d.ErrorAfter == "" {
+		d.Change = results.Compare(before.ResponseDataset, after.ResponseDataset)
+	}
+
+	d.Status = statusUnchanged
+	if d.ErrorChanged() || d.Changed() || d.LanguageChanged() {
+		d.Status = statusChanged
+	}
+
+	return d
+}
+
+// ErrorChanged returns true if the result has a different error, or if an
+// error started or stopped occurring
+func (d urlDiff) ErrorChanged() bool {
+	return d.ErrorBefore != d.ErrorAfter
+}
+
+// categoryMatrix is the confusion matrix of a category, how many urls had it
+// in the old and new results
+type categoryMatrix struct {
+	Category msg.Category
+	Both     int
+	Added    int
+	Removed  int
+	Neither  int
+}
+
+// summary is the aggregate of the differences of every url
+type summary struct {
+	Old             int
+	New             int
+	Compared        int
+	Added           int
+	Removed         int
+	Changed         int
+	CategoryChanges int
+	VerdictChanges  int
+	LanguageChanges int
+	ErrorChanges    int
+	Verdicts        map[string]int
+	Categories      []categoryMatrix
+}
+
+// diffResults compares the old and new results of every url. The returned
+// diffs are sorted by url.
+func diffResults(before, after map[string]*msg.QueryResult) ([]urlDiff, summary) {
+	s := summary{
+		Old:      len(before),
+		New:      len(after),
+		Verdicts: map[string]int{},
+	}
+
+	urls := make([]string, 0, len(before)+len(after))
+
+	for u := range before {
+		urls = append(urls, u)
+	}
+
+	for u := range after {
+		if _, ok := before[u]; !ok {
+			urls = append(urls, u)
+		}
+	}
+
+	sort.Strings(urls)
+
+	// the categories of the urls with known categories in both results
+	type pair struct{ before, after []msg.Category }
+	var pairs []pair
+	seen := map[msg.Category]bool{}
+
+	diffs := make([]urlDiff, len(urls))
+
+	for i, u := range urls {
+		d := compare(u, before[u], after[u])
+		diffs[i] = d
+
+		switch d.Status {
+		case statusAdded:
+			s.Added++
+			continue
+		case statusRemoved:
+			s.Removed++
+			continue
+		case statusChanged:
+			s.Changed++
+		}
+
+		s.Compared++
+
+		if len(d.CategoriesAdded) > 0 || len(d.CategoriesRemoved) > 0 {
+			s.CategoryChanges++
+		}
+
+		if d.VerdictChanged() {
+			s.VerdictChanges++
+		}
+
+		if d.VerdictBefore != "" && d.VerdictAfter != "" {
+			s.Verdicts[d.VerdictBefore+" -> "+d.VerdictAfter]++
+		}
+
+		if d.LanguageChanged() {
+			s.LanguageChanges++
+		}
+
+		if d.ErrorChanged() {
+			s.ErrorChanges++
+		}
+
+		if d.ErrorBefore != "" || d.ErrorAfter != "" {
+			continue
+		}
+
+		b, ok := results.Categories(before[u].ResponseDataset)
+		a, aok := results.Categories(after[u].ResponseDataset)
+		if !ok || !aok {
+			continue
+		}
+
+		p := pair{b, a}
+		pairs = append(pairs, p)
+
+		for _, cat := range append(p.before, p.after...) {
+			seen[cat] = true
+		}
+	}
+
+	for cat := range seen {
+		m := categoryMatrix{Category: cat}
+
+		for _, p := range pairs {
+			o, n := results.Contains(p.before, cat), results.Contains(p.after, cat)
+
+			switch {
+			case o && n:
+				m.Both++
+			case n:
+				m.Added++
+			case o:
+				m.Removed++
+			default:
+				m.Neither++
+			}
+		}
+
+		s.Categories = append(s.Categories, m)
+	}
+
+	// the categories with the most changes first
+	sort.Slice(s.Categories, func(i, j int) bool {
+		a, b := s.Categories[i], s.Categories[j]
+
+		if ca, cb := a.Added+a.Removed, b.Added+b.Removed; ca != cb {
+			return ca > cb
+		}
+
+		return a.Category.String() < b.Category.String()
+	})
+
+	return diffs, s
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	before, err := readResults(c.old)
+	if err != nil {
+		return err
+	}
+
+	after, err := readResults(c.new)
+	if err != nil {
+		return err
+	}
+
+	diffs, s := diffResults(before, after)
+
+	if !c.all {
+		var changed []urlDiff
+		for _, d := range diffs {
+			if d.Status != statusUnchanged {
+				changed = append(changed, d)
+			}
+		}
+		diffs = changed
+	}
+
+	switch c.format {
+	case formatJSON:
+		return writeJSON(os.Stdout, diffs, s)
+	case formatCSV:
+		if c.matrix {
+			return writeMatrixCSV(os.Stdout, s)
+		}
+
+		return writeCSV(os.Stdout, diffs)
+	}
+
+	writeText(os.Stdout, diffs, s)
+
+	return nil
+}
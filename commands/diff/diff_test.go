@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/results"
+)
+
+// the results of each url before and after, as saved by query --json
+const (
+	savedBefore = `{"url":"a","result":{"response_dataset":{"categorization":{"value":["NEWS_4","SPORTS_4"]},"malicious":{},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"b","result":{"response_dataset":{"categorization":{"value":["NEWS_4"]},"malicious":{},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"c","result":{"response_dataset":{"categorization":{"value":["NEWS_4"]},"malicious":{},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"d","result":{"response_dataset":{"categorization":{},"malicious":{},"language":{}},"query_status":{"complete":true,"error":{"code":5}}}}
+{"url":"e","result":{"response_dataset":{"categorization":{},"malicious":{},"language":{}},"query_status":{"complete":true}}}
+`
+	savedAfter = `{"url":"a","result":{"response_dataset":{"categorization":{"value":["NEWS_4","BLOG_4"]},"malicious":{"category":["MAL_4"]},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"b","result":{"response_dataset":{"categorization":{"value":["NEWS_4"]},"malicious":{},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"c","result":{"response_dataset":{"categorization":{"value":["NEWS_4"]},"malicious":{},"language":{"code":"fr"}},"query_status":{"complete":true}}}
+{"url":"d","result":{"response_dataset":{"categorization":{"value":["BLOG_4"]},"malicious":{},"language":{"code":"en"}},"query_status":{"complete":true}}}
+{"url":"f","result":{"response_dataset":{"categorization":{},"malicious":{},"language":{}},"query_status":{"complete":true}}}
+`
+)
+
+func TestDiffResults(t *testing.T) {
+	before, err := results.Read(strings.NewReader(savedBefore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := results.Read(strings.NewReader(savedAfter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, s := diffResults(results.Latest(before), results.Latest(after))
+
+	if len(diffs) != 6 {
+		t.Fatalf("unexpected diffs: %v", diffs)
+	}
+
+	statuses := map[string]string{
+		"a": statusChanged,
+		"b": statusUnchanged,
+		"c": statusChanged,
+		"d": statusChanged,
+		"e": statusRemoved,
+		"f": statusAdded,
+	}
+
+	for _, d := range diffs {
+		if d.Status != statuses[d.URL] {
+			t.Errorf("%s: expected %s, got %s", d.URL, statuses[d.URL], d.Status)
+		}
+	}
+
+	if a := diffs[0]; a.String() != "a: +BLOG_4 -SPORTS_4, CLEAN -> MALICIOUS" {
+		t.Errorf("unexpected diff: %s", a)
+	}
+
+	if c := diffs[2]; c.String() != "c: language en -> fr" {
+		t.Errorf("unexpected diff: %s", c)
+	}
+
+	// the datasets aren't compared when there is an error
+	if d := diffs[3]; d.String() != "d: error NotFound -> OK" {
+		t.Errorf("unexpected diff: %s", d)
+	}
+
+	if s.Compared != 4 || s.Changed != 3 || s.Added != 1 || s.Removed != 1 || s.CategoryChanges != 1 ||
+		s.VerdictChanges != 1 || s.LanguageChanges != 1 || s.ErrorChanges != 1 || s.Verdicts["CLEAN -> CLEAN"] != 2 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	expected := []categoryMatrix{
+		{Category: msg.BLOG_4, Added: 1, Neither: 2},
+		{Category: msg.SPORTS_4, Removed: 1, Neither: 2},
+		{Category: msg.NEWS_4, Both: 3},
+	}
+
+	if len(s.Categories) != len(expected) {
+		t.Fatalf("unexpected categories: %+v", s.Categories)
+	}
+
+	for i, m := range s.Categories {
+		if m != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], m)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeMatrixCSV(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(buf.String(), "\n"); len(lines) != 5 || lines[1] != "BLOG_4,0,1,0,2" {
+		t.Errorf("unexpected csv: %s", buf.String())
+	}
+}
@@ -0,0 +1,228 @@
+package diff
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"zvelo.io/zapi/results"
+)
+
+func (d urlDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		URL               string   `json:"url"`
+		Status            string   `json:"status"`
+		CategoriesAdded   []string `json:"categories_added,omitempty"`
+		CategoriesRemoved []string `json:"categories_removed,omitempty"`
+		VerdictBefore     string   `json:"verdict_before,omitempty"`
+		VerdictAfter      string   `json:"verdict_after,omitempty"`
+		LanguageBefore    string   `json:"language_before,omitempty"`
+		LanguageAfter     string   `json:"language_after,omitempty"`
+		ErrorBefore       string   `json:"error_before,omitempty"`
+		ErrorAfter        string   `json:"error_after,omitempty"`
+	}{
+		URL:               d.URL,
+		Status:            d.Status,
+		CategoriesAdded:   results.CategoryStrings(d.CategoriesAdded),
+		CategoriesRemoved: results.CategoryStrings(d.CategoriesRemoved),
+		VerdictBefore:     d.VerdictBefore,
+		VerdictAfter:      d.VerdictAfter,
+		LanguageBefore:    d.LanguageBefore,
+		LanguageAfter:     d.LanguageAfter,
+		ErrorBefore:       d.ErrorBefore,
+		ErrorAfter:        d.ErrorAfter,
+	})
+}
+
+func (m categoryMatrix) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Category string `json:"category"`
+		Both     int    `json:"both"`
+		Added    int    `json:"added"`
+		Removed  int    `json:"removed"`
+		Neither  int    `json:"neither"`
+	}{m.Category.String(), m.Both, m.Added, m.Removed, m.Neither})
+}
+
+func (s summary) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Old             int              `json:"old"`
+		New             int              `json:"new"`
+		Compared        int              `json:"compared"`
+		Added           int              `json:"added"`
+		Removed         int              `json:"removed"`
+		Changed         int              `json:"changed"`
+		CategoryChanges int              `json:"category_changes"`
+		VerdictChanges  int              `json:"verdict_changes"`
+		LanguageChanges int              `json:"language_changes"`
+		ErrorChanges    int              `json:"error_changes"`
+		Verdicts        map[string]int   `json:"verdicts,omitempty"`
+		Categories      []categoryMatrix `json:"categories,omitempty"`
+	}{
+		s.Old, s.New, s.Compared, s.Added, s.Removed, s.Changed, s.CategoryChanges,
+		s.VerdictChanges, s.LanguageChanges, s.ErrorChanges, s.Verdicts, s.Categories,
+	})
+}
+
+func writeJSON(w io.Writer, diffs []urlDiff, s summary) error {
+	if diffs == nil {
+		diffs = []urlDiff{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return enc.Encode(struct {
+		URLs    []urlDiff `json:"urls"`
+		Summary summary   `json:"summary"`
+	}{diffs, s})
+}
+
+func writeCSV(w io.Writer, diffs []urlDiff) error {
+	cw := csv.NewWriter(w)
+
+	// #nosec
+	_ = cw.Write([]string{
+		"url", "status", "categories_added", "categories_removed",
+		"verdict_before", "verdict_after", "language_before", "language_after",
+		"error_before", "error_after",
+	})
+
+	for _, d := range diffs {
+		// #nosec
+		_ = cw.Write([]string{
+			d.URL,
+			d.Status,
+			strings.Join(results.CategoryStrings(d.CategoriesAdded), " "),
+			strings.Join(results.CategoryStrings(d.CategoriesRemoved), " "),
+			d.VerdictBefore,
+			d.VerdictAfter,
+			d.LanguageBefore,
+			d.LanguageAfter,
+			d.ErrorBefore,
+			d.ErrorAfter,
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeMatrixCSV(w io.Writer, s summary) error {
+	cw := csv.NewWriter(w)
+
+	_ = cw.Write([]string{"category", "both", "added", "removed", "neither"}) // #nosec
+
+	for _, m := range s.Categories {
+		// #nosec
+		_ = cw.Write([]string{
+			m.Category.String(),
+			strconv.Itoa(m.Both),
+			strconv.Itoa(m.Added),
+			strconv.Itoa(m.Removed),
+			strconv.Itoa(m.Neither),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func errorString(code string) string {
+	if code == "" {
+		return "OK"
+	}
+
+	return code
+}
+
+func (d urlDiff) String() string {
+	switch d.Status {
+	case statusAdded:
+		return d.URL + ": only in new results"
+	case statusRemoved:
+		return d.URL + ": only in old results"
+	case statusUnchanged:
+		return d.URL + ": unchanged"
+	}
+
+	var changes []string
+
+	if d.ErrorChanged() {
+		changes = append(changes, fmt.Sprintf("error %s -> %s", errorString(d.ErrorBefore), errorString(d.ErrorAfter)))
+	}
+
+	var cats []string
+
+	for _, cat := range d.CategoriesAdded {
+		cats = append(cats, "+"+cat.String())
+	}
+
+	for _, cat := range d.CategoriesRemoved {
+		cats = append(cats, "-"+cat.String())
+	}
+
+	if len(cats) > 0 {
+		changes = append(changes, strings.Join(cats, " "))
+	}
+
+	if d.VerdictChanged() {
+		changes = append(changes, fmt.Sprintf("%s -> %s", d.VerdictBefore, d.VerdictAfter))
+	}
+
+	if d.LanguageChanged() {
+		changes = append(changes, fmt.Sprintf("language %s -> %s", d.LanguageBefore, d.LanguageAfter))
+	}
+
+	return d.URL + ": " + strings.Join(changes, ", ")
+}
+
+// writeText writes the changes to each url followed by the summary
+func writeText(w io.Writer, diffs []urlDiff, s summary) {
+	for _, d := range diffs {
+		fmt.Fprintln(w, d) // #nosec
+	}
+
+	if len(diffs) > 0 {
+		fmt.Fprintln(w) // #nosec
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Old Results:\t%d\n", s.Old)                           // #nosec
+	fmt.Fprintf(tw, "New Results:\t%d\n", s.New)                           // #nosec
+	fmt.Fprintf(tw, "Compared:\t%d (%d changed)\n", s.Compared, s.Changed) // #nosec
+	fmt.Fprintf(tw, "Only in Old:\t%d\n", s.Removed)                       // #nosec
+	fmt.Fprintf(tw, "Only in New:\t%d\n", s.Added)                         // #nosec
+	fmt.Fprintf(tw, "Category Changes:\t%d\n", s.CategoryChanges)          // #nosec
+	fmt.Fprintf(tw, "Verdict Changes:\t%d\n", s.VerdictChanges)            // #nosec
+	fmt.Fprintf(tw, "Language Changes:\t%d\n", s.LanguageChanges)          // #nosec
+	fmt.Fprintf(tw, "Error Changes:\t%d\n", s.ErrorChanges)                // #nosec
+
+	if len(s.Verdicts) > 0 {
+		verdicts := make([]string, 0, len(s.Verdicts))
+		for v := range s.Verdicts {
+			verdicts = append(verdicts, v)
+		}
+		sort.Strings(verdicts)
+
+		fmt.Fprintf(tw, "\nVERDICT\tURLS\n") // #nosec
+		for _, v := range verdicts {
+			fmt.Fprintf(tw, "%s\t%d\n", v, s.Verdicts[v]) // #nosec
+		}
+	}
+
+	if len(s.Categories) > 0 {
+		fmt.Fprintf(tw, "\nCATEGORY\tBOTH\tADDED\tREMOVED\tNEITHER\n") // #nosec
+		for _, m := range s.Categories {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", m.Category, m.Both, m.Added, m.Removed, m.Neither) // #nosec
+		}
+	}
+
+	_ = tw.Flush() // #nosec
+}
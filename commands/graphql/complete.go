@@ -0,0 +1,407 @@
+package graphql
+
+import (
+	"sort"
+	"strings"
+)
+
+type token struct {
+	kind rune // 'a' for names, '"' for strings, '0' for numbers, '.' for "...", otherwise the punctuator
+	text string
+}
+
+func isNameStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isName(b byte) bool {
+	return isNameStart(b) || (b >= '0' && b <= '9')
+}
+
+// lex splits a graphql document into tokens, skipping whitespace, commas and
+// comments. open is true if the document ends inside of a string or comment.
+func lex(doc string) (tokens []token, open bool) {
+	for i := 0; i < len(doc); {
+		switch b := doc[i]; {
+		case b == ' ', b == '\t', b == '\n', b == '\r', b == ',':
+			i++
+		case b == '#':
+			end := strings.IndexByte(doc[i:], '\n')
+			if end == -1 {
+				return tokens, true
+			}
+			i += end + 1
+		case strings.HasPrefix(doc[i:], `"""`):
+			end := strings.Index(doc[i+3:], `"""`)
+			if end == -1 {
+				return tokens, true
+			}
+			tokens = append(tokens, token{'"', doc[i : i+end+6]})
+			i += end + 6
+		case b == '"':
+			j := i + 1
+			for ; j < len(doc) && doc[j] != '"' && doc[j] != '\n'; j++ {
+				if doc[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(doc) || doc[j] != '"' {
+				return tokens, true
+			}
+			tokens = append(tokens, token{'"', doc[i : j+1]})
+			i = j + 1
+		case strings.HasPrefix(doc[i:], "..."):
+			tokens = append(tokens, token{'.', "..."})
+			i += 3
+		case isNameStart(b):
+			j := i + 1
+			for j < len(doc) && isName(doc[j]) {
+				j++
+			}
+			tokens = append(tokens, token{'a', doc[i:j]})
+			i = j
+		case b == '-', b >= '0' && b <= '9':
+			j := i + 1
+			for j < len(doc) && (isName(doc[j]) || doc[j] == '.' || doc[j] == '+' || doc[j] == '-') {
+				j++
+			}
+			tokens = append(tokens, token{'0', doc[i:j]})
+			i = j
+		default:
+			tokens = append(tokens, token{rune(b), string(b)})
+			i++
+		}
+	}
+
+	return tokens, false
+}
+
+// balanced reports whether doc contains at least one selection set and all of
+// its braces and parentheses are closed, meaning that it is ready to be sent
+func balanced(doc string) bool {
+	tokens, open := lex(doc)
+	if open {
+		return false
+	}
+
+	var depth int
+	var selection bool
+
+	for _, t := range tokens {
+		switch t.kind {
+		case '{':
+			selection = true
+			depth++
+		case '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		}
+	}
+
+	return selection && depth <= 0
+}
+
+type frameKind int
+
+const (
+	selectionFrame frameKind = iota
+	argumentsFrame
+	inputFrame
+	variablesFrame
+)
+
+type frame struct {
+	kind     frameKind
+	typeName string // the type whose fields, arguments or input fields apply
+	field    string // for argumentsFrame, the field the arguments are for
+	name     string // the last field or argument name seen
+	value    bool   // true after a ':' while the value is being given
+	list     int    // depth of list values
+	on       bool   // true after the "on" of a type condition
+	typeCond string // the type condition for the next selection set
+}
+
+// completer offers completions for a graphql document using an introspected
+// schema
+type completer struct {
+	schema *introspectionSchema
+	types  map[string]*fullType
+}
+
+func newCompleter(s *introspectionSchema) *completer {
+	c := completer{
+		schema: s,
+		types:  map[string]*fullType{},
+	}
+
+	for i := range s.Types {
+		c.types[s.Types[i].Name] = &s.Types[i]
+	}
+
+	return &c
+}
+
+func (c *completer) field(typeName, name string) *field {
+	if t := c.types[typeName]; t != nil {
+		for i := range t.Fields {
+			if t.Fields[i].Name == name {
+				return &t.Fields[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+func findInputValue(values []inputValue, name string) *inputValue {
+	for i := range values {
+		if values[i].Name == name {
+			return &values[i]
+		}
+	}
+
+	return nil
+}
+
+// valueType returns the name of the type of the value being given in f
+func (c *completer) valueType(f *frame) string {
+	switch f.kind {
+	case argumentsFrame:
+		if fd := c.field(f.typeName, f.field); fd != nil {
+			if a := findInputValue(fd.Args, f.name); a != nil {
+				return a.Type.named()
+			}
+		}
+	case inputFrame:
+		if t := c.types[f.typeName]; t != nil {
+			if v := findInputValue(t.InputFields, f.name); v != nil {
+				return v.Type.named()
+			}
+		}
+	}
+
+	return ""
+}
+
+func (c *completer) rootType(operation string) string {
+	ref := c.schema.QueryType
+
+	switch operation {
+	case "mutation":
+		ref = c.schema.MutationType
+	case "subscription":
+		ref = c.schema.SubscriptionType
+	}
+
+	if ref == nil {
+		return ""
+	}
+
+	return ref.Name
+}
+
+// complete returns the candidates for completing the name at the end of doc
+// along with the partial name
+func (c *completer) complete(doc string) ([]string, string) {
+	i := len(doc)
+	for i > 0 && isName(doc[i-1]) {
+		i--
+	}
+
+	word := doc[i:]
+
+	tokens, open := lex(doc[:i])
+	if open || (i > 0 && doc[i-1] == '$') {
+		return nil, word
+	}
+
+	var stack []*frame
+	var operation string
+	var prev token
+
+	top := func() *frame {
+		if len(stack) == 0 {
+			return nil
+		}
+		return stack[len(stack)-1]
+	}
+
+	for _, t := range tokens {
+		f := top()
+
+		switch t.kind {
+		case '{':
+			switch {
+			case f == nil:
+				typeName := c.rootType(operation)
+				if prev.kind == 'a' && operation == "fragment" {
+					typeName = prev.text
+				}
+				stack = append(stack, &frame{kind: selectionFrame, typeName: typeName})
+			case f.kind == selectionFrame:
+				typeName := f.typeCond
+				if typeName == "" {
+					if fd := c.field(f.typeName, f.name); fd != nil {
+						typeName = fd.Type.named()
+					}
+				}
+				f.typeCond = ""
+				stack = append(stack, &frame{kind: selectionFrame, typeName: typeName})
+			default:
+				stack = append(stack, &frame{kind: inputFrame, typeName: c.valueType(f)})
+			}
+		case '(':
+			switch {
+			case f == nil:
+				stack = append(stack, &frame{kind: variablesFrame})
+			case f.kind == selectionFrame:
+				stack = append(stack, &frame{kind: argumentsFrame, typeName: f.typeName, field: f.name})
+			}
+		case '}', ')':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+			if f = top(); f != nil && f.list == 0 {
+				f.value = false
+			}
+		case '[':
+			if f != nil && f.value {
+				f.list++
+			}
+		case ']':
+			if f != nil && f.list > 0 {
+				if f.list--; f.list == 0 {
+					f.value = false
+				}
+			}
+		case ':':
+			if f != nil && f.kind != selectionFrame {
+				f.value = true
+			}
+		case 'a':
+			switch {
+			case f == nil:
+				if operation == "" {
+					operation = t.text
+				}
+			case f.kind == selectionFrame:
+				switch {
+				case f.on:
+					f.typeCond = t.text
+					f.on = false
+				case prev.kind == '.' && t.text == "on":
+					f.on = true
+				case prev.kind != '.':
+					f.name = t.text
+				}
+			case f.value:
+				if f.list == 0 {
+					f.value = false
+				}
+			default:
+				f.name = t.text
+			}
+		case '"', '0':
+			if f != nil && f.value && f.list == 0 {
+				f.value = false
+			}
+		}
+
+		prev = t
+	}
+
+	var candidates []string
+
+	switch f := top(); {
+	case f == nil:
+		if operation == "" {
+			candidates = []string{"query", "fragment"}
+			if c.schema.MutationType != nil {
+				candidates = append(candidates, "mutation")
+			}
+			if c.schema.SubscriptionType != nil {
+				candidates = append(candidates, "subscription")
+			}
+		} else if prev.kind == 'a' && prev.text == "on" {
+			candidates = c.typeNames("OBJECT", "INTERFACE", "UNION")
+		}
+	case f.kind == selectionFrame:
+		switch {
+		case f.on:
+			candidates = c.typeNames("OBJECT", "INTERFACE", "UNION")
+		case prev.kind == '.':
+			candidates = []string{"on"}
+		default:
+			if t := c.types[f.typeName]; t != nil {
+				for _, fd := range t.Fields {
+					candidates = append(candidates, fd.Name)
+				}
+				candidates = append(candidates, "__typename")
+			}
+		}
+	case f.kind == variablesFrame:
+		if f.value {
+			candidates = c.typeNames("SCALAR", "ENUM", "INPUT_OBJECT")
+		}
+	case f.value:
+		if t := c.types[c.valueType(f)]; t != nil {
+			switch {
+			case t.Kind == "ENUM":
+				for _, v := range t.EnumValues {
+					candidates = append(candidates, v.Name)
+				}
+			case t.Name == "Boolean":
+				candidates = []string{"true", "false"}
+			}
+		}
+	case f.kind == argumentsFrame:
+		if fd := c.field(f.typeName, f.field); fd != nil {
+			for _, a := range fd.Args {
+				candidates = append(candidates, a.Name)
+			}
+		}
+	case f.kind == inputFrame:
+		if t := c.types[f.typeName]; t != nil {
+			for _, v := range t.InputFields {
+				candidates = append(candidates, v.Name)
+			}
+		}
+	}
+
+	return filterPrefix(candidates, word), word
+}
+
+func (c *completer) typeNames(kinds ...string) []string {
+	var names []string
+
+	for _, t := range c.schema.Types {
+		if strings.HasPrefix(t.Name, "__") {
+			continue
+		}
+
+		for _, kind := range kinds {
+			if t.Kind == kind {
+				names = append(names, t.Name)
+				break
+			}
+		}
+	}
+
+	return names
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var ret []string
+
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			ret = append(ret, c)
+		}
+	}
+
+	sort.Strings(ret)
+
+	return ret
+}
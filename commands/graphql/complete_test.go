@@ -0,0 +1,94 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+func testCompleter(t *testing.T) *completer {
+	schema, err := graphql.ParseSchema(testSchema, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := schema.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result introspectionResult
+	if err = json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return newCompleter(&result.Schema)
+}
+
+func TestComplete(t *testing.T) {
+	c := testCompleter(t)
+
+	tests := []struct {
+		doc  string
+		want []string
+		word string
+	}{
+		{"", []string{"fragment", "query"}, ""},
+		{"{ re", []string{"result"}, "re"},
+		{"query Q { ", []string{"__typename", "old", "result", "search"}, ""},
+		{"{ result(requestID: \"x\") { ", []string{"__typename", "id", "status"}, ""},
+		{"{ r: result(", []string{"limit", "requestID"}, ""},
+		{"{ result(requestID: \"x\", l", []string{"limit"}, "l"},
+		{"{ search(filter: { ", []string{"ids", "status"}, ""},
+		{"{ search(filter: { status: ", []string{"COMPLETE", "PENDING"}, ""},
+		{"{ search(filter: { ids: [\"a\", \"b\"] s", []string{"status"}, "s"},
+		{"{ search { ... on ", []string{"Node", "Other", "Query", "Result", "SearchResult"}, ""},
+		{"{ search { ... on Result { st", []string{"status"}, "st"},
+		{"fragment F on Result { ", []string{"__typename", "id", "status"}, ""},
+		{"query Q($f: Fi", []string{"Filter"}, "Fi"},
+		{"{ result { id } ", []string{"__typename", "old", "result", "search"}, ""},
+		{"{ result(requestID: \"unterminated ", nil, ""},
+	}
+
+	for _, tt := range tests {
+		got, word := c.complete(tt.doc)
+
+		if !reflect.DeepEqual(got, tt.want) || word != tt.word {
+			t.Errorf("%q: got %v (%q), want %v (%q)", tt.doc, got, word, tt.want, tt.word)
+		}
+	}
+}
+
+func TestBalanced(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want bool
+	}{
+		{"{ a }", true},
+		{"query Q($a: Int) {\n  a(b: $a) {\n    c\n  }\n}", true},
+		{"query Q {", false},
+		{"{ a(b: \"}\") ", false},
+		{"{ a # }\n", false},
+		{"query Q", false},
+	}
+
+	for _, tt := range tests {
+		if got := balanced(tt.doc); got != tt.want {
+			t.Errorf("%q: got %t, want %t", tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestFindRequestID(t *testing.T) {
+	data := json.RawMessage(`{"queryUrl": {"error": null, "requestID": "abc"}}`)
+
+	if id := findRequestID(data); id != "abc" {
+		t.Errorf("unexpected request id: %q", id)
+	}
+
+	if id := findRequestID(nil); id != "" {
+		t.Errorf("unexpected request id: %q", id)
+	}
+}
@@ -3,7 +3,9 @@ package graphql
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -15,110 +17,378 @@ import (
 
 	zapi "zvelo.io/go-zapi"
 	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
 	"zvelo.io/zapi/results"
-	"zvelo.io/zapi/tokensourcer"
 )
 
 type cmd struct {
-	debug, trace       bool
-	insecureSkipVerify bool
-	timeout            time.Duration
-	clients            clients.Clients
-	query              string
+	opts      *options.Options
+	clients   clients.Clients
+	query     string
+	operation string
+	varsFile  string
+	vars      cli.StringSlice
+	selector  string
+	variables map[string]interface{}
+	validate  bool
+	refresh   bool
+
+	pollInterval time.Duration
+}
+
+func (c *cmd) refreshFlag() cli.Flag {
+	return cli.BoolFlag{
+		Name:        "refresh-schema",
+		Usage:       "fetch the schema from the endpoint even if it has been cached",
+		Destination: &c.refresh,
+	}
+}
+
+// clientFlags returns the options honored by every graphql command, along
+// with names, and the flags of the clients
+func (c *cmd) clientFlags(names ...options.Flag) []cli.Flag {
+	names = append(names,
+		options.FlagDebug,
+		options.FlagInsecureSkipVerify,
+		options.FlagTimeout,
+		options.FlagTraceFile,
+		options.FlagTraceEndpoint,
+	)
+
+	return append(c.opts.Flags(names...), c.clients.Flags()...)
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	return append(c.clients.Flags(),
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
-		cli.DurationFlag{
-			Name:        "timeout",
-			EnvVar:      "ZVELO_TIMEOUT",
-			Usage:       "maximum amount of time to wait for results to complete",
-			Value:       15 * time.Minute,
-			Destination: &c.timeout,
-		},
+	return append(c.clientFlags(options.FlagTrace, options.FlagJSON),
 		cli.StringFlag{
 			Name: "content",
 			Usage: "the graphql query to request" +
 				" if you start the content with the letter @, the rest should be a file name to read the data from, or - if you want zapi to read the data from stdin.",
 			Destination: &c.query,
 		},
+		cli.StringFlag{
+			Name:        "operation",
+			Usage:       "name of the operation to execute when the query contains more than one",
+			Destination: &c.operation,
+		},
+		cli.StringFlag{
+			Name:        "vars",
+			Usage:       "json file containing an object of query variables, - reads from stdin",
+			Destination: &c.varsFile,
+		},
+		cli.StringSliceFlag{
+			Name:  "var",
+			Usage: "query variable in the form key=value, values that are valid json are sent as json, otherwise as a string (can be repeated, overrides --vars)",
+			Value: &c.vars,
+		},
+		cli.StringFlag{
+			Name:        "select",
+			Usage:       "jq-like path (e.g. .result.queryStatus.complete) of the values in the response data to print, strings are printed without quotes",
+			Destination: &c.selector,
+		},
 		cli.BoolFlag{
-			Name:        "trace",
-			EnvVar:      "ZVELO_TRACE",
-			Usage:       "request a trace to be generated for each request",
-			Destination: &c.trace,
+			Name:        "validate",
+			Usage:       "validate the query against the schema before sending it",
+			Destination: &c.validate,
 		},
+		c.refreshFlag(),
 	)
 }
 
-func Command(appName string) cli.Command {
-	var c cmd
-	tokenSourcer := tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, strings.Fields(zapi.DefaultScopes)...)
-	c.clients = clients.New(tokenSourcer, &c.debug, &c.insecureSkipVerify)
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
 
 	return cli.Command{
 		Name:   "graphql",
 		Usage:  "make graphql query",
-		Before: c.setup,
+		Before: opts.Before(c.setup),
 		Action: c.action,
 		Flags:  c.Flags(),
+		Subcommands: []cli.Command{{
+			Name:   "schema",
+			Usage:  "print the schema of the graphql endpoint in the schema definition language",
+			Before: opts.Before(nil),
+			Action: c.schemaAction,
+			Flags:  c.clientFlags(options.FlagJSON),
+		}, {
+			Name:      "validate",
+			Usage:     "validate a graphql query document against the schema without sending it",
+			ArgsUsage: "FILE",
+			Before:    opts.Before(nil),
+			Action:    c.validateAction,
+			Flags:     append(c.clientFlags(), c.refreshFlag()),
+		}, {
+			Name:   "shell",
+			Usage:  "interactively enter graphql queries",
+			Before: opts.Before(nil),
+			Action: c.shellAction,
+			Flags:  c.shellFlags(),
+		}},
 	}
 }
 
-func (c *cmd) setup(_ *cli.Context) error {
-	if c.query == "" || c.query == "@" {
-		return errors.New("content is required")
-	}
-
+func readArg(name, arg string) (string, error) {
 	switch {
-	case c.query == "", c.query == "@":
-		return errors.New("content is required")
-	case c.query == "@-":
+	case arg == "":
+		return "", nil
+	case arg == "@":
+		return "", errors.Errorf("%s is required", name)
+	case arg == "@-":
 		// '@-' means we need to read from stdin
 		var buf bytes.Buffer
 		if _, err := buf.ReadFrom(os.Stdin); err != nil {
-			return err
+			return "", err
 		}
-		c.query = buf.String()
-	case c.query[0] == '@':
+		return buf.String(), nil
+	case arg[0] == '@':
 		// '@' is a filename that should be read for the content
-		data, err := ioutil.ReadFile(c.query[1:])
+		data, err := ioutil.ReadFile(arg[1:])
 		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	return arg, nil
+}
+
+func (c *cmd) setup(_ *cli.Context) error {
+	if c.query == "@-" && c.varsFile == "-" {
+		return errors.New("content and vars can't both be read from stdin")
+	}
+
+	var err error
+	if c.query, err = readArg("content", c.query); err != nil {
+		return err
+	}
+
+	c.variables, err = parseVariables(c.varsFile, c.vars)
+	return err
+}
+
+func parseVariables(file string, vars []string) (map[string]interface{}, error) {
+	variables := map[string]interface{}{}
+
+	if file != "" {
+		var r io.Reader = os.Stdin
+
+		if file != "-" {
+			f, err := os.Open(file) // #nosec
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = f.Close() }() // #nosec
+			r = f
+		}
+
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		if err := dec.Decode(&variables); err != nil {
+			return nil, errors.Wrapf(err, "error parsing vars file %s", file)
+		}
+	}
+
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid var %q, must be in the form key=value", v)
+		}
+
+		var value interface{}
+		dec := json.NewDecoder(strings.NewReader(parts[1]))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil || dec.More() {
+			value = parts[1]
+		}
+
+		variables[parts[0]] = value
+	}
+
+	if len(variables) == 0 {
+		return nil, nil
+	}
+
+	return variables, nil
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	if c.query == "" {
+		return errors.New("content is required")
+	}
+
+	ctx, cancel := c.opts.WithTimeout(context.Background())
+	defer cancel()
+
+	if c.opts.Trace {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+	}
+
+	if c.validate {
+		if err := c.validateQuery(ctx, "content", c.query); err != nil {
 			return err
 		}
-		c.query = string(data)
+	}
+
+	client, err := c.clients.GraphQL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(ctx, &clients.GraphQLRequest{
+		Query:         c.query,
+		OperationName: c.operation,
+		Variables:     c.variables,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = c.print(os.Stdout, resp.Data); err != nil {
+		return err
+	}
+
+	for _, e := range resp.Errors {
+		zvelo.Errorf("%s\n", e.Error())
+	}
+
+	if len(resp.Errors) > 0 {
+		return errors.Errorf("graphql query returned %d error(s)", len(resp.Errors))
 	}
 
 	return nil
 }
 
-func (c *cmd) action(_ *cli.Context) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+func (c *cmd) print(w io.Writer, data json.RawMessage) error {
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+
+	if c.opts.JSON && c.selector == "" {
+		_, err := fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+
+	values, err := selectPath(c.selector, v)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if s, ok := value.(string); ok && c.selector != "" {
+			fmt.Fprintln(w, s) // #nosec
+			continue
+		}
+
+		var b []byte
+		if c.opts.JSON {
+			b, err = json.Marshal(value)
+		} else {
+			b, err = json.MarshalIndent(value, "", "  ")
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "%s\n", b) // #nosec
+	}
+
+	return nil
+}
+
+func (c *cmd) schemaAction(_ *cli.Context) error {
+	ctx, cancel := c.opts.WithTimeout(context.Background())
 	defer cancel()
 
-	var opts []zapi.CallOption
+	if c.opts.JSON {
+		client, err := c.clients.GraphQL()
+		if err != nil {
+			return err
+		}
 
-	if c.trace {
-		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+		_, data, err := introspect(ctx, client)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	sdl, err := c.fetchSchema(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(sdl)
+
+	return nil
+}
+
+func (c *cmd) validateAction(cliCtx *cli.Context) error {
+	if cliCtx.NArg() != 1 {
+		return errors.New("a query document FILE is required, - reads from stdin")
 	}
 
-	var result string
-	if err := c.clients.RESTv1().GraphQL(ctx, c.query, &result, opts...); err != nil {
+	name := cliCtx.Args().First()
+
+	var data []byte
+	var err error
+
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name) // #nosec
+	}
+
+	if err != nil {
 		return err
 	}
 
-	fmt.Println(result)
+	ctx, cancel := c.opts.WithTimeout(context.Background())
+	defer cancel()
+
+	if err = c.validateQuery(ctx, name, string(data)); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s: valid\n", name)
+
+	return nil
+}
+
+// validateQuery checks query against the cached schema, printing any errors
+func (c *cmd) validateQuery(ctx context.Context, name, query string) error {
+	schema, err := c.loadSchema(ctx, c.refresh)
+	if err != nil {
+		return err
+	}
+
+	errs := schema.Validate(query)
+
+	for _, e := range errs {
+		if len(e.Locations) == 0 {
+			zvelo.Errorf("%s: %s\n", name, e.Message)
+			continue
+		}
+
+		for _, l := range e.Locations {
+			zvelo.Errorf("%s:%d:%d: %s\n", name, l.Line, l.Column, e.Message)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Errorf("%s: %d validation error(s)", name, len(errs))
+	}
 
 	return nil
 }
@@ -0,0 +1,77 @@
+package graphql
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testData = `{
+	"result": {
+		"requestID": "abc",
+		"responseDataset": {"categorization": {"value": [{"id": 1}, {"id": 2}]}}
+	}
+}`
+
+func TestSelectPath(t *testing.T) {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(testData))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{".result.requestID", []interface{}{"abc"}},
+		{`.result["requestID"]`, []interface{}{"abc"}},
+		{".result.responseDataset.categorization.value[1].id", []interface{}{json.Number("2")}},
+		{".result.responseDataset.categorization.value[-1].id", []interface{}{json.Number("2")}},
+		{".result.responseDataset.categorization.value[].id", []interface{}{json.Number("1"), json.Number("2")}},
+		{".result.missing.field", []interface{}{nil}},
+		{".", []interface{}{v}},
+	}
+
+	for _, tt := range tests {
+		got, err := selectPath(tt.path, v)
+		if err != nil {
+			t.Errorf("%s: %s", tt.path, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{".result.requestID[0]", ".result[", "result", ".result..requestID"} {
+		if _, err := selectPath(path, v); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestParseVariables(t *testing.T) {
+	got, err := parseVariables("", []string{"url=http://example.com", "limit=10", "dataset=[\"CATEGORIZATION\"]", "empty="})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"url":     "http://example.com",
+		"limit":   json.Number("10"),
+		"dataset": []interface{}{"CATEGORIZATION"},
+		"empty":   "",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err = parseVariables("", []string{"novalue"}); err == nil {
+		t.Error("expected an error for a var without a value")
+	}
+}
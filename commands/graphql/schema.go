@@ -0,0 +1,389 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/pkg/errors"
+
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+)
+
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+        }
+      }
+    }
+  }
+}`
+
+type typeRef struct {
+	Kind   string   `json:"kind"`
+	Name   *string  `json:"name"`
+	OfType *typeRef `json:"ofType"`
+}
+
+func (t *typeRef) String() string {
+	if t == nil {
+		return ""
+	}
+
+	switch t.Kind {
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	}
+
+	if t.Name == nil {
+		return ""
+	}
+
+	return *t.Name
+}
+
+// named returns the name of the type after unwrapping any lists and non-null
+// modifiers
+func (t *typeRef) named() string {
+	for t != nil && t.Name == nil {
+		t = t.OfType
+	}
+
+	if t == nil {
+		return ""
+	}
+
+	return *t.Name
+}
+
+type inputValue struct {
+	Name         string   `json:"name"`
+	Description  *string  `json:"description"`
+	Type         *typeRef `json:"type"`
+	DefaultValue *string  `json:"defaultValue"`
+}
+
+type field struct {
+	Name              string       `json:"name"`
+	Description       *string      `json:"description"`
+	Args              []inputValue `json:"args"`
+	Type              *typeRef     `json:"type"`
+	IsDeprecated      bool         `json:"isDeprecated"`
+	DeprecationReason *string      `json:"deprecationReason"`
+}
+
+type enumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type fullType struct {
+	Kind          string       `json:"kind"`
+	Name          string       `json:"name"`
+	Description   *string      `json:"description"`
+	Fields        []field      `json:"fields"`
+	InputFields   []inputValue `json:"inputFields"`
+	Interfaces    []typeRef    `json:"interfaces"`
+	EnumValues    []enumValue  `json:"enumValues"`
+	PossibleTypes []typeRef    `json:"possibleTypes"`
+}
+
+type namedRef struct {
+	Name string `json:"name"`
+}
+
+type introspectionSchema struct {
+	QueryType        *namedRef  `json:"queryType"`
+	MutationType     *namedRef  `json:"mutationType"`
+	SubscriptionType *namedRef  `json:"subscriptionType"`
+	Types            []fullType `json:"types"`
+}
+
+type introspectionResult struct {
+	Schema introspectionSchema `json:"__schema"`
+}
+
+// builtinScalars are defined by every graphql schema and are not printed
+var builtinScalars = map[string]bool{
+	"Int":     true,
+	"Float":   true,
+	"String":  true,
+	"Boolean": true,
+	"ID":      true,
+}
+
+func introspect(ctx context.Context, client clients.GraphQLClient) (*introspectionResult, json.RawMessage, error) {
+	resp, err := client.Do(ctx, &clients.GraphQLRequest{
+		Query:         introspectionQuery,
+		OperationName: "IntrospectionQuery",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = resp.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var result introspectionResult
+	if err = json.Unmarshal(resp.Data, &result); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing introspection result")
+	}
+
+	return &result, resp.Data, nil
+}
+
+func writeDescription(buf *bytes.Buffer, indent string, desc *string) {
+	if desc == nil || *desc == "" {
+		return
+	}
+
+	// graphql-go only understands comments as descriptions, so use them
+	// instead of block strings to allow the schema to be parsed again
+	for _, line := range strings.Split(strings.TrimSpace(*desc), "\n") {
+		fmt.Fprintf(buf, "%s# %s\n", indent, strings.TrimRight(line, " \t"))
+	}
+}
+
+func writeDeprecated(buf *bytes.Buffer, deprecated bool, reason *string) {
+	if !deprecated {
+		return
+	}
+
+	buf.WriteString(" @deprecated")
+
+	if reason != nil && *reason != "" {
+		r, _ := json.Marshal(*reason) // #nosec
+		fmt.Fprintf(buf, "(reason: %s)", r)
+	}
+}
+
+func writeInputValue(buf *bytes.Buffer, v inputValue) {
+	fmt.Fprintf(buf, "%s: %s", v.Name, v.Type)
+
+	if v.DefaultValue != nil {
+		fmt.Fprintf(buf, " = %s", *v.DefaultValue)
+	}
+}
+
+// sdl prints the schema in the graphql schema definition language
+func (s *introspectionSchema) sdl() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("schema {\n")
+	for _, op := range []struct {
+		name string
+		ref  *namedRef
+	}{
+		{"query", s.QueryType},
+		{"mutation", s.MutationType},
+		{"subscription", s.SubscriptionType},
+	} {
+		if op.ref != nil {
+			fmt.Fprintf(&buf, "  %s: %s\n", op.name, op.ref.Name)
+		}
+	}
+	buf.WriteString("}\n")
+
+	types := make([]fullType, len(s.Types))
+	copy(types, s.Types)
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+
+	for _, t := range types {
+		if strings.HasPrefix(t.Name, "__") || (t.Kind == "SCALAR" && builtinScalars[t.Name]) {
+			continue
+		}
+
+		buf.WriteString("\n")
+		writeDescription(&buf, "", t.Description)
+
+		switch t.Kind {
+		case "SCALAR":
+			fmt.Fprintf(&buf, "scalar %s\n", t.Name)
+		case "UNION":
+			names := make([]string, len(t.PossibleTypes))
+			for i, p := range t.PossibleTypes {
+				names[i] = p.String()
+			}
+			fmt.Fprintf(&buf, "union %s = %s\n", t.Name, strings.Join(names, " | "))
+		case "ENUM":
+			fmt.Fprintf(&buf, "enum %s {\n", t.Name)
+			for _, v := range t.EnumValues {
+				writeDescription(&buf, "  ", v.Description)
+				fmt.Fprintf(&buf, "  %s", v.Name)
+				writeDeprecated(&buf, v.IsDeprecated, v.DeprecationReason)
+				buf.WriteString("\n")
+			}
+			buf.WriteString("}\n")
+		case "INPUT_OBJECT":
+			fmt.Fprintf(&buf, "input %s {\n", t.Name)
+			for _, f := range t.InputFields {
+				writeDescription(&buf, "  ", f.Description)
+				buf.WriteString("  ")
+				writeInputValue(&buf, f)
+				buf.WriteString("\n")
+			}
+			buf.WriteString("}\n")
+		case "OBJECT", "INTERFACE":
+			kind := "type"
+			if t.Kind == "INTERFACE" {
+				kind = "interface"
+			}
+
+			fmt.Fprintf(&buf, "%s %s", kind, t.Name)
+
+			if len(t.Interfaces) > 0 {
+				names := make([]string, len(t.Interfaces))
+				for i, iface := range t.Interfaces {
+					names[i] = iface.String()
+				}
+				fmt.Fprintf(&buf, " implements %s", strings.Join(names, " & "))
+			}
+
+			buf.WriteString(" {\n")
+			for _, f := range t.Fields {
+				writeDescription(&buf, "  ", f.Description)
+				fmt.Fprintf(&buf, "  %s", f.Name)
+
+				if len(f.Args) > 0 {
+					buf.WriteString("(")
+					for i, a := range f.Args {
+						if i > 0 {
+							buf.WriteString(", ")
+						}
+						writeInputValue(&buf, a)
+					}
+					buf.WriteString(")")
+				}
+
+				fmt.Fprintf(&buf, ": %s", f.Type)
+				writeDeprecated(&buf, f.IsDeprecated, f.DeprecationReason)
+				buf.WriteString("\n")
+			}
+			buf.WriteString("}\n")
+		}
+	}
+
+	return buf.String()
+}
+
+// schemaCacheFile returns the name of the file that the schema fetched from u
+// is cached to
+func schemaCacheFile(appName, u string) string {
+	return filepath.Join(zvelo.DataDir(appName), fmt.Sprintf("schema_%x.graphql", sha256.Sum256([]byte(u))))
+}
+
+// fetchSchema introspects the schema and caches its sdl
+func (c *cmd) fetchSchema(ctx context.Context) (string, error) {
+	client, err := c.clients.GraphQL()
+	if err != nil {
+		return "", err
+	}
+
+	result, _, err := introspect(ctx, client)
+	if err != nil {
+		return "", errors.Wrap(err, "error fetching schema")
+	}
+
+	sdl := result.Schema.sdl()
+
+	fileName := schemaCacheFile(c.opts.AppName(), client.URL())
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err == nil {
+		_ = ioutil.WriteFile(fileName, []byte(sdl), 0600) // #nosec
+	}
+
+	return sdl, nil
+}
+
+// loadSchema returns the cached schema, fetching it if it isn't cached or if
+// refresh is true
+func (c *cmd) loadSchema(ctx context.Context, refresh bool) (*graphql.Schema, error) {
+	client, err := c.clients.GraphQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var sdl string
+	if !refresh {
+		if data, err := ioutil.ReadFile(schemaCacheFile(c.opts.AppName(), client.URL())); err == nil {
+			sdl = string(data)
+		}
+	}
+
+	if sdl == "" {
+		if sdl, err = c.fetchSchema(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	schema, err := graphql.ParseSchema(sdl, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing schema")
+	}
+
+	return schema, nil
+}
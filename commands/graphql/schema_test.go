@@ -0,0 +1,98 @@
+package graphql
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+const testSchema = `
+schema {
+	query: Query
+}
+
+# Node is anything with an id
+interface Node {
+	id: ID!
+}
+
+type Query {
+	# look up a result
+	result(requestID: ID!, limit: Int = 10): Result
+	search(filter: Filter): [SearchResult!]!
+	old: String @deprecated(reason: "use result")
+}
+
+type Result implements Node {
+	id: ID!
+	status: Status!
+}
+
+type Other implements Node {
+	id: ID!
+}
+
+union SearchResult = Result | Other
+
+enum Status {
+	PENDING
+	COMPLETE
+}
+
+input Filter {
+	status: Status = PENDING
+	ids: [ID!]
+}
+
+scalar Time
+`
+
+func sdlFromSchema(t *testing.T, s string) string {
+	schema, err := graphql.ParseSchema(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := schema.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result introspectionResult
+	if err = json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result.Schema.sdl()
+}
+
+func TestSDLRoundTrip(t *testing.T) {
+	sdl := sdlFromSchema(t, testSchema)
+
+	for _, want := range []string{
+		"  query: Query\n",
+		"# look up a result\n",
+		"  result(requestID: ID!, limit: Int = 10): Result\n",
+		"  search(filter: Filter): [SearchResult!]!\n",
+		`  old: String @deprecated(reason: "use result")`,
+		"type Result implements Node {\n",
+		"union SearchResult = ",
+		"  status: Status = PENDING\n",
+		"scalar Time\n",
+	} {
+		if !strings.Contains(sdl, want) {
+			t.Errorf("sdl does not contain %q:\n%s", want, sdl)
+		}
+	}
+
+	if strings.Contains(sdl, "__") || strings.Contains(sdl, "scalar String") {
+		t.Errorf("sdl contains introspection types or builtin scalars:\n%s", sdl)
+	}
+
+	// the generated sdl must parse and produce the same schema
+	if again := sdlFromSchema(t, sdl); again != sdl {
+		t.Errorf("sdl did not round trip:\n%s\n---\n%s", sdl, again)
+	}
+}
@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// selectPath applies a jq-like path (e.g. ".result.queryStatus.complete",
+// ".items[0].name" or ".items[].name") to a decoded json value. Since "[]"
+// iterates over every element of an array, a path can select more than one
+// value.
+func selectPath(path string, v interface{}) ([]interface{}, error) {
+	path = strings.TrimSpace(path)
+	if path == "" || path == "." {
+		return []interface{}{v}, nil
+	}
+
+	values := []interface{}{v}
+
+	for path != "" {
+		var key string
+		var index int
+		var iterate, isIndex bool
+
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+
+			if key = path[:end]; key == "" {
+				if path != "" && path[0] == '[' {
+					continue
+				}
+				return nil, errors.New("select: empty field name")
+			}
+
+			path = path[end:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				return nil, errors.Errorf("select: unterminated %q", path)
+			}
+
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+
+			if inner == "" {
+				iterate = true
+				break
+			}
+
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				key = unquoted
+				break
+			}
+
+			var err error
+			if index, err = strconv.Atoi(inner); err != nil {
+				return nil, errors.Errorf("select: invalid index %q", inner)
+			}
+			isIndex = true
+		default:
+			return nil, errors.Errorf("select: unexpected %q", path)
+		}
+
+		var next []interface{}
+
+		for _, value := range values {
+			switch {
+			case iterate:
+				switch t := value.(type) {
+				case []interface{}:
+					next = append(next, t...)
+				case map[string]interface{}:
+					for _, k := range sortedKeys(t) {
+						next = append(next, t[k])
+					}
+				case nil:
+				default:
+					return nil, errors.Errorf("select: cannot iterate over %T", value)
+				}
+			case isIndex:
+				switch t := value.(type) {
+				case []interface{}:
+					i := index
+					if i < 0 {
+						i += len(t)
+					}
+
+					if i < 0 || i >= len(t) {
+						next = append(next, nil)
+					} else {
+						next = append(next, t[i])
+					}
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, errors.Errorf("select: cannot index %T with %d", value, index)
+				}
+			default:
+				switch t := value.(type) {
+				case map[string]interface{}:
+					next = append(next, t[key])
+				case nil:
+					next = append(next, nil)
+				default:
+					return nil, errors.Errorf("select: cannot get field %q of %T", key, value)
+				}
+			}
+		}
+
+		values = next
+	}
+
+	return values, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,417 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/readline"
+	"zvelo.io/zapi/internal/zvelo"
+)
+
+const shellHelp = `Enter a graphql document. It is sent as soon as all of its braces are closed.
+Press ctrl-c to discard the document being entered and ctrl-d to exit.
+
+Commands:
+  :help              show this help
+  :var key=value     set a query variable, values that are valid json are sent as json
+  :vars              show the query variables
+  :unset key         remove a query variable
+  :schema            print the schema
+  :poll [requestID]  poll the result of a query until it is complete, the
+                     request id defaults to the one in the last response
+  :quit              exit the shell
+`
+
+var shellCommands = []string{":help", ":var", ":vars", ":unset", ":schema", ":poll", ":quit"}
+
+type shell struct {
+	*cmd
+	client    clients.GraphQLClient
+	editor    *readline.Editor
+	completer *completer
+	vars      map[string]interface{}
+	last      json.RawMessage
+	history   io.Writer
+}
+
+func (c *cmd) shellFlags() []cli.Flag {
+	return append(c.clientFlags(),
+		cli.DurationFlag{
+			Name:        "poll-interval",
+			Usage:       "how often :poll requests the result",
+			Value:       1 * time.Second,
+			Destination: &c.pollInterval,
+		},
+	)
+}
+
+func historyFile(appName string) string {
+	return filepath.Join(zvelo.DataDir(appName), "graphql_history")
+}
+
+func (c *cmd) shellAction(_ *cli.Context) error {
+	client, err := c.clients.GraphQL()
+	if err != nil {
+		return err
+	}
+
+	s := shell{
+		cmd:    c,
+		client: client,
+		editor: readline.New(os.Stdin, os.Stdout),
+		vars:   map[string]interface{}{},
+	}
+
+	s.editor.Complete = s.complete
+
+	ctx, cancel := c.opts.WithTimeout(context.Background())
+	result, _, err := introspect(ctx, client)
+	cancel()
+
+	if err != nil {
+		zvelo.Errorf("error fetching schema, completion is disabled: %s\n", err)
+	} else {
+		s.completer = newCompleter(&result.Schema)
+	}
+
+	fileName := historyFile(c.opts.AppName())
+	if f, err := os.Open(fileName); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			s.editor.AddHistory(scanner.Text())
+		}
+		_ = f.Close() // #nosec
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0700); err == nil {
+		f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err == nil {
+			defer func() { _ = f.Close() }() // #nosec
+			s.history = f
+		}
+	}
+
+	if s.editor.Terminal() {
+		fmt.Println("type :help for help")
+	}
+
+	return s.run()
+}
+
+// run reads and executes documents and commands until the input is closed or
+// the user quits
+func (s *shell) run() error {
+	var pending []string
+
+	for {
+		prompt := "graphql> "
+		if len(pending) > 0 {
+			prompt = "     ... "
+		}
+
+		line, err := s.editor.ReadLine(prompt)
+
+		switch err {
+		case nil:
+		case readline.ErrInterrupt:
+			pending = nil
+			continue
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+
+		if len(pending) == 0 {
+			trimmed := strings.TrimSpace(line)
+
+			if trimmed == "" {
+				continue
+			}
+
+			if strings.HasPrefix(trimmed, ":") {
+				s.addHistory(trimmed)
+
+				if quit := s.command(trimmed); quit {
+					return nil
+				}
+
+				continue
+			}
+		}
+
+		pending = append(pending, line)
+		doc := strings.Join(pending, "\n")
+
+		if !balanced(doc) {
+			continue
+		}
+
+		pending = nil
+		s.addHistory(flatten(doc))
+		s.exec(doc)
+	}
+}
+
+// flatten joins the lines of a document so that it can be recalled from
+// history as a single line
+func flatten(doc string) string {
+	lines := strings.Split(doc, "\n")
+	parts := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			parts = append(parts, line)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (s *shell) addHistory(line string) {
+	s.editor.AddHistory(line)
+
+	if s.history != nil {
+		fmt.Fprintln(s.history, line) // #nosec
+	}
+}
+
+func (s *shell) complete(prefix string) ([]string, string) {
+	if strings.HasPrefix(strings.TrimSpace(prefix), ":") && !strings.Contains(prefix, " ") {
+		return filterPrefix(shellCommands, prefix), prefix
+	}
+
+	if s.completer == nil {
+		return nil, ""
+	}
+
+	return s.completer.complete(prefix)
+}
+
+// withInterrupt returns a context that is canceled by ctrl-c or once the
+// timeout has elapsed
+func (s *shell) withInterrupt() (context.Context, context.CancelFunc) {
+	ctx, cancel := s.opts.WithTimeout(context.Background())
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt)
+
+	go func() {
+		select {
+		case <-ch:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
+
+func (s *shell) do(doc string, vars map[string]interface{}) (*clients.GraphQLResponse, error) {
+	ctx, cancel := s.withInterrupt()
+	defer cancel()
+
+	return s.client.Do(ctx, &clients.GraphQLRequest{
+		Query:     doc,
+		Variables: vars,
+	})
+}
+
+func (s *shell) exec(doc string) {
+	var vars map[string]interface{}
+	if len(s.vars) > 0 {
+		vars = s.vars
+	}
+
+	resp, err := s.do(doc, vars)
+	if err != nil {
+		zvelo.Errorf("%s\n", err)
+		return
+	}
+
+	s.printResponse(resp)
+
+	if len(resp.Data) > 0 && string(resp.Data) != "null" {
+		s.last = resp.Data
+	}
+}
+
+func (s *shell) printResponse(resp *clients.GraphQLResponse) {
+	if err := s.print(os.Stdout, resp.Data); err != nil {
+		zvelo.Errorf("%s\n", err)
+	}
+
+	for _, e := range resp.Errors {
+		zvelo.Errorf("%s\n", e.Error())
+	}
+}
+
+// command runs a shell command and reports whether the shell should exit
+func (s *shell) command(line string) bool {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case ":help", ":h", ":?":
+		fmt.Print(shellHelp)
+	case ":quit", ":q", ":exit":
+		return true
+	case ":var":
+		vars, err := parseVariables("", args)
+		if err != nil {
+			zvelo.Errorf("%s\n", err)
+			break
+		}
+
+		for k, v := range vars {
+			s.vars[k] = v
+		}
+	case ":vars":
+		keys := make([]string, 0, len(s.vars))
+		for k := range s.vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v, _ := json.Marshal(s.vars[k]) // #nosec
+			fmt.Printf("%s=%s\n", k, v)
+		}
+	case ":unset":
+		for _, k := range args {
+			delete(s.vars, k)
+		}
+	case ":schema":
+		if s.completer == nil {
+			zvelo.Errorf("the schema is not available\n")
+			break
+		}
+
+		fmt.Print(s.completer.schema.sdl())
+	case ":poll":
+		var id string
+		if len(args) > 0 {
+			id = args[0]
+		} else {
+			id = findRequestID(s.last)
+		}
+
+		if id == "" {
+			zvelo.Errorf("no request id, give one or make a queryUrl or queryContent request first\n")
+			break
+		}
+
+		if err := s.poll(id); err != nil {
+			zvelo.Errorf("%s\n", err)
+		}
+	default:
+		zvelo.Errorf("unknown command %s, type :help for help\n", name)
+	}
+
+	return false
+}
+
+// findRequestID returns the first requestID found in data
+func findRequestID(data json.RawMessage) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return ""
+	}
+
+	var find func(interface{}) string
+	find = func(v interface{}) string {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if id, ok := t["requestID"].(string); ok && id != "" {
+				return id
+			}
+
+			for _, k := range sortedKeys(t) {
+				if id := find(t[k]); id != "" {
+					return id
+				}
+			}
+		case []interface{}:
+			for _, e := range t {
+				if id := find(e); id != "" {
+					return id
+				}
+			}
+		}
+
+		return ""
+	}
+
+	return find(v)
+}
+
+type pollResult struct {
+	Result *struct {
+		QueryStatus struct {
+			Complete bool             `json:"complete"`
+			Error    *json.RawMessage `json:"error"`
+		} `json:"queryStatus"`
+	} `json:"result"`
+}
+
+func (s *shell) poll(id string) error {
+	ctx, cancel := s.withInterrupt()
+	defer cancel()
+
+	color.New(color.FgCyan).Printf("polling %s\n", id) // #nosec
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		resp, err := s.client.Do(ctx, &clients.GraphQLRequest{
+			Query:     clients.GraphQLResultQuery,
+			Variables: map[string]interface{}{"requestID": id},
+		})
+		if err != nil {
+			return err
+		}
+
+		if err = resp.Err(); err != nil {
+			return err
+		}
+
+		var result pollResult
+		if err = json.Unmarshal(resp.Data, &result); err != nil {
+			return err
+		}
+
+		if result.Result != nil && (result.Result.QueryStatus.Complete || result.Result.QueryStatus.Error != nil) {
+			s.printResponse(resp)
+			s.last = resp.Data
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "polling stopped")
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"zvelo.io/zapi/options"
+	zpolicy "zvelo.io/zapi/policy"
+	"zvelo.io/zapi/results"
+)
+
+type cmd struct {
+	opts   *options.Options
+	file   string
+	policy *zpolicy.Policy
+	files  []string
+}
+
+func (c *cmd) evalFlags() []cli.Flag {
+	return append(c.opts.Flags(options.FlagJSON),
+		cli.StringFlag{
+			Name:        "policy",
+			EnvVar:      "ZVELO_POLICY",
+			Usage:       "yaml or json policy file to evaluate",
+			Destination: &c.file,
+		},
+	)
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+
+	return cli.Command{
+		Name:  "policy",
+		Usage: "decide whether urls should be allowed, blocked or warned about using a policy",
+		Subcommands: []cli.Command{{
+			Name:      "eval",
+			Usage:     "evaluate a policy against results saved with --json by query, stream or receiver",
+			ArgsUsage: "RESULTS.jsonl...",
+			Before:    opts.Before(c.setup),
+			Action:    c.evalAction,
+			Flags:     c.evalFlags(),
+		}},
+	}
+}
+
+func (c *cmd) setup(cli *cli.Context) error {
+	if c.file == "" {
+		return errors.New("--policy is required")
+	}
+
+	c.files = cli.Args()
+
+	if len(c.files) == 0 {
+		return errors.New("at least one results file is required, - reads from stdin")
+	}
+
+	p, err := zpolicy.Load(c.file)
+	if err != nil {
+		return err
+	}
+
+	c.policy = p
+	return nil
+}
+
+// evaluation is the decision for a url
+type evaluation struct {
+	URL string `json:"url"`
+	zpolicy.Decision
+}
+
+func (c *cmd) evaluate(saved []results.Saved) []evaluation {
+	latest := results.Latest(saved)
+
+	urls := make([]string, 0, len(latest))
+	for u := range latest {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	evals := make([]evaluation, len(urls))
+	for i, u := range urls {
+		evals[i] = evaluation{
+			URL:      u,
+			Decision: c.policy.Evaluate(latest[u]),
+		}
+	}
+
+	return evals
+}
+
+func (c *cmd) evalAction(_ *cli.Context) error {
+	var saved []results.Saved
+
+	for _, name := range c.files {
+		s, err := results.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		saved = append(saved, s...)
+	}
+
+	evals := c.evaluate(saved)
+
+	if c.opts.JSON {
+		return writeJSON(os.Stdout, evals)
+	}
+
+	return writeText(os.Stdout, evals)
+}
+
+func writeJSON(w io.Writer, evals []evaluation) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	for _, e := range evals {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeText(w io.Writer, evals []evaluation) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "URL\tACTION\tRULE\n") // #nosec
+
+	counts := map[zpolicy.Action]int{}
+
+	for _, e := range evals {
+		counts[e.Action]++
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", e.URL, e.Action, e.Rule) // #nosec
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "\n%d urls: %d allow, %d warn, %d block\n", // #nosec
+		len(evals), counts[zpolicy.Allow], counts[zpolicy.Warn], counts[zpolicy.Block])
+
+	return nil
+}
@@ -3,7 +3,6 @@ package poll
 import (
 	"context"
 	"strings"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
@@ -12,79 +11,43 @@ import (
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/clients"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
 	"zvelo.io/zapi/poller"
 	"zvelo.io/zapi/results"
-	"zvelo.io/zapi/tokensourcer"
 )
 
 type cmd struct {
-	debug, trace, rest, json bool
-	insecureSkipVerify       bool
-	clients                  clients.Clients
-	poller                   poller.Poller
-	timeout                  time.Duration
-	requests                 poller.Requests
+	opts     *options.Options
+	clients  clients.Clients
+	poller   poller.Poller
+	requests poller.Requests
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	flags := append(c.clients.Flags(), c.poller.Flags()...)
-	return append(flags,
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
-		cli.BoolFlag{
-			Name:        "trace",
-			EnvVar:      "ZVELO_TRACE",
-			Usage:       "request a trace to be generated for each request",
-			Destination: &c.trace,
-		},
-		cli.DurationFlag{
-			Name:        "timeout",
-			EnvVar:      "ZVELO_TIMEOUT",
-			Usage:       "maximum amount of time to wait for results to complete",
-			Value:       15 * time.Minute,
-			Destination: &c.timeout,
-		},
-		cli.BoolFlag{
-			Name:        "rest",
-			EnvVar:      "ZVELO_REST",
-			Usage:       "Use REST instead of gRPC for api requests",
-			Destination: &c.rest,
-		},
-		cli.BoolFlag{
-			Name:        "json",
-			EnvVar:      "ZVELO_JSON",
-			Usage:       "Print raw JSON response",
-			Destination: &c.json,
-		},
-	)
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	return append(flags, c.poller.Flags()...)
 }
 
-func Command(appName string) cli.Command {
-	var c cmd
-	tokenSourcer := tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, strings.Fields(zapi.DefaultScopes)...)
-	c.clients = clients.New(tokenSourcer, &c.debug, &c.insecureSkipVerify)
-	c.poller = poller.New(&c.debug, &c.rest, &c.trace, c.clients)
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
+	c.poller = poller.New(opts, c.clients)
 
 	return cli.Command{
 		Name:      "poll",
 		Usage:     "poll for results with a request-id",
 		ArgsUsage: "request_id [request_id...]",
-		Before:    c.setup,
+		Before:    opts.Before(c.setup),
 		Action:    c.action,
 		Flags:     c.Flags(),
 	}
 }
 
 func (c *cmd) setup(cli *cli.Context) error {
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
 	c.requests = poller.Requests{}
 
 	for _, requestID := range cli.Args() {
@@ -99,7 +62,7 @@ func (c *cmd) setup(cli *cli.Context) error {
 }
 
 func (c *cmd) action(_ *cli.Context) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := c.opts.WithTimeout(context.Background())
 	defer cancel()
 
 	c.poller.Poll(ctx, c.requests, c)
@@ -108,8 +71,8 @@ func (c *cmd) action(_ *cli.Context) error {
 }
 
 func (c *cmd) Result(ctx context.Context, result *msg.QueryResult) poller.Requests {
-	if complete := zvelo.IsComplete(result); complete || c.debug {
-		results.Print(result, c.json)
+	if complete := zvelo.IsComplete(result); complete || c.opts.Debug {
+		results.Print(result, c.opts.JSON)
 	}
 
 	return nil
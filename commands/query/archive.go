@@ -0,0 +1,305 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/policy"
+	"zvelo.io/zapi/results"
+)
+
+// archiveEntry is an html response read from a har or warc archive
+type archiveEntry struct {
+	File    string `json:"file"`
+	Index   int    `json:"index"`
+	URL     string `json:"url"`
+	Time    string `json:"time,omitempty"`
+	content *msg.URLContent
+}
+
+func (e archiveEntry) String() string {
+	s := fmt.Sprintf("%s#%d", e.File, e.Index)
+	if e.Time != "" {
+		s += " (" + e.Time + ")"
+	}
+	return s
+}
+
+func isHTML(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "html")
+}
+
+// readHAR returns each html response in a har file. Index is the position of
+// the entry in log.entries.
+func readHAR(name string, data []byte) ([]archiveEntry, error) {
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, errors.Wrapf(err, "error parsing har %s", name)
+	}
+
+	if har.Log == nil {
+		return nil, errors.Errorf("%s is not a har file", name)
+	}
+
+	var entries []archiveEntry
+
+	for i, e := range har.Log.Entries {
+		if e.Response.Content.Text == "" || !isHTML(e.Response.Content.MimeType) {
+			continue
+		}
+
+		uc, err := e.urlContent()
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s#%d", name, i)
+		}
+
+		entries = append(entries, archiveEntry{
+			File:    name,
+			Index:   i,
+			URL:     uc.Url,
+			Time:    e.StartedDateTime,
+			content: uc,
+		})
+	}
+
+	return entries, nil
+}
+
+// maxHARSize is the largest har file that will be read. har files hold every
+// response of a page load and are parsed in memory, so they are limited
+// separately from the content of each response.
+const maxHARSize = 1 << 30
+
+// warcHeaderSlack is the room allowed for the http status line and headers of
+// a warc response record on top of the maximum content size
+const warcHeaderSlack = 64 << 10
+
+// readWARC returns each html response record in a warc file. The file may be
+// gzip compressed, as a whole or per record. Index is the position of the
+// record in the file. Response records larger than maxSize, plus room for
+// their http headers, are skipped.
+func readWARC(name string, r io.Reader, maxSize int64) ([]archiveEntry, error) {
+	br := bufio.NewReader(r)
+
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// gzip.Reader reads each member of a multistream file
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		br = bufio.NewReader(gr)
+	}
+
+	tp := textproto.NewReader(br)
+
+	var entries []archiveEntry
+
+	for i := 0; ; i++ {
+		version, err := tp.ReadLine()
+		for err == nil && version == "" {
+			// records are separated by blank lines
+			version, err = tp.ReadLine()
+		}
+
+		if err == io.EOF {
+			return entries, nil
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+
+		if !strings.HasPrefix(version, "WARC/") {
+			return nil, errors.Errorf("%s#%d: invalid warc record: %q", name, i, version)
+		}
+
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s#%d: error reading warc headers", name, i)
+		}
+
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil || length < 0 {
+			return nil, errors.Errorf("%s#%d: invalid content length", name, i)
+		}
+
+		if header.Get("WARC-Type") != "response" || !strings.HasPrefix(header.Get("Content-Type"), "application/http") {
+			if _, err = io.CopyN(ioutil.Discard, br, length); err != nil {
+				return nil, errors.Wrapf(err, "%s#%d: error reading warc record", name, i)
+			}
+			continue
+		}
+
+		if length > maxSize+warcHeaderSlack {
+			zvelo.Errorf("%s#%d: record is larger than the maximum of %d bytes, see --max-content-size\n", name, i, maxSize)
+
+			if _, err = io.CopyN(ioutil.Discard, br, length); err != nil {
+				return nil, errors.Wrapf(err, "%s#%d: error reading warc record", name, i)
+			}
+			continue
+		}
+
+		block := make([]byte, length)
+		if _, err = io.ReadFull(br, block); err != nil {
+			return nil, errors.Wrapf(err, "%s#%d: error reading warc record", name, i)
+		}
+
+		uc, err := warcResponse(block)
+		if err != nil {
+			zvelo.Errorf("%s#%d: %s\n", name, i, err)
+			continue
+		}
+
+		if uc == nil {
+			continue
+		}
+
+		uc.Url = strings.Trim(header.Get("WARC-Target-URI"), "<>")
+
+		entries = append(entries, archiveEntry{
+			File:    name,
+			Index:   i,
+			URL:     uc.Url,
+			Time:    header.Get("WARC-Date"),
+			content: uc,
+		})
+	}
+}
+
+// warcResponse returns the content of an http response record, or nil if it
+// isn't html
+func warcResponse(block []byte) (*msg.URLContent, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing http response")
+	}
+	defer func() { _ = resp.Body.Close() }() // #nosec
+
+	if !isHTML(resp.Header.Get("Content-Type")) {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading http response")
+	}
+
+	uc := msg.URLContent{Content: string(body)}
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			addHeader(&uc, name, value)
+		}
+	}
+
+	return &uc, nil
+}
+
+// setupArchives adds the content of each html response in the har and warc
+// files. Entries with the same url and content are only queried once and
+// entries whose content can't be used are skipped.
+func (c *cmd) setupArchives() error {
+	var entries []archiveEntry
+
+	for _, name := range c.harFiles {
+		data, err := readFileArg(name, maxHARSize)
+		if err != nil {
+			return err
+		}
+
+		e, err := readHAR(name, data)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, e...)
+	}
+
+	for _, name := range c.warcFiles {
+		f, err := os.Open(name) // #nosec
+		if err != nil {
+			return err
+		}
+
+		e, err := readWARC(name, f, c.maxContentSize)
+		_ = f.Close() // #nosec
+
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, e...)
+	}
+
+	if len(entries) == 0 {
+		return errors.New("no html responses found in the archives")
+	}
+
+	c.archive = map[string][]archiveEntry{}
+
+	for _, e := range entries {
+		if err := c.prepareContent("", e.content); err != nil {
+			zvelo.Errorf("skipping %s: %s\n", e, err)
+			continue
+		}
+
+		key := e.content.Url + e.content.Content
+
+		if _, ok := c.archive[key]; !ok {
+			c.urlContent = append(c.urlContent, e.content)
+		}
+
+		c.archive[key] = append(c.archive[key], e)
+	}
+
+	return nil
+}
+
+// printArchiveResult prints result along with the archive entries it is for
+// and the policy decision made for it, if there is one
+func (c *cmd) printArchiveResult(result *msg.QueryResult, entries []archiveEntry) {
+	d := c.policy.Decide(result)
+
+	if c.opts.JSON {
+		var buf bytes.Buffer
+		if err := jsonMarshaler.Marshal(&buf, result); err != nil {
+			zvelo.Errorf("marshal error: %s\n", err)
+			return
+		}
+
+		data, err := json.Marshal(struct {
+			Entries []archiveEntry   `json:"entries"`
+			Result  json.RawMessage  `json:"result"`
+			Policy  *policy.Decision `json:"policy,omitempty"`
+		}{entries, buf.Bytes(), d})
+		if err != nil {
+			zvelo.Errorf("marshal error: %s\n", err)
+			return
+		}
+
+		fmt.Fprintf(os.Stdout, "%s\n", data) // #nosec
+		return
+	}
+
+	results.PrintDecision(result, d, false)
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stdout)
+	for _, e := range entries {
+		printf("Archive Entry:      %s\n", e)
+	}
+}
@@ -0,0 +1,124 @@
+package query
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func warcRecord(typ, uri, contentType, block string) string {
+	return fmt.Sprintf("WARC/1.0\r\nWARC-Type: %s\r\nWARC-Target-URI: <%s>\r\nWARC-Date: 2019-01-02T03:04:05Z\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+		typ, uri, contentType, len(block), block)
+}
+
+func testWARC() []string {
+	const html = "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nTransfer-Encoding: chunked\r\n\r\n6\r\n<html>\r\n7\r\n</html>\r\n0\r\n\r\n"
+	const png = "HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-Length: 3\r\n\r\nabc"
+
+	return []string{
+		warcRecord("warcinfo", "", "application/warc-fields", "software: test\r\n"),
+		warcRecord("request", "http://example.com/", "application/http; msgtype=request", "GET / HTTP/1.1\r\n\r\n"),
+		warcRecord("response", "http://example.com/", "application/http; msgtype=response", html),
+		warcRecord("response", "http://example.com/a.png", "application/http; msgtype=response", png),
+	}
+}
+
+func checkWARC(t *testing.T, entries []archiveEntry, err error) {
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	e := entries[0]
+	if e.Index != 2 || e.URL != "http://example.com/" || e.Time != "2019-01-02T03:04:05Z" {
+		t.Errorf("unexpected entry: %v", e)
+	}
+
+	if e.content.Content != "<html></html>" || e.content.Header["Content-Type"] != "text/html" {
+		t.Errorf("unexpected content: %v", e.content)
+	}
+}
+
+func TestReadWARC(t *testing.T) {
+	var plain, compressed bytes.Buffer
+
+	for _, r := range testWARC() {
+		plain.WriteString(r)
+
+		// each record is a separate gzip member
+		w := gzip.NewWriter(&compressed)
+		if _, err := w.Write([]byte(r)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := readWARC("test.warc", bytes.NewReader(plain.Bytes()), 1024)
+	checkWARC(t, entries, err)
+
+	entries, err = readWARC("test.warc.gz", &compressed, 1024)
+	checkWARC(t, entries, err)
+
+	// html responses that are too large are skipped
+	large := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + strings.Repeat("a", 1024+warcHeaderSlack)
+	plain.WriteString(warcRecord("response", "http://example.com/large", "application/http; msgtype=response", large))
+
+	entries, err = readWARC("test.warc", bytes.NewReader(plain.Bytes()), 1024)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("unexpected entries: %v, %v", entries, err)
+	}
+
+	for _, length := range []string{"-1", "nope"} {
+		r := "WARC/1.0\r\nWARC-Type: response\r\nContent-Length: " + length + "\r\n\r\n"
+		if _, err = readWARC("test.warc", bytes.NewReader([]byte(r)), 1024); err == nil {
+			t.Errorf("expected an error for content length %s", length)
+		}
+	}
+}
+
+func TestReadHAR(t *testing.T) {
+	const har = `{"log": {"entries": [
+  {"request": {"url": "https://example.com/"}, "response": {"content": {"mimeType": "text/html", "text": "<html></html>"}}},
+  {"request": {"url": "https://example.com/a.js"}, "response": {"content": {"mimeType": "application/javascript", "text": "a()"}}},
+  {"request": {"url": "https://example.com/b"}, "response": {"content": {"mimeType": "text/html"}}}
+]}}`
+
+	entries, err := readHAR("test.har", []byte(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0].Index != 0 || entries[0].URL != "https://example.com/" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	if _, err = readHAR("test.har", []byte(`{"request": {}}`)); err == nil {
+		t.Error("expected an error for a har entry")
+	}
+}
+
+func TestBatches(t *testing.T) {
+	c := cmd{
+		batchSize:  2,
+		urls:       []string{"a", "b", "c"},
+		urlContent: []*msg.URLContent{{Content: "d"}, {Content: "e"}},
+	}
+
+	batches := c.batches()
+	if len(batches) != 3 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+
+	if len(batches[0].Url) != 2 || len(batches[1].Url) != 1 || len(batches[1].Content) != 1 || len(batches[2].Content) != 1 {
+		t.Errorf("unexpected batches: %v", batches)
+	}
+}
@@ -0,0 +1,239 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// harHeader, harEntry and harLog are the parts of the http archive format
+// (http://www.softwareishard.com/blog/har-12-spec/) needed to build
+// URLContent
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	StartedDateTime string `json:"startedDateTime"`
+	Request         struct {
+		URL string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int         `json:"status"`
+		Headers []harHeader `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harLog struct {
+	Log *struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+func (e *harEntry) urlContent() (*msg.URLContent, error) {
+	content := e.Response.Content.Text
+
+	if e.Response.Content.Encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(content)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding har content")
+		}
+		content = string(data)
+	}
+
+	uc := msg.URLContent{
+		Url:     e.Request.URL,
+		Content: content,
+	}
+
+	for _, h := range e.Response.Headers {
+		// skip http/2 pseudo headers
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+
+		addHeader(&uc, h.Name, h.Value)
+	}
+
+	return &uc, nil
+}
+
+func addHeader(uc *msg.URLContent, name, value string) {
+	if uc.Header == nil {
+		uc.Header = map[string]string{}
+	}
+
+	name = textproto.CanonicalMIMEHeaderKey(name)
+
+	if prev, ok := uc.Header[name]; ok {
+		value = prev + ", " + value
+	}
+
+	uc.Header[name] = value
+}
+
+// parseHeader parses a header given as name=value or name: value
+func parseHeader(s string) (string, string, error) {
+	i := strings.IndexAny(s, ":=")
+	if i <= 0 {
+		return "", "", errors.Errorf("invalid header: %s", s)
+	}
+
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), nil
+}
+
+// parseHeaders parses headers, as name=value, separated by newlines. header
+// names are canonicalized.
+func parseHeaders(s string) (map[string]string, error) {
+	header := map[string]string{}
+
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, value, err := parseHeader(line)
+		if err != nil {
+			return nil, err
+		}
+
+		header[textproto.CanonicalMIMEHeaderKey(name)] = value
+	}
+
+	return header, nil
+}
+
+// parseHAR returns the first entry with content in a har file, or the entry
+// itself if data is a single har entry
+func parseHAR(data []byte) (*msg.URLContent, error) {
+	var har harLog
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, errors.Wrap(err, "error parsing har")
+	}
+
+	if har.Log == nil {
+		var entry harEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, errors.Wrap(err, "error parsing har entry")
+		}
+
+		return entry.urlContent()
+	}
+
+	for _, entry := range har.Log.Entries {
+		if entry.Response.Content.Text != "" {
+			return entry.urlContent()
+		}
+	}
+
+	return nil, errors.New("har has no entries with content")
+}
+
+// headerEnd returns the index of the blank line ending the header block at the
+// start of data, and the length of that line ending
+func headerEnd(data []byte) (int, int) {
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	lf := bytes.Index(data, []byte("\n\n"))
+
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf, 4
+	case lf >= 0:
+		return lf, 2
+	}
+
+	return len(data), 0
+}
+
+// parseHTTPResponse parses the output of curl -i, the status line and headers
+// followed by the body. When curl followed redirects or received interim
+// responses, the headers of each response precede the body and only those of
+// the last are kept.
+func parseHTTPResponse(data []byte) (*msg.URLContent, error) {
+	var uc *msg.URLContent
+
+	for uc == nil || bytes.HasPrefix(data, []byte("HTTP/")) {
+		end, n := headerEnd(data)
+		lines := strings.Split(strings.Replace(string(data[:end]), "\r\n", "\n", -1), "\n")
+		data = data[end+n:]
+
+		status := strings.Fields(lines[0])
+		if len(status) < 2 || !strings.HasPrefix(status[0], "HTTP/") {
+			return nil, errors.Errorf("invalid status line: %q", lines[0])
+		}
+
+		if _, err := strconv.Atoi(status[1]); err != nil {
+			return nil, errors.Errorf("invalid status line: %q", lines[0])
+		}
+
+		uc = &msg.URLContent{}
+
+		var name string
+		for _, line := range lines[1:] {
+			if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && name != "" {
+				// obsolete line folding
+				uc.Header[name] += " " + strings.TrimSpace(line)
+				continue
+			}
+
+			i := strings.Index(line, ":")
+			if i <= 0 {
+				return nil, errors.Errorf("invalid header line: %q", line)
+			}
+
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(line[:i]))
+			addHeader(uc, name, strings.TrimSpace(line[i+1:]))
+		}
+	}
+
+	uc.Content = string(data)
+
+	return uc, nil
+}
+
+// parseResponse parses a saved http response, either a har file or entry, or
+// the output of curl -i
+func parseResponse(data []byte) (*msg.URLContent, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseHAR(data)
+	}
+
+	return parseHTTPResponse(data)
+}
+
+// readFileArg reads name, or stdin if name is -, returning an error if it is
+// larger than max bytes
+func readFileArg(name string, max int64) ([]byte, error) {
+	var r io.Reader = os.Stdin
+
+	if name != "-" {
+		f, err := os.Open(name) // #nosec
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }() // #nosec
+		r = f
+	}
+
+	data, err := readLimit(r, max)
+	if err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+
+	return data, nil
+}
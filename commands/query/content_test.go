@@ -0,0 +1,172 @@
+package query
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHTTPResponse(t *testing.T) {
+	const dump = "HTTP/1.1 301 Moved Permanently\r\n" +
+		"Location: https://example.com/\r\n" +
+		"\r\n" +
+		"HTTP/2 200 \r\n" +
+		"content-type: text/html\r\n" +
+		"set-cookie: a=1\r\n" +
+		"set-cookie: b=2\r\n" +
+		"x-folded: one\r\n" +
+		" two\r\n" +
+		"\r\n" +
+		"<html>\r\n\r\n</html>"
+
+	uc, err := parseResponse([]byte(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Content-Type": "text/html",
+		"Set-Cookie":   "a=1, b=2",
+		"X-Folded":     "one two",
+	}
+
+	if !reflect.DeepEqual(uc.Header, want) {
+		t.Errorf("unexpected headers: %v", uc.Header)
+	}
+
+	if uc.Content != "<html>\r\n\r\n</html>" {
+		t.Errorf("unexpected content: %q", uc.Content)
+	}
+
+	if _, err = parseResponse([]byte("<html></html>")); err == nil {
+		t.Error("expected an error for a response without a status line")
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	const har = `{"log": {"entries": [
+  {"request": {"url": "https://example.com/favicon.ico"}, "response": {"status": 404, "content": {}}},
+  {"request": {"url": "https://example.com/"}, "response": {
+    "status": 200,
+    "headers": [{"name": ":status", "value": "200"}, {"name": "content-type", "value": "text/html"}],
+    "content": {"mimeType": "text/html", "text": "PGh0bWw+PC9odG1sPg==", "encoding": "base64"}
+  }}
+]}}`
+
+	uc, err := parseResponse([]byte(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uc.Url != "https://example.com/" || uc.Content != "<html></html>" {
+		t.Errorf("unexpected content: %v", uc)
+	}
+
+	if !reflect.DeepEqual(uc.Header, map[string]string{"Content-Type": "text/html"}) {
+		t.Errorf("unexpected headers: %v", uc.Header)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		in, name, value string
+	}{
+		{"Accept=text/html", "Accept", "text/html"},
+		{"Content-Type: text/html; charset=utf-8", "Content-Type", "text/html; charset=utf-8"},
+		{"x-a = b=c", "x-a", "b=c"},
+	}
+
+	for _, tt := range tests {
+		name, value, err := parseHeader(tt.in)
+		if err != nil || name != tt.name || value != tt.value {
+			t.Errorf("%q: got %q, %q, %v", tt.in, name, value, err)
+		}
+	}
+
+	if _, _, err := parseHeader("=value"); err == nil {
+		t.Error("expected an error for a header without a name")
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	header, err := parseHeaders("accept=text/html\n\nx-a: b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"Accept": "text/html", "X-A": "b"}; !reflect.DeepEqual(header, want) {
+		t.Errorf("unexpected headers: %v", header)
+	}
+
+	if _, err := parseHeaders("accept=text/html\nnope"); err == nil {
+		t.Error("expected an error for an invalid header")
+	}
+}
+
+func TestSetupContents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }() // #nosec
+
+	har := filepath.Join(dir, "a.har")
+	if err = ioutil.WriteFile(har, []byte(`{"request": {"url": "https://example.com/"}, "response": {"status": 200, "content": {"text": "<p>b</p>"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := cmd{
+		maxContentSize:   1024,
+		contents:         []string{"<p>a</p>"},
+		contentResponses: []string{har},
+		contentURLs:      []string{"a.example", ""},
+		contentHeaders:   []string{"", "x-a=1\nx-b=2"},
+	}
+
+	if err = c.setupContents(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.urlContent) != 2 {
+		t.Fatalf("unexpected content: %v", c.urlContent)
+	}
+
+	if a := c.urlContent[0]; a.Url != "http://a.example" || a.Header != nil {
+		t.Errorf("unexpected content: %v", a)
+	}
+
+	if b := c.urlContent[1]; b.Url != "https://example.com/" || !reflect.DeepEqual(b.Header, map[string]string{"X-A": "1", "X-B": "2"}) {
+		t.Errorf("unexpected content: %v", b)
+	}
+
+	c = cmd{contents: []string{"<p>a</p>"}, contentHeaders: []string{"x-a=1", "x-b=2"}}
+	if err = c.setupContents(); err == nil {
+		t.Error("expected an error for more content-header than content")
+	}
+}
+
+func TestReadFileArg(t *testing.T) {
+	f, err := ioutil.TempFile("", "zapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }() // #nosec
+
+	if _, err = f.WriteString("<html></html>"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := readFileArg(f.Name(), 1024); err != nil || string(data) != "<html></html>" {
+		t.Errorf("unexpected content: %q, %v", data, err)
+	}
+
+	if _, err = readFileArg(f.Name(), 4); err == nil {
+		t.Error("expected an error for a file that is too large")
+	}
+}
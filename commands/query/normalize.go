@@ -0,0 +1,61 @@
+package query
+
+import (
+	"strings"
+
+	"zvelo.io/zapi/internal/zvelo"
+)
+
+// setupURLs normalizes the urls given as arguments and removes duplicates.
+// c.inputs records the urls that were given for each url that is queried.
+func (c *cmd) setupURLs(args []string) error {
+	c.inputs = map[string][]string{}
+
+	for _, raw := range args {
+		if raw == "" {
+			continue
+		}
+
+		u := raw
+
+		if c.noNormalize {
+			if !strings.Contains(u, "://") {
+				u = "http://" + u
+			}
+		} else {
+			var err error
+			if u, err = zvelo.NormalizeURL(raw, c.stripTracking); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := c.inputs[u]; !ok {
+			c.urls = append(c.urls, u)
+		}
+
+		c.inputs[u] = append(c.inputs[u], raw)
+	}
+
+	return nil
+}
+
+// inputsFor returns the urls given as arguments that were normalized to u, or
+// nil if u is the only one and it was changed by no more than adding the
+// default scheme and path. u is the url as it was queried, its key in
+// c.queries, not the url in its result, which zvelo-api may have changed.
+func (c *cmd) inputsFor(u string) []string {
+	inputs := c.inputs[u]
+
+	if len(inputs) == 1 {
+		in := inputs[0]
+		if !strings.Contains(in, "://") {
+			in = "http://" + in
+		}
+
+		if in == u || in+"/" == u {
+			return nil
+		}
+	}
+
+	return inputs
+}
@@ -0,0 +1,39 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestSetupURLs(t *testing.T) {
+	c := cmd{}
+
+	if err := c.setupURLs([]string{"example.com", "HTTP://EXAMPLE.COM:80/#a", "http://example.com/", "example.org"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c.urls, []string{"http://example.com/", "http://example.org/"}) {
+		t.Errorf("unexpected urls: %v", c.urls)
+	}
+
+	if inputs := c.inputsFor("http://example.com/"); len(inputs) != 3 {
+		t.Errorf("unexpected inputs: %v", inputs)
+	}
+
+	if inputs := c.inputsFor("http://example.org/"); inputs != nil {
+		t.Errorf("unexpected inputs: %v", inputs)
+	}
+
+	// inputs are found by the url that was queried, whatever url the result
+	// has
+	c.queries.Add("http://example.com/", time.Now())
+	c.queries.SetReqID("http://example.com/", "a")
+	c.queries.SetResult("a", &msg.QueryResult{RequestId: "a", Url: "http://example.com"})
+
+	if inputs := c.inputsFor(c.queries.Key("a")); len(inputs) != 3 {
+		t.Errorf("unexpected inputs: %v", inputs)
+	}
+}
@@ -0,0 +1,278 @@
+package query
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/zvelo"
+)
+
+var (
+	metaCharsetRe = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.-]+)`)
+	scriptRe      = regexp.MustCompile(`(?is)<script\b[^>]*>.*?</script\s*>`)
+	styleRe       = regexp.MustCompile(`(?is)<style\b[^>]*>.*?</style\s*>`)
+)
+
+// windows1252 maps bytes 0x80-0x9f to the characters they represent in
+// windows-1252. all other bytes are the same as in iso-8859-1. 0 means the
+// byte is undefined.
+var windows1252 = [32]rune{
+	0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+	0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// parseSize parses a number of bytes with an optional k, m or g suffix, as
+// powers of 1024
+func parseSize(s string) (int64, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "b"), "i")
+
+	mult := int64(1)
+
+	if n := len(t); n > 0 {
+		switch t[n-1] {
+		case 'k':
+			mult = 1 << 10
+		case 'm':
+			mult = 1 << 20
+		case 'g':
+			mult = 1 << 30
+		}
+
+		if mult > 1 {
+			t = t[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size: %s", s)
+	}
+
+	return n * mult, nil
+}
+
+// readLimit reads r, returning an error if there are more than max bytes
+func readLimit(r io.Reader, max int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > max {
+		return nil, errors.Errorf("content is larger than the maximum of %d bytes, see --max-content-size", max)
+	}
+
+	return data, nil
+}
+
+// decompress decodes data according to the content encoding, or the file
+// name extension. gzip data is detected even without either.
+func decompress(data []byte, name, encoding string, max int64) ([]byte, error) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+	switch {
+	case encoding == "br" || strings.HasSuffix(name, ".br"):
+		data, err := readLimit(brotli.NewReader(bytes.NewReader(data)), max)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing content")
+		}
+
+		return data, nil
+	case encoding == "gzip" || encoding == "x-gzip" || bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing content")
+		}
+
+		data, err = readLimit(r, max)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decompressing content")
+		}
+
+		return data, nil
+	case encoding == "" || encoding == "identity":
+		return data, nil
+	}
+
+	return nil, errors.Errorf("unsupported content encoding: %s", encoding)
+}
+
+// detectCharset returns the charset of data from its byte order mark, the
+// content type, or a <meta> tag, in that order. If none of those are found,
+// it is utf-8 if data is valid utf-8, or windows-1252 otherwise, as browsers
+// would assume.
+func detectCharset(data []byte, contentType string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xef, 0xbb, 0xbf}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		return strings.ToLower(params["charset"])
+	}
+
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+
+	if m := metaCharsetRe.FindSubmatch(head); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+
+	if utf8.Valid(data) {
+		return "utf-8"
+	}
+
+	return "windows-1252"
+}
+
+// toUTF8 transcodes data from charset to utf-8. utf-8, utf-16 and
+// windows-1252 and the charsets browsers treat as it are supported.
+func toUTF8(data []byte, charset string) (string, error) {
+	switch charset {
+	case "utf-8", "utf8", "unicode-1-1-utf-8":
+		data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+		if !utf8.Valid(data) {
+			return "", errors.New("content is not valid utf-8")
+		}
+		return string(data), nil
+	case "utf-16", "utf-16be", "utf-16le":
+		return fromUTF16(data, charset)
+	case "us-ascii", "ascii", "iso-8859-1", "iso8859-1", "latin1", "l1", "windows-1252", "cp1252", "x-cp1252":
+		// browsers treat all of these as windows-1252, a superset of them all
+		var buf bytes.Buffer
+		for _, b := range data {
+			r := rune(b)
+			if b >= 0x80 && b < 0xa0 && windows1252[b-0x80] != 0 {
+				r = windows1252[b-0x80]
+			}
+			buf.WriteRune(r)
+		}
+		return buf.String(), nil
+	}
+
+	return "", errors.Errorf("unsupported charset: %s", charset)
+}
+
+func fromUTF16(data []byte, charset string) (string, error) {
+	bigEndian := charset == "utf-16be"
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		bigEndian, data = true, data[2:]
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		bigEndian, data = false, data[2:]
+	}
+
+	if len(data)%2 != 0 {
+		return "", errors.New("content is not valid utf-16")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// isBinary reports whether data looks like something other than text
+func isBinary(data []byte) (string, bool) {
+	ct := http.DetectContentType(data)
+
+	if strings.HasPrefix(ct, "text/") || strings.Contains(ct, "xml") || strings.Contains(ct, "json") {
+		return ct, false
+	}
+
+	return ct, true
+}
+
+// stripScripts removes script and style elements from html
+func stripScripts(s string) string {
+	return styleRe.ReplaceAllString(scriptRe.ReplaceAllString(s, ""), "")
+}
+
+// prepareContent decompresses the content, transcodes it to utf-8 and checks
+// that it is text no larger than the maximum size. name is the file the
+// content was read from, if any.
+func (c *cmd) prepareContent(name string, uc *msg.URLContent) error {
+	data := []byte(uc.Content)
+
+	if int64(len(data)) > c.maxContentSize {
+		return errors.Errorf("content is %d bytes, larger than the maximum of %d bytes, see --max-content-size", len(data), c.maxContentSize)
+	}
+
+	contentType := uc.Header["Content-Type"]
+
+	data, err := decompress(data, name, uc.Header["Content-Encoding"], c.maxContentSize)
+	if err != nil {
+		return err
+	}
+
+	if uc.Header != nil {
+		delete(uc.Header, "Content-Encoding")
+		delete(uc.Header, "Content-Length")
+	}
+
+	charset := detectCharset(data, contentType)
+
+	if !strings.HasPrefix(charset, "utf-16") {
+		if ct, binary := isBinary(data); binary {
+			return errors.Errorf("content appears to be binary (%s)", ct)
+		}
+	}
+
+	content, err := toUTF8(data, charset)
+	if err != nil {
+		// zvelo-api can still classify the content from what is left
+		if name != "" {
+			err = errors.Wrap(err, name)
+		}
+
+		zvelo.Errorf("%s, sending it with the invalid characters replaced\n", err)
+		content = strings.ToValidUTF8(string(data), "\ufffd")
+	}
+
+	// the content is now utf-8, whatever it declared itself to be
+	if m := metaCharsetRe.FindStringSubmatchIndex(content); m != nil && m[2] < 1024 {
+		content = content[:m[2]] + "utf-8" + content[m[3]:]
+	}
+
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		params["charset"] = "utf-8"
+		uc.Header["Content-Type"] = mime.FormatMediaType(mediaType, params)
+	}
+
+	if c.stripScripts {
+		content = stripScripts(content)
+	}
+
+	uc.Content = content
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package query
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"100", 100},
+		{"10k", 10 << 10},
+		{"10KB", 10 << 10},
+		{"2MiB", 2 << 20},
+		{"1g", 1 << 30},
+	}
+
+	for _, tt := range tests {
+		if got, err := parseSize(tt.in); err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v", tt.in, got, err)
+		}
+	}
+
+	for _, in := range []string{"", "m", "-1", "1t"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	tests := []struct {
+		data, contentType, want string
+	}{
+		{"\xef\xbb\xbfhi", "text/html; charset=iso-8859-1", "utf-8"},
+		{"\xff\xfeh\x00", "", "utf-16le"},
+		{"<html>", "text/html; charset=Shift_JIS", "shift_jis"},
+		{`<html><head><meta http-equiv="Content-Type" content="text/html; charset=windows-1252">`, "", "windows-1252"},
+		{`<meta charset='ISO-8859-1'>`, "text/html", "iso-8859-1"},
+		{"caf\xc3\xa9", "", "utf-8"},
+		{"caf\xe9", "", "windows-1252"},
+	}
+
+	for _, tt := range tests {
+		if got := detectCharset([]byte(tt.data), tt.contentType); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	tests := []struct {
+		data, charset, want string
+	}{
+		{"caf\xe9 \x80", "iso-8859-1", "café €"},
+		{"\xfe\xff\x00h\x00i", "utf-16", "hi"},
+		{"h\x00i\x00", "utf-16le", "hi"},
+		{"\xef\xbb\xbfhi", "utf-8", "hi"},
+	}
+
+	for _, tt := range tests {
+		if got, err := toUTF8([]byte(tt.data), tt.charset); err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v", tt.data, got, err)
+		}
+	}
+
+	if _, err := toUTF8([]byte("hi"), "ebcdic"); err == nil {
+		t.Error("expected an error for an unsupported charset")
+	}
+}
+
+func TestPrepareContent(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte("<html><head><meta charset=\"latin1\"><script>a()</script></head><body>caf\xe9</body></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := cmd{maxContentSize: 1024, stripScripts: true}
+
+	uc := msg.URLContent{
+		Content: buf.String(),
+		Header: map[string]string{
+			"Content-Encoding": "gzip",
+			"Content-Type":     "text/html; charset=latin1",
+		},
+	}
+
+	if err := c.prepareContent("", &uc); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := `<html><head><meta charset="utf-8"></head><body>café</body></html>`; uc.Content != want {
+		t.Errorf("unexpected content: %q", uc.Content)
+	}
+
+	if _, ok := uc.Header["Content-Encoding"]; ok || uc.Header["Content-Type"] != "text/html; charset=utf-8" {
+		t.Errorf("unexpected headers: %v", uc.Header)
+	}
+
+	c.maxContentSize = 10
+	if err := c.prepareContent("", &msg.URLContent{Content: "more than ten bytes"}); err == nil {
+		t.Error("expected an error for content that is too large")
+	}
+
+	c.maxContentSize = 1024
+	if err := c.prepareContent("", &msg.URLContent{Content: "\x89PNG\r\n\x1a\n\x00\x00"}); err == nil {
+		t.Error("expected an error for binary content")
+	}
+
+	// content in unsupported charsets is sent with the invalid characters
+	// replaced
+	uc = msg.URLContent{
+		Content: "<p>\x82\xa0a</p>",
+		Header:  map[string]string{"Content-Type": "text/html; charset=shift_jis"},
+	}
+
+	if err := c.prepareContent("", &uc); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<p>\ufffda</p>"; uc.Content != want {
+		t.Errorf("unexpected content: %q", uc.Content)
+	}
+}
+
+func TestDecompressBrotli(t *testing.T) {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write([]byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := decompress(buf.Bytes(), "", "br", 1024)
+	if err != nil || string(data) != "<html></html>" {
+		t.Errorf("unexpected content: %q, %v", data, err)
+	}
+
+	if _, err = decompress(buf.Bytes(), "", "br", 4); err == nil {
+		t.Error("expected an error for content that is too large")
+	}
+}
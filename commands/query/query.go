@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,11 +15,11 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/gogo/protobuf/jsonpb"
+	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 
 	"zvelo.io/go-zapi"
 	"zvelo.io/go-zapi/callback"
@@ -29,9 +28,10 @@ import (
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/clients"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/policy"
 	"zvelo.io/zapi/poller"
 	"zvelo.io/zapi/results"
-	"zvelo.io/zapi/tokensourcer"
 )
 
 var jsonMarshaler = jsonpb.Marshaler{OrigName: true}
@@ -41,35 +41,49 @@ func defaultDatasets() []string {
 }
 
 type cmd struct {
-	appName                  string
-	datasets                 []msg.DatasetType
-	datasetStrings           cli.StringSlice
-	debug, trace, rest, json bool
-	insecureSkipVerify       bool
-	skipCache                bool
-	timeout                  time.Duration
-	clients                  clients.Clients
-	poller                   poller.Poller
-	keyGetter                httpsig.KeyGetter
-	callbackURL              string
-	noListen                 bool
-	callbackNoValidate       bool
-	callbackNoKeyCache       bool
-	listen                   string
-	noPoll                   bool
-	noFollowRedirects        bool
-	redirectLimit            int
-	urls                     []string
-	urlContent               []*msg.URLContent
-	mockCategories           cli.StringSlice
-	mockMalicious            cli.StringSlice
-	mockCompleteAfter        time.Duration
-	mockFetchCode            int
-	mockLocation             string
-	mockErrorCode            int
-	mockErrorMessage         string
-	mockContextOpts          []mock.ContextOption
-	contents                 cli.StringSlice
+	opts                   *options.Options
+	datasets               []msg.DatasetType
+	datasetStrings         cli.StringSlice
+	skipCache              bool
+	clients                clients.Clients
+	poller                 poller.Poller
+	policy                 policy.Option
+	keyGetter              httpsig.KeyGetter
+	callbackURL            string
+	noListen               bool
+	callbackNoValidate     bool
+	callbackNoKeyCache     bool
+	listen                 string
+	noPoll                 bool
+	noFollowRedirects      bool
+	redirectLimit          int
+	redirectSameHostOnly   bool
+	redirectAllowDowngrade bool
+	urls                   []string
+	urlContent             []*msg.URLContent
+	mockCategories         cli.StringSlice
+	mockMalicious          cli.StringSlice
+	mockCompleteAfter      time.Duration
+	mockFetchCode          int
+	mockLocation           string
+	mockErrorCode          int
+	mockErrorMessage       string
+	mockContextOpts        []mock.ContextOption
+	contents               cli.StringSlice
+	contentURLs            cli.StringSlice
+	contentHeaders         cli.StringSlice
+	contentResponses       cli.StringSlice
+	harFiles               cli.StringSlice
+	warcFiles              cli.StringSlice
+	batchSize              int
+	archive                map[string][]archiveEntry
+	maxContentSize         int64
+	maxContentSizeStr      string
+	stripScripts           bool
+	noNormalize            bool
+	stripTracking          bool
+	inputs                 map[string][]string
+	statsJSON              string
 
 	queries queries
 }
@@ -78,17 +92,22 @@ type queryData struct {
 	key          string
 	reqID        string
 	redirectFrom *queryData
+	result       *msg.QueryResult
 	done         bool
+	submitted    time.Time
+	polled       []time.Time
+	completed    time.Time
 }
 
 type queries struct {
 	sync.RWMutex
 	internal map[string]*queryData
 	reqs     map[string]*queryData
+	errors   map[string]int
 	wg       sync.WaitGroup
 }
 
-func (q *queries) Add(key string) {
+func (q *queries) Add(key string, submitted time.Time) {
 	q.Lock()
 	defer q.Unlock()
 
@@ -97,7 +116,8 @@ func (q *queries) Add(key string) {
 	}
 
 	q.internal[key] = &queryData{
-		key: key,
+		key:       key,
+		submitted: submitted,
 	}
 
 	q.wg.Add(1)
@@ -138,22 +158,44 @@ func (q *queries) SetRedirect(reqID, fromReqID string) {
 	d.redirectFrom = f
 }
 
-func (q *queries) NumRedirects(reqID string) int {
+func (q *queries) SetResult(reqID string, result *msg.QueryResult) {
+	q.Lock()
+	defer q.Unlock()
+
+	if d, ok := q.reqs[reqID]; ok {
+		d.result = result
+	}
+}
+
+// Chain returns the results of each request in the redirect chain that ended
+// with reqID, starting with the url that was originally queried
+func (q *queries) Chain(reqID string) []*msg.QueryResult {
 	q.RLock()
 	defer q.RUnlock()
 
-	for ret := 0; ; ret++ {
-		d, ok := q.reqs[reqID]
-		if !ok {
-			panic(fmt.Errorf("couldn't count redirect %q", reqID))
-		}
+	var chain []*msg.QueryResult
 
-		if d.redirectFrom == nil {
-			return ret
+	for d := q.reqs[reqID]; d != nil; d = d.redirectFrom {
+		if d.result == nil {
+			return nil
 		}
 
-		reqID = d.redirectFrom.reqID
+		chain = append([]*msg.QueryResult{d.result}, chain...)
 	}
+
+	return chain
+}
+
+// Key returns the url, or url and content, that reqID was queried for
+func (q *queries) Key(reqID string) string {
+	q.RLock()
+	defer q.RUnlock()
+
+	if d, ok := q.reqs[reqID]; ok {
+		return d.key
+	}
+
+	return ""
 }
 
 func (q *queries) Done(reqID string) {
@@ -176,49 +218,15 @@ func (q *queries) Wait() {
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	flags := append(c.clients.Flags(), c.poller.Flags()...)
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	flags = append(flags, c.poller.Flags()...)
+	flags = append(flags, c.policy.Flags()...)
 	return append(flags,
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
 		cli.BoolFlag{
 			Name:        "skip-cache",
 			Usage:       "instruct zvelo-api not to check its cache for results",
 			Destination: &c.skipCache,
 		},
-		cli.BoolFlag{
-			Name:        "trace",
-			EnvVar:      "ZVELO_TRACE",
-			Usage:       "request a trace to be generated for each request",
-			Destination: &c.trace,
-		},
-		cli.BoolFlag{
-			Name:        "rest",
-			EnvVar:      "ZVELO_REST",
-			Usage:       "Use REST instead of gRPC for api requests",
-			Destination: &c.rest,
-		},
-		cli.BoolFlag{
-			Name:        "json",
-			EnvVar:      "ZVELO_JSON",
-			Usage:       "Print raw JSON response",
-			Destination: &c.json,
-		},
-		cli.DurationFlag{
-			Name:        "timeout",
-			EnvVar:      "ZVELO_TIMEOUT",
-			Usage:       "maximum amount of time to wait for results to complete",
-			Value:       15 * time.Minute,
-			Destination: &c.timeout,
-		},
 		cli.StringFlag{
 			Name:        "listen",
 			EnvVar:      "ZVELO_QUERY_LISTEN_ADDRESS",
@@ -269,6 +277,18 @@ func (c *cmd) Flags() []cli.Flag {
 			Value:       10,
 			Destination: &c.redirectLimit,
 		},
+		cli.BoolFlag{
+			Name:        "redirect-same-host-only",
+			EnvVar:      "ZVELO_REDIRECT_SAME_HOST_ONLY",
+			Usage:       "only follow redirects to the same host",
+			Destination: &c.redirectSameHostOnly,
+		},
+		cli.BoolFlag{
+			Name:        "redirect-allow-scheme-downgrade",
+			EnvVar:      "ZVELO_REDIRECT_ALLOW_SCHEME_DOWNGRADE",
+			Usage:       "follow redirects from https to http",
+			Destination: &c.redirectAllowDowngrade,
+		},
 		cli.StringSliceFlag{
 			Name:  "mock-category",
 			Usage: "when querying against the mock server, expect these categories in the categorization response (category id or category short name, may be repeated)",
@@ -311,6 +331,64 @@ func (c *cmd) Flags() []cli.Flag {
 				" (may be repeated)",
 			Value: &c.contents,
 		},
+		cli.StringSliceFlag{
+			Name:  "content-response",
+			Usage: "get datasets for a saved http response, either the output of curl -i or a har file or entry, - reads from stdin. the url and headers of the response are sent with the content (may be repeated)",
+			Value: &c.contentResponses,
+		},
+		cli.StringSliceFlag{
+			Name:  "content-url",
+			Usage: "url the content came from. the first is used for the first --content, the second for the next and so on, followed by each --content-response (may be repeated)",
+			Value: &c.contentURLs,
+		},
+		cli.StringSliceFlag{
+			Name:  "content-header",
+			Usage: "headers, as name=value, sent with the content. the first is used for the first --content, the second for the next and so on, followed by each --content-response. separate multiple headers for one content with newlines (may be repeated)",
+			Value: &c.contentHeaders,
+		},
+		cli.StringFlag{
+			Name:        "max-content-size",
+			Usage:       "maximum size of each content, after decompression, with an optional k, m or g suffix",
+			Value:       "10m",
+			Destination: &c.maxContentSizeStr,
+		},
+		cli.BoolFlag{
+			Name:        "strip-scripts",
+			Usage:       "remove script and style elements from content before sending it",
+			Destination: &c.stripScripts,
+		},
+		cli.StringSliceFlag{
+			Name:  "har",
+			Usage: "get datasets for each html response in a har file, - reads from stdin (may be repeated)",
+			Value: &c.harFiles,
+		},
+		cli.StringSliceFlag{
+			Name:  "warc",
+			Usage: "get datasets for each html response record in a warc file, which may be gzip compressed (may be repeated)",
+			Value: &c.warcFiles,
+		},
+		cli.IntFlag{
+			Name:        "batch-size",
+			Usage:       "maximum number of urls and content in a single query request",
+			Value:       100,
+			Destination: &c.batchSize,
+		},
+		cli.BoolFlag{
+			Name:        "no-normalize",
+			Usage:       "query urls exactly as given instead of lowercasing the host, converting international domain names to punycode and removing default ports and fragments. duplicate urls are still only queried once",
+			Destination: &c.noNormalize,
+		},
+		cli.BoolFlag{
+			Name:        "strip-tracking-params",
+			Usage:       "remove tracking query parameters (utm_*, gclid, fbclid and the like) from urls before querying them",
+			Destination: &c.stripTracking,
+		},
+		cli.StringFlag{
+			Name:        "stats-json",
+			EnvVar:      "ZVELO_QUERY_STATS_JSON",
+			Usage:       "write the timing and latency summary of the requests to this file as json, - writes to stderr so it isn't mixed with the results",
+			Destination: &c.statsJSON,
+		},
 		cli.StringSliceFlag{
 			Name:   "dataset",
 			EnvVar: "ZVELO_DATASETS",
@@ -332,48 +410,26 @@ func availableDS() []string {
 	return ds
 }
 
-func Command(appName string) cli.Command {
-	c := cmd{appName: appName}
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
 
-	tokenSourcer := tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, strings.Fields(zapi.DefaultScopes)...)
-	c.clients = clients.New(tokenSourcer, &c.debug, &c.insecureSkipVerify)
-	c.poller = poller.New(&c.debug, &c.rest, &c.trace, c.clients)
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
+	c.poller = poller.New(opts, c.clients)
 
 	return cli.Command{
 		Name:      "query",
 		Usage:     "query for a URL",
 		ArgsUsage: "url [url...]",
-		Before:    c.setup,
+		Before:    opts.Before(c.setup),
 		Action:    c.action,
 		Flags:     c.Flags(),
 	}
 }
 
 func (c *cmd) setupMock() error {
-	var cats []msg.Category
-	for _, catName := range c.mockCategories {
-		cat := msg.ParseCategory(catName)
-		if cat == msg.UNKNOWN_CATEGORY {
-			return errors.Errorf("invalid category: %s", catName)
-		}
-		cats = append(cats, cat)
-	}
-
-	if len(cats) > 0 {
-		c.mockContextOpts = append(c.mockContextOpts, mock.WithCategories(cats...))
-	}
-
-	var malcats []msg.Category
-	for _, catName := range c.mockMalicious {
-		cat := msg.ParseCategory(catName)
-		if cat == msg.UNKNOWN_CATEGORY {
-			return errors.Errorf("invalid category: %s", catName)
-		}
-		malcats = append(malcats, cat)
-	}
-
-	if len(c.mockMalicious) > 0 {
-		c.mockContextOpts = append(c.mockContextOpts, mock.WithMalicious(malcats...))
+	var err error
+	if c.mockContextOpts, err = poller.MockOptions(c.mockCategories, c.mockMalicious); err != nil {
+		return err
 	}
 
 	if c.mockCompleteAfter > 0 {
@@ -396,6 +452,9 @@ func (c *cmd) setupMock() error {
 }
 
 func (c *cmd) setupContents() error {
+	// names are the files that each content was read from, for errors
+	var names []string
+
 	for _, content := range c.contents {
 		if len(content) == 0 || content == "@" {
 			continue
@@ -406,24 +465,14 @@ func (c *cmd) setupContents() error {
 			c.urlContent = append(c.urlContent, &msg.URLContent{
 				Content: content,
 			})
+			names = append(names, "")
 			continue
 		}
 
-		// '@-' means we need to read from stdin
-		if content == "@-" {
-			var buf bytes.Buffer
-			if _, err := buf.ReadFrom(os.Stdin); err != nil {
-				return err
-			}
-			c.urlContent = append(c.urlContent, &msg.URLContent{
-				Content: buf.String(),
-			})
-			continue
-		}
-
-		// anything else beginning with '@' implies that the value following the
-		// '@' is a filename that should be read for the content
-		data, err := ioutil.ReadFile(content[1:])
+		// '@-' means we need to read from stdin, anything else beginning with
+		// '@' implies that the value following the '@' is a filename that
+		// should be read for the content
+		data, err := readFileArg(content[1:], c.maxContentSize)
 		if err != nil {
 			return err
 		}
@@ -431,6 +480,69 @@ func (c *cmd) setupContents() error {
 		c.urlContent = append(c.urlContent, &msg.URLContent{
 			Content: string(data),
 		})
+		names = append(names, content[1:])
+	}
+
+	for _, name := range c.contentResponses {
+		data, err := readFileArg(name, c.maxContentSize)
+		if err != nil {
+			return err
+		}
+
+		uc, err := parseResponse(data)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", name)
+		}
+
+		c.urlContent = append(c.urlContent, uc)
+		names = append(names, name)
+	}
+
+	if len(c.contentURLs) > len(c.urlContent) {
+		return errors.New("more content-url than content given")
+	}
+
+	for i, u := range c.contentURLs {
+		if u == "" {
+			// keep the url of a --content-response
+			continue
+		}
+
+		if !strings.Contains(u, "://") {
+			u = "http://" + u
+		}
+
+		c.urlContent[i].Url = u
+	}
+
+	if len(c.contentHeaders) > len(c.urlContent) {
+		return errors.New("more content-header than content given")
+	}
+
+	for i, h := range c.contentHeaders {
+		header, err := parseHeaders(h)
+		if err != nil {
+			return err
+		}
+
+		uc := c.urlContent[i]
+
+		for name, value := range header {
+			if uc.Header == nil {
+				uc.Header = map[string]string{}
+			}
+
+			uc.Header[name] = value
+		}
+	}
+
+	for i, uc := range c.urlContent {
+		if err := c.prepareContent(names[i], uc); err != nil {
+			if names[i] != "" {
+				return errors.Wrap(err, names[i])
+			}
+			return err
+		}
 	}
 
 	return nil
@@ -461,6 +573,14 @@ func (c *cmd) setupDatasets() error {
 }
 
 func (c *cmd) setup(cli *cli.Context) error {
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
+	if err := c.policy.Setup(); err != nil {
+		return err
+	}
+
 	if err := c.setupDatasets(); err != nil {
 		return err
 	}
@@ -468,7 +588,7 @@ func (c *cmd) setup(cli *cli.Context) error {
 	var keyCache callback.KeyCache
 
 	if !c.callbackNoKeyCache {
-		keyCache = callback.FileKeyCache(c.appName)
+		keyCache = callback.FileKeyCache(c.opts.AppName())
 	}
 
 	if !c.callbackNoValidate {
@@ -483,24 +603,32 @@ func (c *cmd) setup(cli *cli.Context) error {
 		return err
 	}
 
-	if len(cli.Args()) == 0 && len(c.contents) == 0 {
+	if len(cli.Args()) == 0 && len(c.contents) == 0 && len(c.contentResponses) == 0 && len(c.harFiles) == 0 && len(c.warcFiles) == 0 {
 		return errors.New("at least one url or content is required")
 	}
 
-	if err := c.setupContents(); err != nil {
+	if c.batchSize < 1 {
+		return errors.New("batch-size must be at least 1")
+	}
+
+	size, err := parseSize(c.maxContentSizeStr)
+	if err != nil {
 		return err
 	}
+	c.maxContentSize = size
 
-	for _, u := range cli.Args() {
-		if u == "" {
-			continue
-		}
+	if err := c.setupContents(); err != nil {
+		return err
+	}
 
-		if !strings.Contains(u, "://") {
-			u = "http://" + u
+	if len(c.harFiles) > 0 || len(c.warcFiles) > 0 {
+		if err := c.setupArchives(); err != nil {
+			return err
 		}
+	}
 
-		c.urls = append(c.urls, u)
+	if err := c.setupURLs(cli.Args()); err != nil {
+		return err
 	}
 
 	if c.callbackURL != "" {
@@ -513,15 +641,24 @@ func (c *cmd) setup(cli *cli.Context) error {
 }
 
 func (c *cmd) action(_ *cli.Context) error {
-	ctx := mock.QueryContext(context.Background(), c.mockContextOpts...)
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	ctx := mock.QueryContext(c.opts.Context(), c.mockContextOpts...)
+	ctx, cancel := c.opts.WithTimeout(ctx)
 	defer cancel()
 
+	// the span of the whole query → poll → complete cycle, every api call is
+	// recorded as a descendant of it
+	span, ctx := opentracing.StartSpanFromContext(ctx, "zapi query",
+		opentracing.Tag{Key: "zvelo.transport", Value: c.poller.Transport()},
+		opentracing.Tag{Key: "zvelo.urls", Value: len(c.urls)},
+		opentracing.Tag{Key: "zvelo.contents", Value: len(c.urlContent)},
+	)
+	defer span.Finish()
+
 	if c.callbackURL != "" && !c.noListen {
 		go func() {
 			debugWriter := io.Writer(nil)
 
-			if c.debug {
+			if c.opts.Debug {
 				debugWriter = os.Stderr
 			}
 
@@ -533,24 +670,32 @@ func (c *cmd) action(_ *cli.Context) error {
 		}()
 	}
 
-	queryReq := msg.QueryRequests{
-		Callback: c.callbackURL,
-		Dataset:  c.datasets,
-		Url:      c.urls,
-		Content:  c.urlContent,
-	}
+	requests := poller.Requests{}
 
-	requests, err := c.query(ctx, &queryReq)
-	if err != nil {
-		return err
+	for _, queryReq := range c.batches() {
+		reqs, err := c.query(ctx, queryReq)
+		if err != nil {
+			if c.tracked() {
+				if serr := c.printStats(); serr != nil {
+					zvelo.Errorf("%s\n", serr)
+				}
+			}
+
+			return err
+		}
+
+		for reqID, u := range reqs {
+			requests[reqID] = u
+		}
 	}
 
 	if !c.noPoll {
-		// c satisfies the poll.Handler interface due to the Result() method
+		// c satisfies the poll.ErrorHandler interface due to the Result() and
+		// PollError() methods
 		go c.poller.Poll(ctx, requests, c)
 	}
 
-	if !c.noPoll || (c.callbackURL != "" && !c.noListen) {
+	if c.tracked() {
 		// wait for the wait group to complete or the context to timeout
 		go func() {
 			c.queries.Wait()
@@ -558,78 +703,87 @@ func (c *cmd) action(_ *cli.Context) error {
 		}()
 
 		<-ctx.Done()
+
+		if err := c.printStats(); err != nil {
+			return err
+		}
+
 		return ctx.Err()
 	}
 
 	return nil
 }
 
-func (c *cmd) query(ctx context.Context, queryReq *msg.QueryRequests) (poller.Requests, error) {
-	var replies *msg.QueryReplies
-	var err error
+// tracked reports whether results are waited for, either by polling or from
+// callbacks, and so whether the requests are tracked in c.queries
+func (c *cmd) tracked() bool {
+	return !c.noPoll || (c.callbackURL != "" && !c.noListen)
+}
 
-	if c.rest {
-		replies, err = c.queryREST(ctx, queryReq)
-	} else {
-		replies, err = c.queryGRPC(ctx, queryReq)
-	}
+// printStats prints the summary of the requests made, and writes it to
+// --stats-json if given
+func (c *cmd) printStats() error {
+	s := c.queries.Stats(time.Now())
+	s.Print()
 
-	if err != nil {
-		return nil, errors.Wrap(err, "query error")
+	if c.statsJSON == "" {
+		return nil
 	}
 
-	if !c.noPoll || (c.callbackURL != "" && !c.noListen) {
-		for _, u := range queryReq.Url {
-			c.queries.Add(u)
-		}
+	return s.WriteJSON(c.statsJSON)
+}
 
-		for _, u := range queryReq.Content {
-			c.queries.Add(u.Url + u.Content)
-		}
-	}
+// batches splits the urls and content into query requests of at most
+// batchSize each
+func (c *cmd) batches() []*msg.QueryRequests {
+	var ret []*msg.QueryRequests
 
-	return c.queryComplete(ctx, queryReq, replies), nil
-}
+	urls, content := c.urls, c.urlContent
 
-func (c *cmd) queryREST(ctx context.Context, queryReq *msg.QueryRequests) (*msg.QueryReplies, error) {
-	var opts []zapi.CallOption
+	for len(urls) > 0 || len(content) > 0 {
+		req := msg.QueryRequests{
+			Callback: c.callbackURL,
+			Dataset:  c.datasets,
+		}
 
-	if c.trace {
-		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
-	}
+		n := c.batchSize
+		if n > len(urls) {
+			n = len(urls)
+		}
+		req.Url, urls = urls[:n], urls[n:]
 
-	if c.skipCache {
-		ctx = metadata.AppendToOutgoingContext(ctx, "zvelo-no-cache", "1")
-	}
+		n = c.batchSize - n
+		if n > len(content) {
+			n = len(content)
+		}
+		req.Content, content = content[:n], content[n:]
 
-	replies, err := c.clients.RESTv1().Query(ctx, queryReq, opts...)
-	if err != nil {
-		return nil, err
+		ret = append(ret, &req)
 	}
 
-	return replies, nil
+	return ret
 }
 
-func (c *cmd) queryGRPC(ctx context.Context, queryReq *msg.QueryRequests) (*msg.QueryReplies, error) {
-	if c.trace {
-		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
-	}
-
-	if c.skipCache {
-		ctx = metadata.AppendToOutgoingContext(ctx, "zvelo-no-cache", "1")
-	}
+func (c *cmd) query(ctx context.Context, queryReq *msg.QueryRequests) (poller.Requests, error) {
+	submitted := time.Now()
 
-	client, err := c.clients.GRPCv1(ctx)
+	replies, err := c.poller.Query(ctx, queryReq, c.skipCache)
 	if err != nil {
-		return nil, err
+		c.queries.Error(errors.Cause(err))
+		return nil, errors.Wrap(err, "query error")
 	}
 
-	replies, err := client.Query(ctx, queryReq)
-	if err != nil {
-		return nil, err
+	if c.tracked() {
+		for _, u := range queryReq.Url {
+			c.queries.Add(u, submitted)
+		}
+
+		for _, u := range queryReq.Content {
+			c.queries.Add(u.Url+u.Content, submitted)
+		}
 	}
 
-	return replies, nil
+	return c.queryComplete(ctx, queryReq, replies), nil
 }
 
 func (c *cmd) queryComplete(ctx context.Context, queryReq *msg.QueryRequests, reply *msg.QueryReplies) poller.Requests {
@@ -643,7 +797,7 @@ func (c *cmd) queryComplete(ctx context.Context, queryReq *msg.QueryRequests, re
 		printf := zvelo.PrintfFunc(color.FgCyan, os.Stderr)
 		printf(buf.String())
 
-		if c.json {
+		if c.opts.JSON {
 			if err := jsonMarshaler.Marshal(os.Stdout, reply); err != nil {
 				zvelo.Errorf("marshal error: %s\n", err)
 			}
@@ -686,11 +840,11 @@ func (c *cmd) queryComplete(ctx context.Context, queryReq *msg.QueryRequests, re
 
 		ret[reply.RequestId] = u
 
-		if !c.noPoll || (c.callbackURL != "" && !c.noListen) {
+		if c.tracked() {
 			c.queries.SetReqID(key, reply.RequestId)
 		}
 
-		if !c.json {
+		if !c.opts.JSON {
 			fmt.Fprintf(w, "%s:\t%s\n", u, reply.RequestId) // #nosec
 		}
 	}
@@ -698,6 +852,13 @@ func (c *cmd) queryComplete(ctx context.Context, queryReq *msg.QueryRequests, re
 	return ret
 }
 
+// PollError records that polling for reqID failed. The poller doesn't poll
+// for it again.
+func (c *cmd) PollError(_ context.Context, reqID string, err error) {
+	c.queries.Error(errors.Cause(err))
+	c.queries.Done(reqID)
+}
+
 func (c *cmd) Result(ctx context.Context, result *msg.QueryResult) poller.Requests {
 	complete := zvelo.IsComplete(result)
 
@@ -705,56 +866,154 @@ func (c *cmd) Result(ctx context.Context, result *msg.QueryResult) poller.Reques
 		defer c.queries.Done(result.RequestId)
 	}
 
+	c.queries.Polled(result.RequestId, time.Now(), result, complete)
+
+	if complete {
+		c.queries.SetResult(result.RequestId, result)
+	}
+
 	qs := result.QueryStatus
 
 	isRedirect := qs.Location != "" && qs.FetchCode >= 300 && qs.FetchCode < 400
 
-	if c.debug || c.noFollowRedirects || (complete && !isRedirect) {
-		results.Print(result, c.json)
+	var requests poller.Requests
+	var stopped string
+
+	if complete && isRedirect && !c.noFollowRedirects {
+		requests, stopped = c.redirect(ctx, result)
 	}
 
-	if c.noFollowRedirects || !complete {
-		return nil
+	switch {
+	case complete && len(requests) == 0:
+		// this is the end of the chain, if there was one
+		c.printResult(result, stopped)
+	case c.opts.Debug || c.noFollowRedirects:
+		results.Print(result, c.opts.JSON)
 	}
 
-	if !isRedirect {
-		return nil
+	return requests
+}
+
+// printResult prints the result that ended a redirect chain. stopped is why
+// the redirect it contains wasn't followed, if it does.
+func (c *cmd) printResult(result *msg.QueryResult, stopped string) {
+	if entries := c.archive[c.queries.Key(result.RequestId)]; len(entries) > 0 {
+		c.printArchiveResult(result, entries)
+		return
+	}
+
+	chain := c.queries.Chain(result.RequestId)
+	if len(chain) == 0 {
+		chain = []*msg.QueryResult{result}
+	}
+
+	results.Chain{
+		Results:  chain,
+		Stopped:  stopped,
+		Inputs:   c.inputsFor(c.queries.Key(chain[0].RequestId)),
+		Decision: c.policy.Decide(result),
+	}.Print(c.opts.JSON)
+}
+
+// resolveRedirect resolves location, which may be a relative reference, against
+// the url that was redirected
+func resolveRedirect(base, location string) (*url.URL, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid url %s", base)
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(location))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid redirect location %s", location)
+	}
+
+	u := b.ResolveReference(ref)
+
+	// the fragment is never sent to the server
+	u.Fragment = ""
+
+	return u, nil
+}
+
+// checkRedirect returns why the redirect from the last result in chain to
+// location should not be followed, or "" if it should be
+func (c *cmd) checkRedirect(chain []*msg.QueryResult, location *url.URL) string {
+	from, err := url.Parse(chain[len(chain)-1].Url)
+	if err != nil {
+		return err.Error()
 	}
 
-	location := qs.Location
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return fmt.Sprintf("unsupported scheme %q", location.Scheme)
+	}
 
-	if location[0] == '/' {
-		// make relative redirects absolute
-		if u, err := url.Parse(result.Url); err == nil {
-			u.Path = location
-			location = u.String()
+	for _, result := range chain {
+		if result.Url == location.String() {
+			if result == chain[len(chain)-1] {
+				return "redirect to the same url"
+			}
+
+			return fmt.Sprintf("redirect loop back to %s", result.Url)
 		}
 	}
 
-	if location == result.Url {
-		zvelo.Errorf("\nnot redirecting to the same url\n")
-		return nil
+	if len(chain) >= c.redirectLimit {
+		return fmt.Sprintf("too many redirects (%d)", len(chain))
 	}
 
-	num := c.queries.NumRedirects(result.RequestId) + 1
+	if c.redirectSameHostOnly && !strings.EqualFold(from.Hostname(), location.Hostname()) {
+		return fmt.Sprintf("redirect to a different host (%s), see --redirect-same-host-only", location.Hostname())
+	}
 
-	if num >= c.redirectLimit {
-		zvelo.Errorf("\ntoo many redirects (%d): %s → %s\n", num, result.Url, location)
-		return nil
+	if from.Scheme == "https" && location.Scheme == "http" && !c.redirectAllowDowngrade {
+		return "redirect from https to http, see --redirect-allow-scheme-downgrade"
+	}
+
+	return ""
+}
+
+// redirect queries the location result was redirected to and returns the new
+// request. If the redirect isn't followed, it returns why not instead.
+func (c *cmd) redirect(ctx context.Context, result *msg.QueryResult) (poller.Requests, string) {
+	chain := c.queries.Chain(result.RequestId)
+	if len(chain) == 0 {
+		chain = []*msg.QueryResult{result}
+	}
+
+	location, err := resolveRedirect(result.Url, result.QueryStatus.Location)
+	if err != nil {
+		return nil, err.Error()
+	}
+
+	if !c.noNormalize {
+		n, err := zvelo.NormalizeURL(location.String(), c.stripTracking)
+		if err != nil {
+			return nil, err.Error()
+		}
+
+		if location, err = url.Parse(n); err != nil {
+			return nil, err.Error()
+		}
+	}
+
+	if reason := c.checkRedirect(chain, location); reason != "" {
+		zvelo.Errorf("\nnot following redirect: %s → %s: %s\n", result.Url, location, reason)
+		return nil, reason
 	}
 
 	printf := zvelo.PrintfFunc(color.FgYellow, os.Stderr)
-	printf("\nfollowing redirect #%d: %s → %s\n", num, result.Url, location)
+	printf("\nfollowing redirect #%d: %s → %s\n", len(chain), result.Url, location)
 
 	requests, err := c.query(ctx, &msg.QueryRequests{
 		Callback: c.callbackURL,
 		Dataset:  c.datasets,
-		Url:      []string{location},
+		Url:      []string{location.String()},
 	})
 
 	if err != nil {
 		zvelo.Errorf("query error: %s\n", err)
-		return nil
+		return nil, fmt.Sprintf("query error: %s", err)
 	}
 
 	// There should be at most 1 reqID
@@ -762,7 +1021,7 @@ func (c *cmd) Result(ctx context.Context, result *msg.QueryResult) poller.Reques
 		c.queries.SetRedirect(reqID, result.RequestId)
 	}
 
-	return requests
+	return requests, ""
 }
 
 func (c *cmd) callbackHandler(ctx context.Context) callback.Handler {
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestChain(t *testing.T) {
+	var q queries
+
+	for i, u := range []string{"http://a.com", "http://b.com", "http://c.com"} {
+		id := string('1' + rune(i))
+
+		q.Add(u, time.Now())
+		q.SetReqID(u, id)
+
+		if i > 0 {
+			q.SetRedirect(id, string('0'+rune(i)))
+		}
+	}
+
+	if chain := q.Chain("3"); chain != nil {
+		t.Errorf("expected no chain before the results are complete: %v", chain)
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		q.SetResult(id, &msg.QueryResult{RequestId: id})
+	}
+
+	chain := q.Chain("3")
+	if len(chain) != 3 || chain[0].RequestId != "1" || chain[2].RequestId != "3" {
+		t.Errorf("unexpected chain: %v", chain)
+	}
+}
+
+func TestResolveRedirect(t *testing.T) {
+	tests := []struct {
+		base, location, want string
+	}{
+		{"http://a.com/b/c?d=e", "/f?g=h", "http://a.com/f?g=h"},
+		{"http://a.com/b/c/d", "../e", "http://a.com/b/e"},
+		{"http://a.com/b/c", "?q=1", "http://a.com/b/c?q=1"},
+		{"https://a.com/b", "//c.com/d", "https://c.com/d"},
+		{"http://a.com/b", "https://c.com/d#frag", "https://c.com/d"},
+	}
+
+	for _, tt := range tests {
+		u, err := resolveRedirect(tt.base, tt.location)
+		if err != nil {
+			t.Errorf("%s → %s: %s", tt.base, tt.location, err)
+			continue
+		}
+
+		if u.String() != tt.want {
+			t.Errorf("%s → %s: got %s, want %s", tt.base, tt.location, u, tt.want)
+		}
+	}
+}
+
+func TestCheckRedirect(t *testing.T) {
+	chain := func(urls ...string) []*msg.QueryResult {
+		var ret []*msg.QueryResult
+		for _, u := range urls {
+			ret = append(ret, &msg.QueryResult{Url: u})
+		}
+		return ret
+	}
+
+	tests := []struct {
+		cmd      *cmd
+		chain    []*msg.QueryResult
+		location string
+		allowed  bool
+	}{
+		{&cmd{redirectLimit: 10}, chain("http://a.com/"), "http://b.com/", true},
+		{&cmd{redirectLimit: 10}, chain("http://a.com/"), "http://a.com/", false},
+		{&cmd{redirectLimit: 10}, chain("http://a.com/", "http://b.com/"), "http://a.com/", false},
+		{&cmd{redirectLimit: 2}, chain("http://a.com/", "http://b.com/"), "http://c.com/", false},
+		{&cmd{redirectLimit: 10}, chain("http://a.com/"), "ftp://a.com/", false},
+		{&cmd{redirectLimit: 10, redirectSameHostOnly: true}, chain("http://a.com/"), "http://b.com/", false},
+		{&cmd{redirectLimit: 10, redirectSameHostOnly: true}, chain("http://a.com/"), "https://A.com/x", true},
+		{&cmd{redirectLimit: 10}, chain("https://a.com/"), "http://a.com/", false},
+		{&cmd{redirectLimit: 10, redirectAllowDowngrade: true}, chain("https://a.com/"), "http://a.com/", true},
+	}
+
+	for _, tt := range tests {
+		location, err := url.Parse(tt.location)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reason := tt.cmd.checkRedirect(tt.chain, location)
+		if (reason == "") != tt.allowed {
+			t.Errorf("%s → %s: unexpected result %q", tt.chain[len(tt.chain)-1].Url, tt.location, reason)
+		}
+	}
+}
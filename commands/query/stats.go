@@ -0,0 +1,289 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/results"
+)
+
+// durationStats summarizes a set of durations, in milliseconds when encoded
+// as json
+type durationStats struct {
+	P50 time.Duration `json:"-"`
+	P90 time.Duration `json:"-"`
+	P99 time.Duration `json:"-"`
+	Max time.Duration `json:"-"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (s durationStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{
+		"p50": ms(s.P50),
+		"p90": ms(s.P90),
+		"p99": ms(s.P99),
+		"max": ms(s.Max),
+	})
+}
+
+// percentile returns the nearest rank percentile p of sorted
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+
+	return sorted[i]
+}
+
+func newDurationStats(d []time.Duration) durationStats {
+	sorted := append([]time.Duration{}, d...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return durationStats{
+		P50: percentile(sorted, 50),
+		P90: percentile(sorted, 90),
+		P99: percentile(sorted, 99),
+		Max: percentile(sorted, 100),
+	}
+}
+
+// stats summarizes the requests made by a query run
+type stats struct {
+	Start            time.Time      `json:"start"`
+	Elapsed          time.Duration  `json:"-"`
+	Requests         int            `json:"requests"`
+	Completed        int            `json:"completed"`
+	Incomplete       int            `json:"incomplete"`
+	Redirects        int            `json:"redirects"`
+	Polls            int            `json:"polls"`
+	MaxPolls         int            `json:"max_polls"`
+	TimeToComplete   durationStats  `json:"time_to_complete_ms"`
+	TimeToFirstPoll  durationStats  `json:"time_to_first_poll_ms"`
+	TimeBetweenPolls durationStats  `json:"time_between_polls_ms"`
+	Errors           map[string]int `json:"errors,omitempty"`
+}
+
+// Throughput is the number of requests completed per second
+func (s stats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(s.Completed) / s.Elapsed.Seconds()
+}
+
+func (s stats) MarshalJSON() ([]byte, error) {
+	type alias stats
+
+	return json.Marshal(struct {
+		alias
+		ElapsedMS  float64 `json:"elapsed_ms"`
+		Throughput float64 `json:"throughput_per_second"`
+	}{alias(s), ms(s.Elapsed), s.Throughput()})
+}
+
+func round(d time.Duration) time.Duration {
+	if d >= 10*time.Millisecond {
+		return d.Round(time.Millisecond)
+	}
+
+	return d.Round(time.Microsecond)
+}
+
+func (s durationStats) String() string {
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s", round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+}
+
+// Print prints a summary of s to stderr
+func (s stats) Print() {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', 0)
+
+	fmt.Fprintf(w, "\nRequests:\t%d (%d complete, %d incomplete)\n", s.Requests, s.Completed, s.Incomplete) // #nosec
+	fmt.Fprintf(w, "Redirects Followed:\t%d\n", s.Redirects)                                                // #nosec
+
+	if s.Requests > 0 {
+		fmt.Fprintf(w, "Polls:\t%d (%.1f per request, max %d)\n", s.Polls, float64(s.Polls)/float64(s.Requests), s.MaxPolls) // #nosec
+	}
+
+	if s.Completed > 0 {
+		fmt.Fprintf(w, "Time to Complete:\t%s\n", s.TimeToComplete)    // #nosec
+		fmt.Fprintf(w, "Time to First Poll:\t%s\n", s.TimeToFirstPoll) // #nosec
+	}
+
+	if s.Polls > s.Requests {
+		fmt.Fprintf(w, "Time Between Polls:\t%s\n", s.TimeBetweenPolls) // #nosec
+	}
+
+	if len(s.Errors) > 0 {
+		var errs []string
+		for code, n := range s.Errors {
+			errs = append(errs, fmt.Sprintf("%s %d", code, n))
+		}
+		sort.Strings(errs)
+
+		fmt.Fprintf(w, "Errors:\t%s\n", strings.Join(errs, ", ")) // #nosec
+	}
+
+	fmt.Fprintf(w, "Throughput:\t%.1f requests/s over %s\n", s.Throughput(), round(s.Elapsed)) // #nosec
+
+	_ = w.Flush() // #nosec
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stderr)
+	printf(buf.String())
+}
+
+// WriteJSON writes s as json to the file name, or stderr if name is -.
+// results are written to stdout, so the stats are kept out of them.
+func (s stats) WriteJSON(name string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	data = append(data, '\n')
+
+	if name == "-" {
+		_, err = os.Stderr.Write(data)
+		return err
+	}
+
+	return errors.Wrap(ioutil.WriteFile(name, data, 0644), "error writing stats") // #nosec
+}
+
+// errorCode returns the name of the grpc code of err
+func errorCode(err error) string {
+	return status.Code(err).String()
+}
+
+// Polled records that a result was received for reqID at t
+func (q *queries) Polled(reqID string, t time.Time, result *msg.QueryResult, complete bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	d, ok := q.reqs[reqID]
+	if !ok {
+		return
+	}
+
+	d.polled = append(d.polled, t)
+
+	if !complete || !d.completed.IsZero() {
+		return
+	}
+
+	d.completed = t
+
+	if code := results.ErrorCode(result); code != "" {
+		q.addError(code)
+	}
+}
+
+// Error records an error making a request
+func (q *queries) Error(err error) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.addError(errorCode(err))
+}
+
+// addError must be called with q locked
+func (q *queries) addError(code string) {
+	if q.errors == nil {
+		q.errors = map[string]int{}
+	}
+
+	q.errors[code]++
+}
+
+// Stats summarizes the requests made up until now
+func (q *queries) Stats(now time.Time) stats {
+	q.RLock()
+	defer q.RUnlock()
+
+	s := stats{
+		Errors: map[string]int{},
+	}
+
+	for code, n := range q.errors {
+		s.Errors[code] = n
+	}
+
+	var toComplete, toFirstPoll, betweenPolls []time.Duration
+	var last time.Time
+
+	for _, d := range q.internal {
+		s.Requests++
+		s.Polls += len(d.polled)
+
+		if len(d.polled) > s.MaxPolls {
+			s.MaxPolls = len(d.polled)
+		}
+
+		for i := 1; i < len(d.polled); i++ {
+			betweenPolls = append(betweenPolls, d.polled[i].Sub(d.polled[i-1]))
+		}
+
+		if d.redirectFrom != nil {
+			s.Redirects++
+		}
+
+		if s.Start.IsZero() || d.submitted.Before(s.Start) {
+			s.Start = d.submitted
+		}
+
+		if len(d.polled) > 0 {
+			toFirstPoll = append(toFirstPoll, d.polled[0].Sub(d.submitted))
+		}
+
+		if d.completed.IsZero() {
+			s.Incomplete++
+			continue
+		}
+
+		s.Completed++
+		toComplete = append(toComplete, d.completed.Sub(d.submitted))
+
+		if d.completed.After(last) {
+			last = d.completed
+		}
+	}
+
+	if s.Incomplete == 0 && !last.IsZero() {
+		// don't include the time spent shutting down
+		now = last
+	}
+
+	if !s.Start.IsZero() {
+		s.Elapsed = now.Sub(s.Start)
+	}
+
+	s.TimeToComplete = newDurationStats(toComplete)
+	s.TimeToFirstPoll = newDurationStats(toFirstPoll)
+	s.TimeBetweenPolls = newDurationStats(betweenPolls)
+
+	return s
+}
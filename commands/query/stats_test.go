@@ -0,0 +1,96 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestPercentile(t *testing.T) {
+	var d []time.Duration
+	for i := 1; i <= 100; i++ {
+		d = append(d, time.Duration(i)*time.Millisecond)
+	}
+
+	s := newDurationStats(d)
+	if s.P50 != 50*time.Millisecond || s.P90 != 90*time.Millisecond || s.P99 != 99*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	if s = newDurationStats([]time.Duration{time.Second}); s.P50 != time.Second || s.P99 != time.Second {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	if s = newDurationStats(nil); s.Max != 0 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	var q queries
+
+	start := time.Unix(1500000000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	for i, u := range []string{"http://a.com", "http://b.com", "http://c.com"} {
+		q.Add(u, start)
+		q.SetReqID(u, string('1'+rune(i)))
+	}
+
+	q.Add("http://d.com", at(300))
+	q.SetReqID("http://d.com", "4")
+	q.SetRedirect("4", "1")
+
+	complete := &msg.QueryResult{QueryStatus: &msg.QueryStatus{Complete: true}}
+	failed := &msg.QueryResult{QueryStatus: &msg.QueryStatus{Error: &msg.Status{Code: int32(codes.NotFound)}}}
+
+	q.Polled("1", at(100), &msg.QueryResult{}, false)
+	q.Polled("1", at(300), complete, true)
+	q.Polled("2", at(100), failed, true)
+	q.Polled("3", at(100), &msg.QueryResult{}, false)
+	q.Polled("4", at(400), complete, true)
+	q.Error(status.Error(codes.Unavailable, "unavailable"))
+	q.Error(errors.New("unknown"))
+
+	s := q.Stats(at(1000))
+
+	if s.Requests != 4 || s.Completed != 3 || s.Incomplete != 1 || s.Redirects != 1 || s.Polls != 5 || s.MaxPolls != 2 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+
+	if s.TimeToComplete.P50 != 100*time.Millisecond || s.TimeToComplete.Max != 300*time.Millisecond {
+		t.Errorf("unexpected time to complete: %+v", s.TimeToComplete)
+	}
+
+	if s.TimeBetweenPolls.Max != 200*time.Millisecond {
+		t.Errorf("unexpected time between polls: %+v", s.TimeBetweenPolls)
+	}
+
+	if s.Elapsed != time.Second || s.Throughput() != 3 {
+		t.Errorf("unexpected throughput: %f over %s", s.Throughput(), s.Elapsed)
+	}
+
+	if s.Errors["NotFound"] != 1 || s.Errors["Unavailable"] != 1 || s.Errors["Unknown"] != 1 {
+		t.Errorf("unexpected errors: %v", s.Errors)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out map[string]interface{}
+	if err = json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out["elapsed_ms"] != float64(1000) || out["time_to_complete_ms"].(map[string]interface{})["max"] != float64(300) {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
@@ -11,32 +11,23 @@ import (
 	"zvelo.io/httpsig"
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/policy"
 	"zvelo.io/zapi/results"
 )
 
 type cmd struct {
-	appName            string
+	opts               *options.Options
 	listen             string
-	debug, json        bool
 	callbackNoValidate bool
 	callbackNoKeyCache bool
 	keyGetter          httpsig.KeyGetter
+	policy             policy.Option
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	return []cli.Flag{
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "json",
-			EnvVar:      "ZVELO_JSON",
-			Usage:       "Print raw JSON response",
-			Destination: &c.json,
-		},
+	flags := append(c.opts.Flags(options.FlagDebug, options.FlagJSON), c.policy.Flags()...)
+	return append(flags,
 		cli.StringFlag{
 			Name:        "listen",
 			EnvVar:      "ZVELO_RECEIVER_LISTEN_ADDRESS",
@@ -56,26 +47,30 @@ func (c *cmd) Flags() []cli.Flag {
 			Usage:       "do not cache public keys when validating http signatures in callbacks",
 			Destination: &c.callbackNoKeyCache,
 		},
-	}
+	)
 }
 
-func Command(appName string) cli.Command {
-	c := cmd{appName: appName}
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
 
 	return cli.Command{
 		Name:   "receiver",
 		Usage:  "listen for callbacks",
-		Before: c.setup,
+		Before: opts.Before(c.setup),
 		Action: c.action,
 		Flags:  c.Flags(),
 	}
 }
 
 func (c *cmd) setup(cli *cli.Context) error {
+	if err := c.policy.Setup(); err != nil {
+		return err
+	}
+
 	var keyCache callback.KeyCache
 
 	if !c.callbackNoKeyCache {
-		keyCache = callback.FileKeyCache(c.appName)
+		keyCache = callback.FileKeyCache(c.opts.AppName())
 	}
 
 	if !c.callbackNoValidate {
@@ -88,7 +83,7 @@ func (c *cmd) setup(cli *cli.Context) error {
 func (c *cmd) action(_ *cli.Context) error {
 	debugWriter := io.Writer(nil)
 
-	if c.debug {
+	if c.opts.Debug {
 		debugWriter = os.Stderr
 	}
 
@@ -104,8 +99,10 @@ func (c *cmd) callbackHandler() callback.Handler {
 	return callback.HandlerFunc(func(w http.ResponseWriter, _ *http.Request, result *msg.QueryResult) {
 		w.WriteHeader(http.StatusOK)
 
-		if c.debug || zvelo.IsComplete(result) {
-			results.Print(result, c.json)
+		if zvelo.IsComplete(result) {
+			results.PrintDecision(result, c.policy.Decide(result), c.opts.JSON)
+		} else if c.opts.Debug {
+			results.Print(result, c.opts.JSON)
 		}
 	})
 }
@@ -0,0 +1,311 @@
+package report
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/results"
+)
+
+// The report formats
+const (
+	formatHTML     = "html"
+	formatMarkdown = "markdown"
+)
+
+var funcMap = template.FuncMap{
+	"pct": func(f float64) string {
+		return fmt.Sprintf("%.1f%%", f)
+	},
+	"join": func(cats []msg.Category) string {
+		s := make([]string, len(cats))
+		for i, cat := range cats {
+			s[i] = cat.String()
+		}
+		return strings.Join(s, ", ")
+	},
+	"md": func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	},
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC1123)
+	},
+}
+
+var htmlTpl = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap(funcMap)).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <title>{{.Title}}</title>
+  <style>
+    body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+    h1 { border-bottom: 2px solid #ddd; padding-bottom: .3em; }
+    h2 { margin-top: 2em; }
+    table { border-collapse: collapse; width: 100%; }
+    th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #eee; }
+    td.n { text-align: right; font-variant-numeric: tabular-nums; white-space: nowrap; }
+    td.bar { width: 30%; }
+    td.bar div { background: #4a90d9; height: 1em; }
+    .malicious td.bar div { background: #d9534f; }
+    .meta { color: #666; }
+  </style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{time .Generated}} from {{range $i, $f := .Files}}{{if $i}}, {{end}}{{$f}}{{end}}</p>
+
+<h2>Summary</h2>
+<table>
+  <tr><td>URLs</td><td class="n">{{.URLs}}</td></tr>
+  <tr><td>Complete</td><td class="n">{{.Complete}}</td></tr>
+  <tr><td>Incomplete</td><td class="n">{{.Incomplete}}</td></tr>
+  <tr><td>Errors</td><td class="n">{{.Errors}}</td></tr>
+  <tr><td>Categorized</td><td class="n">{{.Categorized}}</td></tr>
+  <tr><td>Uncategorized</td><td class="n">{{.Uncategorized}}</td></tr>
+  <tr><td>Malicious</td><td class="n">{{.Malicious}}</td></tr>
+  <tr><td>Clean</td><td class="n">{{.Clean}}</td></tr>
+</table>
+{{if .Categories}}
+<h2>Categories</h2>
+<table>
+  <tr><th>Category</th><th>Description</th><th>URLs</th><th>%</th><th></th></tr>
+{{- range .Categories}}
+  <tr><td>{{.Name}}</td><td>{{.Description}}</td><td class="n">{{.Count}}</td><td class="n">{{pct .Percent}}</td><td class="bar"><div style="width: {{pct .Percent}}"></div></td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- if .MaliciousURLs}}
+<h2>Malicious URLs</h2>
+<table>
+  <tr><th>URL</th><th>Categories</th></tr>
+{{- range .MaliciousURLs}}
+  <tr><td>{{.URL}}</td><td>{{join .Categories}}</td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- if .ErrorCodes}}
+<h2>Errors</h2>
+<table class="malicious">
+  <tr><th>Code</th><th>URLs</th><th>%</th><th></th></tr>
+{{- range .ErrorCodes}}
+  <tr><td>{{.Name}}</td><td class="n">{{.Count}}</td><td class="n">{{pct .Percent}}</td><td class="bar"><div style="width: {{pct .Percent}}"></div></td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- if .FetchCodes}}
+<h2>Fetch Codes</h2>
+<table>
+  <tr><th>HTTP Status</th><th>URLs</th><th>%</th><th></th></tr>
+{{- range .FetchCodes}}
+  <tr><td>{{.Name}}</td><td class="n">{{.Count}}</td><td class="n">{{pct .Percent}}</td><td class="bar"><div style="width: {{pct .Percent}}"></div></td></tr>
+{{- end}}
+</table>
+{{end}}
+{{- if .Domains}}
+<h2>Top Domains</h2>
+<table>
+  <tr><th>Domain</th><th>URLs</th><th>%</th><th></th></tr>
+{{- range .Domains}}
+  <tr><td>{{.Name}}</td><td class="n">{{.Count}}</td><td class="n">{{pct .Percent}}</td><td class="bar"><div style="width: {{pct .Percent}}"></div></td></tr>
+{{- end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+var markdownTpl = template.Must(template.New("markdown").Funcs(funcMap).Parse(`# {{md .Title}}
+
+Generated {{time .Generated}} from {{range $i, $f := .Files}}{{if $i}}, {{end}}{{md $f}}{{end}}
+
+## Summary
+
+| | |
+|---|---:|
+| URLs | {{.URLs}} |
+| Complete | {{.Complete}} |
+| Incomplete | {{.Incomplete}} |
+| Errors | {{.Errors}} |
+| Categorized | {{.Categorized}} |
+| Uncategorized | {{.Uncategorized}} |
+| Malicious | {{.Malicious}} |
+| Clean | {{.Clean}} |
+{{if .Categories}}
+## Categories
+
+| Category | Description | URLs | % |
+|---|---|---:|---:|
+{{- range .Categories}}
+| {{.Name}} | {{md .Description}} | {{.Count}} | {{pct .Percent}} |
+{{- end}}
+{{end}}
+{{- if .MaliciousURLs}}
+## Malicious URLs
+
+| URL | Categories |
+|---|---|
+{{- range .MaliciousURLs}}
+| {{md .URL}} | {{join .Categories}} |
+{{- end}}
+{{end}}
+{{- if .ErrorCodes}}
+## Errors
+
+| Code | URLs | % |
+|---|---:|---:|
+{{- range .ErrorCodes}}
+| {{.Name}} | {{.Count}} | {{pct .Percent}} |
+{{- end}}
+{{end}}
+{{- if .FetchCodes}}
+## Fetch Codes
+
+| HTTP Status | URLs | % |
+|---|---:|---:|
+{{- range .FetchCodes}}
+| {{.Name}} | {{.Count}} | {{pct .Percent}} |
+{{- end}}
+{{end}}
+{{- if .Domains}}
+## Top Domains
+
+| Domain | URLs | % |
+|---|---:|---:|
+{{- range .Domains}}
+| {{md .Name}} | {{.Count}} | {{pct .Percent}} |
+{{- end}}
+{{end -}}
+`))
+
+type cmd struct {
+	opts       *options.Options
+	format     string
+	output     string
+	title      string
+	topDomains int
+	files      []string
+}
+
+func (c *cmd) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "format",
+			Usage:       "report format, html or markdown (default: from the extension of output, or markdown)",
+			Destination: &c.format,
+		},
+		cli.StringFlag{
+			Name:        "output",
+			Usage:       "file to write the report to (default: stdout)",
+			Destination: &c.output,
+		},
+		cli.StringFlag{
+			Name:        "title",
+			Usage:       "title of the report",
+			Value:       "zveloAPI Results Report",
+			Destination: &c.title,
+		},
+		cli.IntFlag{
+			Name:        "top-domains",
+			Usage:       "number of domains to list, 0 lists every domain",
+			Value:       20,
+			Destination: &c.topDomains,
+		},
+	}
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+
+	return cli.Command{
+		Name:      "report",
+		Usage:     "generate an html or markdown report from results saved with --json by query, stream or receiver",
+		ArgsUsage: "RESULTS.jsonl...",
+		Before:    opts.Before(c.setup),
+		Action:    c.action,
+		Flags:     c.Flags(),
+	}
+}
+
+func (c *cmd) setup(cli *cli.Context) error {
+	c.files = cli.Args()
+
+	if len(c.files) == 0 {
+		return errors.New("at least one results file is required, - reads from stdin")
+	}
+
+	if c.format == "" {
+		c.format = formatMarkdown
+
+		switch strings.ToLower(filepath.Ext(c.output)) {
+		case ".html", ".htm":
+			c.format = formatHTML
+		}
+	}
+
+	switch c.format {
+	case formatHTML, formatMarkdown:
+	case "md":
+		c.format = formatMarkdown
+	default:
+		return errors.Errorf("invalid format: %s", c.format)
+	}
+
+	if c.topDomains < 0 {
+		return errors.New("top-domains can't be negative")
+	}
+
+	return nil
+}
+
+func (c *cmd) write(w io.Writer, s summary) error {
+	if c.format == formatHTML {
+		return htmlTpl.Execute(w, s)
+	}
+
+	return markdownTpl.Execute(w, s)
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	var saved []results.Saved
+
+	for _, name := range c.files {
+		s, err := results.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		saved = append(saved, s...)
+	}
+
+	s := summarize(results.Latest(saved), c.topDomains)
+	s.Title = c.title
+	s.Generated = time.Now()
+	s.Files = c.files
+
+	if c.output == "" {
+		return c.write(os.Stdout, s)
+	}
+
+	f, err := os.Create(c.output)
+	if err != nil {
+		return err
+	}
+
+	if err = c.write(f, s); err != nil {
+		_ = f.Close() // #nosec
+		return errors.Wrap(err, "error writing report")
+	}
+
+	return f.Close()
+}
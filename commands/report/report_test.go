@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"zvelo.io/zapi/results"
+)
+
+// savedResults are results as saved by query --json
+const savedResults = `{"request_id":"a","url":"http://example.com/a","response_dataset":{"categorization":{"value":["NEWS_4","SPORTS_4"]},"malicious":{}},"query_status":{"complete":true,"fetch_code":200}}
+{"request_id":"b","url":"http://www.example.com/b","response_dataset":{"categorization":{"value":["NEWS_4"]},"malicious":{}},"query_status":{"complete":true,"fetch_code":200}}
+{"request_id":"c","url":"http://example.org/|<script>","response_dataset":{"categorization":{},"malicious":{"category":["MAL_4"]}},"query_status":{"complete":true,"fetch_code":404}}
+{"request_id":"d","url":"http://example.net/","response_dataset":{"categorization":{},"malicious":{}},"query_status":{"complete":true,"error":{"code":5}}}
+{"request_id":"e","url":"http://example.net/pending","query_status":{}}
+`
+
+func TestDomain(t *testing.T) {
+	for u, expected := range map[string]string{
+		"http://www.Example.com:8080/a": "example.com",
+		"example.org/b":                 "example.org",
+		"https://[::1]/":                "::1",
+		"http://":                       "",
+	} {
+		if d := domain(u); d != expected {
+			t.Errorf("%s: expected %q, got %q", u, expected, d)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	saved, err := results.Read(strings.NewReader(savedResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := summarize(results.Latest(saved), 2)
+
+	if s.URLs != 5 || s.Complete != 4 || s.Incomplete != 1 || s.Errors != 1 ||
+		s.Categorized != 2 || s.Uncategorized != 1 || s.Malicious != 1 || s.Clean != 2 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+
+	if len(s.Categories) != 2 || s.Categories[0].Name != "NEWS_4" || s.Categories[0].Percent != 100 || s.Categories[1].Percent != 50 {
+		t.Errorf("unexpected categories: %+v", s.Categories)
+	}
+
+	if len(s.ErrorCodes) != 1 || s.ErrorCodes[0].Name != "NotFound" {
+		t.Errorf("unexpected errors: %+v", s.ErrorCodes)
+	}
+
+	if len(s.FetchCodes) != 2 || s.FetchCodes[0].Name != "200" || s.FetchCodes[0].Count != 2 || s.FetchCodes[1].Name != "404" {
+		t.Errorf("unexpected fetch codes: %+v", s.FetchCodes)
+	}
+
+	if len(s.Domains) != 2 || s.Domains[0].Name != "example.com" || s.Domains[0].Count != 2 || s.Domains[1].Name != "example.net" {
+		t.Errorf("unexpected domains: %+v", s.Domains)
+	}
+
+	if len(s.MaliciousURLs) != 1 || s.MaliciousURLs[0].URL != "http://example.org/|<script>" {
+		t.Errorf("unexpected malicious urls: %+v", s.MaliciousURLs)
+	}
+
+	var buf bytes.Buffer
+
+	c := cmd{format: formatMarkdown}
+	if err := c.write(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"| NEWS_4 | News, Portal & Search - Other | 2 | 100.0% |",
+		`| http://example.org/\|<script> | MAL_4 |`,
+		"| NotFound | 1 | 100.0% |",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("markdown is missing %q:\n%s", line, buf.String())
+		}
+	}
+
+	buf.Reset()
+
+	c.format = formatHTML
+	if err := c.write(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(buf.String(), "<script>") || !strings.Contains(buf.String(), `<div style="width: 50.0%">`) {
+		t.Errorf("unexpected html:\n%s", buf.String())
+	}
+}
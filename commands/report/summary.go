@@ -0,0 +1,212 @@
+package report
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/results"
+)
+
+// count is a row of one of the tables in the report
+type count struct {
+	Name        string
+	Description string
+	Count       int
+	Percent     float64
+}
+
+// maliciousURL is a url with a MALICIOUS verdict
+type maliciousURL struct {
+	URL        string
+	Categories []msg.Category
+}
+
+// summary is everything in a report
+type summary struct {
+	Title         string
+	Generated     time.Time
+	Files         []string
+	URLs          int
+	Complete      int
+	Incomplete    int
+	Errors        int
+	Categorized   int
+	Uncategorized int
+	Malicious     int
+	Clean         int
+	Categories    []count
+	MaliciousURLs []maliciousURL
+	ErrorCodes    []count
+	FetchCodes    []count
+	Domains       []count
+	TopDomains    int
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(n) / float64(total)
+}
+
+// counts returns the rows of a table of counts out of total, sorted by count
+// and then name
+func counts(m map[string]int, total int) []count {
+	ret := make([]count, 0, len(m))
+
+	for name, n := range m {
+		ret = append(ret, count{
+			Name:    name,
+			Count:   n,
+			Percent: percent(n, total),
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// domain returns the host of u without the port or a leading www.
+func domain(u string) string {
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+
+	p, err := url.Parse(u)
+	if err != nil || p.Hostname() == "" {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(p.Hostname()), "www.")
+}
+
+// summarize computes the report of the latest result of each url
+func summarize(latest map[string]*msg.QueryResult, topDomains int) summary {
+	s := summary{
+		URLs:       len(latest),
+		TopDomains: topDomains,
+	}
+
+	urls := make([]string, 0, len(latest))
+	for u := range latest {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	cats := map[msg.Category]int{}
+	errs := map[string]int{}
+	fetchCodes := map[int32]int{}
+	domains := map[string]int{}
+
+	for _, u := range urls {
+		result := latest[u]
+
+		if d := domain(u); d != "" {
+			domains[d]++
+		}
+
+		if !zvelo.IsComplete(result) {
+			s.Incomplete++
+			continue
+		}
+
+		s.Complete++
+
+		if code := results.ErrorCode(result); code != "" {
+			s.Errors++
+			errs[code]++
+			continue
+		}
+
+		if result.QueryStatus.FetchCode != 0 {
+			fetchCodes[result.QueryStatus.FetchCode]++
+		}
+
+		ds := result.ResponseDataset
+
+		switch results.Verdict(ds) {
+		case results.VerdictMalicious:
+			s.Malicious++
+			s.MaliciousURLs = append(s.MaliciousURLs, maliciousURL{
+				URL:        u,
+				Categories: ds.Malicious.Category,
+			})
+		case results.VerdictClean:
+			s.Clean++
+		}
+
+		if ds == nil || ds.Categorization == nil || ds.Categorization.Error != nil {
+			continue
+		}
+
+		if len(ds.Categorization.Value) == 0 {
+			s.Uncategorized++
+			continue
+		}
+
+		s.Categorized++
+
+		for _, cat := range ds.Categorization.Value {
+			cats[cat]++
+		}
+	}
+
+	for cat, n := range cats {
+		s.Categories = append(s.Categories, count{
+			Name:        cat.String(),
+			Description: cat.Long(),
+			Count:       n,
+			Percent:     percent(n, s.Categorized),
+		})
+	}
+
+	sort.Slice(s.Categories, func(i, j int) bool {
+		if s.Categories[i].Count != s.Categories[j].Count {
+			return s.Categories[i].Count > s.Categories[j].Count
+		}
+
+		return s.Categories[i].Name < s.Categories[j].Name
+	})
+
+	s.ErrorCodes = counts(errs, s.Errors)
+
+	// fetch codes are in the order of the codes rather than by count
+	var fetched int
+	for _, n := range fetchCodes {
+		fetched += n
+	}
+
+	for code, n := range fetchCodes {
+		s.FetchCodes = append(s.FetchCodes, count{
+			Name:    strconv.Itoa(int(code)),
+			Count:   n,
+			Percent: percent(n, fetched),
+		})
+	}
+
+	sort.Slice(s.FetchCodes, func(i, j int) bool {
+		a, _ := strconv.Atoi(s.FetchCodes[i].Name)
+		b, _ := strconv.Atoi(s.FetchCodes[j].Name)
+		return a < b
+	})
+
+	s.Domains = counts(domains, s.URLs)
+	if topDomains > 0 && len(s.Domains) > topDomains {
+		s.Domains = s.Domains[:topDomains]
+	}
+
+	return s
+}
@@ -0,0 +1,59 @@
+package serve
+
+import (
+	"context"
+	"sync"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// call is a lookup that is in progress or has completed
+type call struct {
+	done   chan struct{}
+	result *msg.QueryResult
+	err    error
+}
+
+// group coalesces concurrent lookups with the same key so that only one query
+// is made for them
+type group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do calls fn, unless a call for key is already in progress, and waits for
+// its result. fn is not canceled if ctx is done, since other lookups may be
+// waiting for it, but do returns ctx.Err() without waiting. shared is true if
+// the result came from a call made for another lookup.
+func (g *group) do(ctx context.Context, key string, fn func() (*msg.QueryResult, error)) (result *msg.QueryResult, shared bool, err error) {
+	g.mu.Lock()
+
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+
+	c, shared := g.calls[key]
+	if !shared {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+
+		go func() {
+			c.result, c.err = fn()
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+
+			close(c.done)
+		}()
+	}
+
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result, shared, c.err
+	case <-ctx.Done():
+		return nil, shared, ctx.Err()
+	}
+}
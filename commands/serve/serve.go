@@ -0,0 +1,335 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	zapi "zvelo.io/go-zapi"
+	"zvelo.io/msg/mock"
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/msg/status"
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/poller"
+)
+
+var jsonMarshaler = jsonpb.Marshaler{OrigName: true}
+
+// the timeouts of the http server, lookups are only GET requests so reading
+// them should never take long
+const (
+	readTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+	idleTimeout  = 2 * time.Minute
+)
+
+// errTimeout is returned when a result isn't complete before the lookup
+// timeout
+var errTimeout = errors.New("timed out waiting for the result to complete")
+
+func defaultDatasets() []string {
+	return []string{msg.CATEGORIZATION.String()}
+}
+
+type cmd struct {
+	opts            *options.Options
+	clients         clients.Clients
+	poller          poller.Poller
+	listen          string
+	lookupTimeout   time.Duration
+	skipCache       bool
+	datasetStrings  cli.StringSlice
+	datasets        []msg.DatasetType
+	mockCategories  cli.StringSlice
+	mockMalicious   cli.StringSlice
+	mockContextOpts []mock.ContextOption
+	lookups         group
+}
+
+func (c *cmd) Flags() []cli.Flag {
+	// lookups have their own timeout and are always returned as json
+	flags := c.opts.Flags(
+		options.FlagDebug,
+		options.FlagInsecureSkipVerify,
+		options.FlagTrace,
+		options.FlagRest,
+		options.FlagTraceFile,
+		options.FlagTraceEndpoint,
+	)
+	flags = append(flags, c.clients.Flags()...)
+	flags = append(flags, c.poller.Flags()...)
+
+	return append(flags,
+		cli.StringFlag{
+			Name:        "listen",
+			EnvVar:      "ZVELO_SERVE_LISTEN_ADDRESS",
+			Usage:       "address and port to listen for lookups",
+			Value:       ":8080",
+			Destination: &c.listen,
+		},
+		cli.DurationFlag{
+			Name:        "lookup-timeout",
+			EnvVar:      "ZVELO_SERVE_LOOKUP_TIMEOUT",
+			Usage:       "maximum amount of time to wait for the result of a lookup to complete",
+			Value:       30 * time.Second,
+			Destination: &c.lookupTimeout,
+		},
+		cli.BoolFlag{
+			Name:        "skip-cache",
+			Usage:       "instruct zvelo-api not to check its cache for results",
+			Destination: &c.skipCache,
+		},
+		cli.StringSliceFlag{
+			Name:  "dataset",
+			Usage: "list of datasets to retrieve for lookups that don't request any, may be repeated (default: " + strings.Join(defaultDatasets(), ", ") + ")",
+			Value: &c.datasetStrings,
+		},
+		cli.StringSliceFlag{
+			Name:  "mock-category",
+			Usage: "when serving against the mock server, expect these categories in the categorization response (category id or category short name, may be repeated)",
+			Value: &c.mockCategories,
+		},
+		cli.StringSliceFlag{
+			Name:  "mock-malicious-category",
+			Usage: "when serving against the mock server, expect this category in the malicious response and for the verdict to be MALICIOUS (category id or category short name, may be repeated)",
+			Value: &c.mockMalicious,
+		},
+	)
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
+	c.poller = poller.New(opts, c.clients)
+
+	return cli.Command{
+		Name:   "serve",
+		Usage:  "serve lookups of urls over plain http, GET /lookup?url=URL&dataset=DATASET returns the complete result as json",
+		Before: opts.Before(c.setup),
+		Action: c.action,
+		Flags:  c.Flags(),
+	}
+}
+
+func (c *cmd) setup(_ *cli.Context) error {
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
+	if c.lookupTimeout <= 0 {
+		return errors.New("lookup-timeout must be greater than 0")
+	}
+
+	if len(c.datasetStrings) == 0 {
+		c.datasetStrings = defaultDatasets()
+	}
+
+	var err error
+	if c.datasets, err = parseDatasets(c.datasetStrings); err != nil {
+		return err
+	}
+
+	c.mockContextOpts, err = poller.MockOptions(c.mockCategories, c.mockMalicious)
+	return err
+}
+
+// parseDatasets parses dataset names, which may also be comma separated
+func parseDatasets(names []string) ([]msg.DatasetType, error) {
+	var datasets []msg.DatasetType
+	seen := map[msg.DatasetType]bool{}
+
+	for _, name := range names {
+		for _, name := range strings.Split(name, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+
+			dst, err := msg.NewDatasetType(name)
+			if err != nil {
+				return nil, errors.Errorf("invalid dataset type: %s", name)
+			}
+
+			if !seen[dst] {
+				seen[dst] = true
+				datasets = append(datasets, dst)
+			}
+		}
+	}
+
+	sort.Slice(datasets, func(i, j int) bool { return datasets[i] < datasets[j] })
+
+	return datasets, nil
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", c.handleLookup)
+
+	srv := http.Server{
+		Addr:              c.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		// lookups can take up to the lookup timeout before anything is written
+		WriteTimeout: c.lookupTimeout + writeTimeout,
+		IdleTimeout:  idleTimeout,
+	}
+
+	fmt.Fprintf(os.Stderr, "listening for lookups at %s\n", c.listen) // #nosec
+
+	return srv.ListenAndServe()
+}
+
+// lookupRequest is a url to look up and the datasets to retrieve for it
+type lookupRequest struct {
+	url      string
+	datasets []msg.DatasetType
+}
+
+// key identifies lookups that can share a result
+func (l lookupRequest) key() string {
+	names := make([]string, len(l.datasets))
+	for i, dst := range l.datasets {
+		names[i] = dst.String()
+	}
+
+	return l.url + " " + strings.Join(names, ",")
+}
+
+func (c *cmd) parseLookup(r *http.Request) (lookupRequest, error) {
+	q := r.URL.Query()
+
+	u := strings.TrimSpace(q.Get("url"))
+	if u == "" {
+		return lookupRequest{}, errors.New("url is required")
+	}
+
+	// lookups of the same url written differently share a result
+	u, err := zvelo.NormalizeURL(u, false)
+	if err != nil {
+		return lookupRequest{}, err
+	}
+
+	datasets, err := parseDatasets(q["dataset"])
+	if err != nil {
+		return lookupRequest{}, err
+	}
+
+	if len(datasets) == 0 {
+		datasets = c.datasets
+	}
+
+	return lookupRequest{url: u, datasets: datasets}, nil
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(struct { // #nosec
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+func (c *cmd) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	l, err := c.parseLookup(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	start := time.Now()
+
+	result, shared, err := c.lookups.do(r.Context(), l.key(), func() (*msg.QueryResult, error) {
+		return c.lookup(l)
+	})
+
+	if c.opts.Debug {
+		fmt.Fprintf(os.Stderr, "lookup %s (shared: %t) took %s\n", l.key(), shared, time.Since(start)) // #nosec
+	}
+
+	switch {
+	case err == nil:
+	case err == errTimeout:
+		writeError(w, http.StatusGatewayTimeout, err)
+		return
+	case r.Context().Err() != nil:
+		// the client went away
+		return
+	default:
+		zvelo.Errorf("lookup error (%s): %s\n", l.url, err)
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := jsonMarshaler.Marshal(w, result); err != nil {
+		zvelo.Errorf("marshal error: %s\n", err)
+	}
+	fmt.Fprintln(w) // #nosec
+}
+
+// lookup queries for the url and polls until its result is complete or the
+// lookup timeout elapses
+func (c *cmd) lookup(l lookupRequest) (*msg.QueryResult, error) {
+	ctx := mock.QueryContext(context.Background(), c.mockContextOpts...)
+	ctx, cancel := context.WithTimeout(ctx, c.lookupTimeout)
+	defer cancel()
+
+	replies, err := c.poller.Query(ctx, &msg.QueryRequests{
+		Url:     []string{l.url},
+		Dataset: l.datasets,
+	}, c.skipCache)
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, errTimeout
+		}
+
+		return nil, errors.Wrap(err, "query error")
+	}
+
+	if len(replies.Reply) == 0 {
+		return nil, errors.New("query error: no reply")
+	}
+
+	reply := replies.Reply[0]
+
+	if err = status.ErrorProto(reply.Error); err != nil {
+		return nil, errors.Wrap(err, "query error")
+	}
+
+	var last *msg.QueryResult
+
+	c.poller.Poll(ctx, poller.Requests{reply.RequestId: l.url}, poller.HandlerFunc(func(_ context.Context, result *msg.QueryResult) poller.Requests {
+		last = result
+		return nil
+	}))
+
+	switch {
+	case last != nil && (zvelo.IsComplete(last) || c.poller.Once()):
+		return last, nil
+	case ctx.Err() != nil:
+		return nil, errTimeout
+	}
+
+	return nil, errors.Errorf("error polling for %s", reply.RequestId)
+}
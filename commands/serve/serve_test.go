@@ -0,0 +1,126 @@
+package serve
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestGroup(t *testing.T) {
+	var g group
+	var calls int32
+
+	release := make(chan struct{})
+
+	fn := func() (*msg.QueryResult, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &msg.QueryResult{RequestId: "a"}, nil
+	}
+
+	const n = 5
+
+	var wg sync.WaitGroup
+	var shared int32
+
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+
+			result, s, err := g.do(context.Background(), "key", fn)
+			if err != nil || result.RequestId != "a" {
+				t.Errorf("unexpected result: %v, %v", result, err)
+			}
+
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+
+	// wait for every lookup to be waiting on the same call
+	for {
+		g.mu.Lock()
+		c := g.calls["key"]
+		g.mu.Unlock()
+
+		if c != nil && atomic.LoadInt32(&calls) == 1 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || shared != n-1 {
+		t.Errorf("expected 1 call shared by %d lookups, got %d calls shared by %d", n-1, calls, shared)
+	}
+
+	// the call is forgotten once it completes
+	expected := errors.New("error")
+	if _, s, err := g.do(context.Background(), "key", func() (*msg.QueryResult, error) { return nil, expected }); err != expected || s {
+		t.Errorf("expected a new call, got %v (shared: %t)", err, s)
+	}
+}
+
+func TestGroupCanceled(t *testing.T) {
+	var g group
+
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := g.do(ctx, "key", func() (*msg.QueryResult, error) {
+		<-release
+		return nil, nil
+	})
+
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestParseLookup(t *testing.T) {
+	c := cmd{datasets: []msg.DatasetType{msg.CATEGORIZATION}}
+
+	for target, expected := range map[string]string{
+		"/lookup?url=example.com":                                       "http://example.com/ CATEGORIZATION",
+		"/lookup?url=HTTP://Example.COM:80/%23a":                        "http://example.com/ CATEGORIZATION",
+		"/lookup?url=https://example.com/a&dataset=malicious":           "https://example.com/a MALICIOUS",
+		"/lookup?url=example.com&dataset=malicious,categorization":      "http://example.com/ CATEGORIZATION,MALICIOUS",
+		"/lookup?url=example.com&dataset=Malicious&dataset=MALICIOUS,,": "http://example.com/ MALICIOUS",
+	} {
+		l, err := c.parseLookup(httptest.NewRequest("GET", target, nil))
+		if err != nil {
+			t.Errorf("%s: %s", target, err)
+			continue
+		}
+
+		if key := l.key(); key != expected {
+			t.Errorf("%s: expected %q, got %q", target, expected, key)
+		}
+	}
+
+	for _, target := range []string{
+		"/lookup",
+		"/lookup?url=%20",
+		"/lookup?url=http://",
+		"/lookup?url=example.com&dataset=nope",
+	} {
+		if _, err := c.parseLookup(httptest.NewRequest("GET", target, nil)); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
@@ -5,59 +5,43 @@ import (
 	"io"
 
 	"github.com/urfave/cli"
+	"google.golang.org/grpc/metadata"
+
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/policy"
 	"zvelo.io/zapi/results"
-	"zvelo.io/zapi/tokensourcer"
 )
 
 type cmd struct {
-	debug, rest, json  bool
-	insecureSkipVerify bool
-	clients            clients.Clients
+	opts    *options.Options
+	clients clients.Clients
+	policy  policy.Option
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	return append(c.clients.Flags(),
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
-		cli.BoolFlag{
-			Name:        "rest",
-			EnvVar:      "ZVELO_REST",
-			Usage:       "Use REST instead of gRPC for api requests",
-			Destination: &c.rest,
-		},
-		cli.BoolFlag{
-			Name:        "json",
-			EnvVar:      "ZVELO_JSON",
-			Usage:       "Print raw JSON response",
-			Destination: &c.json,
-		},
-	)
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	return append(flags, c.policy.Flags()...)
 }
 
-func Command(appName string) cli.Command {
-	var c cmd
-	tokenSourcer := tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, "zvelo.stream")
-	c.clients = clients.New(tokenSourcer, &c.debug, &c.insecureSkipVerify)
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients("zvelo.stream")
 
 	return cli.Command{
 		Name:   "stream",
 		Usage:  "stream results from zveloAPI",
+		Before: opts.Before(c.setup),
 		Action: c.action,
 		Flags:  c.Flags(),
 	}
 }
 
+func (c *cmd) setup(_ *cli.Context) error {
+	return c.policy.Setup()
+}
+
 type streamClient interface {
 	Recv() (*msg.QueryResult, error)
 }
@@ -65,7 +49,7 @@ type streamClient interface {
 type constructor func(context.Context) (streamClient, error)
 
 func (c *cmd) action(_ *cli.Context) error {
-	if c.rest {
+	if c.opts.Rest {
 		return c.handle(c.streamREST)
 	}
 
@@ -88,6 +72,18 @@ func (c *cmd) streamREST(ctx context.Context) (streamClient, error) {
 func (c *cmd) handle(client constructor) error {
 	ctx := context.Background()
 
+	// streams are long lived, so only stop after the timeout if it was
+	// explicitly requested
+	if c.opts.TimeoutSet() {
+		var cancel context.CancelFunc
+		ctx, cancel = c.opts.WithTimeout(ctx)
+		defer cancel()
+	}
+
+	if c.opts.Trace {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+	}
+
 	stream, err := client(ctx)
 	if err != nil {
 		return err
@@ -110,6 +106,6 @@ func (c *cmd) handle(client constructor) error {
 			return err
 		}
 
-		results.Print(result, c.json)
+		results.PrintDecision(result, c.policy.Decide(result), c.opts.JSON)
 	}
 }
@@ -0,0 +1,281 @@
+package suggest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+const (
+	formatCSV   = "csv"
+	formatJSONL = "jsonl"
+)
+
+// row is a single suggestion read from the input
+type row struct {
+	line       int
+	url        string
+	suggestion *msg.Suggestion
+	err        error
+}
+
+type jsonRow struct {
+	URL          string   `json:"url"`
+	Categories   []string `json:"categories"`
+	Malicious    []string `json:"malicious"`
+	NotMalicious bool     `json:"not_malicious"`
+}
+
+func inputFormat(name string, peek []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return formatCSV
+	case ".jsonl", ".ndjson", ".json":
+		return formatJSONL
+	}
+
+	if trimmed := bytes.TrimSpace(peek); len(trimmed) > 0 && trimmed[0] == '{' {
+		return formatJSONL
+	}
+
+	return formatCSV
+}
+
+// splitList splits a csv field containing a list of categories
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ';' || r == '|'
+	})
+}
+
+func readRows(r io.Reader, format string) ([]row, error) {
+	switch format {
+	case formatCSV:
+		return readCSV(r)
+	case formatJSONL:
+		return readJSONL(r)
+	}
+
+	return nil, errors.Errorf("invalid input format: %s", format)
+}
+
+func readCSV(r io.Reader) ([]row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	var rows []row
+
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+
+		if err != nil {
+			if perr, ok := err.(*csv.ParseError); ok {
+				rows = append(rows, row{line: perr.StartLine, err: err})
+				continue
+			}
+			return nil, err
+		}
+
+		if first && strings.EqualFold(strings.TrimSpace(record[0]), "url") {
+			// header
+			continue
+		}
+
+		for len(record) < 4 {
+			record = append(record, "")
+		}
+
+		// records can span lines, so report the line each one starts on
+		line, _ := cr.FieldPos(0)
+
+		r := row{
+			line: line,
+			url:  strings.TrimSpace(record[0]),
+		}
+
+		var notMalicious bool
+		if v := strings.TrimSpace(record[3]); v != "" {
+			if notMalicious, err = strconv.ParseBool(v); err != nil {
+				r.err = errors.Errorf("invalid not malicious value: %s", v)
+				rows = append(rows, r)
+				continue
+			}
+		}
+
+		r.suggestion, r.err = newSuggestion(r.url, splitList(record[1]), splitList(record[2]), notMalicious)
+		rows = append(rows, r)
+	}
+}
+
+func readJSONL(r io.Reader) ([]row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	var rows []row
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var jr jsonRow
+
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&jr); err != nil {
+			rows = append(rows, row{line: line, err: errors.Wrap(err, "invalid json")})
+			continue
+		}
+
+		r := row{line: line, url: jr.URL}
+		r.suggestion, r.err = newSuggestion(jr.URL, jr.Categories, jr.Malicious, jr.NotMalicious)
+		rows = append(rows, r)
+	}
+
+	return rows, scanner.Err()
+}
+
+func (c *cmd) readInput() ([]row, error) {
+	var in io.Reader = os.Stdin
+
+	if c.input != "-" {
+		f, err := os.Open(c.input)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }() // #nosec
+		in = f
+	}
+
+	br := bufio.NewReader(in)
+
+	format := c.inputFormat
+	if format == "" {
+		peek, _ := br.Peek(512) // #nosec
+		format = inputFormat(c.input, peek)
+	}
+
+	return readRows(br, format)
+}
+
+// bulk validates and submits each suggestion in the input, running at most
+// concurrency requests at once
+func (c *cmd) bulk(ctx context.Context) error {
+	rows, err := c.readInput()
+	if err != nil {
+		return err
+	}
+
+	if !c.dryRun {
+		sem := make(chan struct{}, c.concurrency)
+		var wg sync.WaitGroup
+
+		for i := range rows {
+			r := &rows[i]
+			if r.err != nil {
+				continue
+			}
+
+			sem <- struct{}{}
+			wg.Add(1)
+
+			go func() {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				r.err = c.suggest(ctx, r.suggestion)
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	return c.report(rows)
+}
+
+func (c *cmd) report(rows []row) error {
+	var failed int
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	enc := json.NewEncoder(os.Stdout)
+
+	ok := "ok"
+	if c.dryRun {
+		ok = "valid"
+	}
+
+	for _, r := range rows {
+		if r.err != nil {
+			failed++
+		}
+
+		if c.opts.JSON {
+			out := struct {
+				Line  int    `json:"line"`
+				URL   string `json:"url"`
+				OK    bool   `json:"ok"`
+				Error string `json:"error,omitempty"`
+			}{Line: r.line, URL: r.url, OK: r.err == nil}
+
+			if r.err != nil {
+				out.Error = r.err.Error()
+			}
+
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		status := color.GreenString(ok)
+		if r.err != nil {
+			status = color.RedString("failed: %s", r.err)
+		}
+
+		fmt.Fprintf(w, "line %d\t%s\t%s\n", r.line, r.url, status) // #nosec
+	}
+
+	_ = w.Flush() // #nosec
+
+	action := "submitted"
+	if c.dryRun {
+		action = "valid"
+	}
+
+	fmt.Fprintf(os.Stderr, "%d of %d suggestions %s\n", len(rows)-failed, len(rows), action) // #nosec
+
+	if failed > 0 {
+		if c.dryRun {
+			return errors.Errorf("%d suggestions are invalid", failed)
+		}
+
+		return errors.Errorf("%d suggestions failed", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package suggest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/options"
+)
+
+func TestReadCSV(t *testing.T) {
+	const in = `url,categories,malicious,not_malicious
+# a comment
+http://a.com,PORN GAMBLING
+http://b.com,,MALWARE
+http://c.com,,,maybe
+http://d.com,"PORN;NUDITY",,false
+,PORN
+`
+
+	rows, err := readCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 5 {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+
+	if rows[0].err != nil || rows[0].url != "http://a.com" || rows[0].line != 3 {
+		t.Errorf("unexpected row: %v", rows[0])
+	} else if cats := rows[0].suggestion.Dataset.GetCategorization().GetValue(); !reflect.DeepEqual(cats, []msg.Category{msg.PORN_4, msg.GAMBLING_4}) {
+		t.Errorf("unexpected categories: %v", cats)
+	}
+
+	for _, i := range []int{1, 2, 4} {
+		if rows[i].err == nil {
+			t.Errorf("expected an error for line %d", rows[i].line)
+		}
+	}
+
+	if rows[3].err != nil || len(rows[3].suggestion.Dataset.GetCategorization().GetValue()) != 2 {
+		t.Errorf("unexpected row: %v", rows[3])
+	}
+
+	if rows[4].line != 7 {
+		t.Errorf("expected line 7, got %d", rows[4].line)
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	const in = `{"url": "http://a.com", "categories": ["PORN"]}
+{"url": "http://b.com", "malicous": ["MALWARE"]}
+
+{"url": "http://c.com", "not_malicious": true}
+`
+
+	rows, err := readJSONL(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("unexpected rows: %v", rows)
+	}
+
+	if rows[0].err != nil || rows[0].line != 1 {
+		t.Errorf("unexpected row: %v", rows[0])
+	}
+
+	if rows[1].err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+
+	if rows[2].err != nil || rows[2].line != 4 || rows[2].suggestion.Dataset.GetMalicious() == nil {
+		t.Errorf("unexpected row: %v", rows[2])
+	}
+}
+
+func TestInputFormat(t *testing.T) {
+	tests := []struct {
+		name, peek, want string
+	}{
+		{"in.csv", `{"url": ""}`, formatCSV},
+		{"in.jsonl", "url", formatJSONL},
+		{"-", `  {"url": ""}`, formatJSONL},
+		{"-", "url,categories", formatCSV},
+	}
+
+	for _, tt := range tests {
+		if got := inputFormat(tt.name, []byte(tt.peek)); got != tt.want {
+			t.Errorf("%s %q: got %s, want %s", tt.name, tt.peek, got, tt.want)
+		}
+	}
+}
+
+func TestBulk(t *testing.T) {
+	var mu sync.Mutex
+	var requests, unauthorized int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			unauthorized++
+			http.Error(w, `{"error":"unauthorized","code":16}`, http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "zapi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	const n = 20
+
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(f, "{\"url\":\"http://example.com/%d\",\"categories\":[\"NEWS_4\"]}\n", i)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every suggestion is submitted at once, they must share one client and
+	// its credentials
+	app := cli.NewApp()
+	app.Commands = []cli.Command{Command(options.New("zapi-test"))}
+
+	err = app.Run([]string{
+		"zapi", "suggest",
+		"--rest",
+		"--rest-base-url", srv.URL,
+		"--access-token", "test-token",
+		"--input", f.Name(),
+		"--input-format", "jsonl",
+		"--concurrency", strconv.Itoa(n),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requests != n || unauthorized != 0 {
+		t.Errorf("expected %d authorized requests, got %d with %d unauthorized", n, requests, unauthorized)
+	}
+}
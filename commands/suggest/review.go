@@ -0,0 +1,412 @@
+package suggest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/metadata"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/readline"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/poller"
+	"zvelo.io/zapi/results"
+)
+
+const reviewHelp = `Enter the categories the url should have, separated by spaces. Prefix
+categories with + or - to add them to or remove them from the current ones.
+Enter none to suggest no categories, or that the url is not malicious, or
+nothing to keep the current ones.
+`
+
+// classification is the set of categories and malicious categories of a url
+type classification struct {
+	Categories []msg.Category
+	Malicious  []msg.Category
+}
+
+func (c classification) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Categories []string `json:"categories"`
+		Malicious  []string `json:"malicious"`
+	}{
+		Categories: results.CategoryStrings(c.Categories),
+		Malicious:  results.CategoryStrings(c.Malicious),
+	})
+}
+
+type auditEntry struct {
+	Time      time.Time      `json:"time"`
+	URL       string         `json:"url"`
+	RequestID string         `json:"request_id,omitempty"`
+	Before    classification `json:"before"`
+	After     classification `json:"after"`
+}
+
+// edit applies the categories in names to current. If any of the names
+// start with + or -, they are added to or removed from current, otherwise
+// names replaces current entirely. "none" is the empty set and no names leaves
+// current as is.
+func edit(current []msg.Category, names []string) ([]msg.Category, error) {
+	if len(names) == 0 {
+		return current, nil
+	}
+
+	if len(names) == 1 && strings.EqualFold(names[0], "none") {
+		return []msg.Category{}, nil
+	}
+
+	var relative bool
+	for _, name := range names {
+		if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+			relative = true
+			break
+		}
+	}
+
+	var result []msg.Category
+	if relative {
+		result = append(result, current...)
+	}
+
+	for _, name := range names {
+		remove := strings.HasPrefix(name, "-")
+		name = strings.TrimLeft(name, "+-")
+
+		cats, err := results.ParseCategories([]string{name})
+		if err != nil {
+			return nil, err
+		}
+
+		if remove {
+			result = without(result, cats[0])
+			continue
+		}
+
+		if !results.Contains(result, cats[0]) {
+			result = append(result, cats[0])
+		}
+	}
+
+	if result == nil {
+		result = []msg.Category{}
+	}
+
+	return result, nil
+}
+
+func without(cats []msg.Category, cat msg.Category) []msg.Category {
+	result := []msg.Category{}
+
+	for _, c := range cats {
+		if c != cat {
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+// reviewSuggestion returns the suggestion that changes before into after. Only
+// the datasets that differ are included. It returns nil if nothing changed.
+func reviewSuggestion(url string, before, after classification) *msg.Suggestion {
+	var ds msg.Dataset
+
+	if added, removed := results.Diff(before.Categories, after.Categories); len(added) > 0 || len(removed) > 0 {
+		ds.Categorization = &msg.Dataset_Categorization{Value: after.Categories}
+	}
+
+	if added, removed := results.Diff(before.Malicious, after.Malicious); len(added) > 0 || len(removed) > 0 {
+		ds.Malicious = &msg.Dataset_Malicious{Category: after.Malicious}
+	}
+
+	if ds.Categorization == nil && ds.Malicious == nil {
+		return nil
+	}
+
+	return &msg.Suggestion{Url: url, Dataset: &ds}
+}
+
+func categoryNames(cats []msg.Category, empty string) string {
+	if len(cats) == 0 {
+		return empty
+	}
+
+	names := make([]string, len(cats))
+	for i, cat := range cats {
+		names[i] = fmt.Sprintf("%s (%s)", cat, msg.CategoryLong[cat])
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// completeCategory completes the category name being entered at the end of
+// prefix
+func completeCategory(prefix string) ([]string, string) {
+	word := prefix
+	if i := strings.LastIndexAny(prefix, " ,;|"); i >= 0 {
+		word = prefix[i+1:]
+	}
+
+	partial := strings.TrimLeft(word, "+-")
+
+	var candidates []string
+	for _, name := range msg.Category_name {
+		if name != msg.UNKNOWN_CATEGORY.String() && strings.HasPrefix(name, strings.ToUpper(partial)) {
+			candidates = append(candidates, word[:len(word)-len(partial)]+name)
+		}
+	}
+
+	sort.Strings(candidates)
+
+	return candidates, word
+}
+
+func (c *cmd) current(ctx context.Context) (*msg.QueryResult, error) {
+	if c.opts.Trace {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+	}
+
+	req := msg.QueryRequests{
+		Url:     []string{c.review},
+		Dataset: []msg.DatasetType{msg.CATEGORIZATION, msg.MALICIOUS},
+	}
+
+	var replies *msg.QueryReplies
+	var err error
+
+	if c.poller.Transport() == poller.TransportREST {
+		replies, err = c.clients.RESTv1().Query(ctx, &req)
+	} else {
+		client, cerr := c.clients.GRPCv1(ctx)
+		if cerr != nil {
+			return nil, cerr
+		}
+		replies, err = client.Query(ctx, &req)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "query error")
+	}
+
+	if len(replies.Reply) != 1 {
+		return nil, errors.Errorf("unexpected number of replies: %d", len(replies.Reply))
+	}
+
+	reply := replies.Reply[0]
+	if reply.Error != nil && reply.Error.Code != 0 {
+		return nil, errors.Errorf("query error: %s", reply.Error.Message)
+	}
+
+	var result *msg.QueryResult
+
+	c.poller.Poll(ctx, poller.Requests{reply.RequestId: c.review}, poller.HandlerFunc(func(_ context.Context, r *msg.QueryResult) poller.Requests {
+		result = r
+		return nil
+	}))
+
+	if !zvelo.IsComplete(result) {
+		return nil, errors.Errorf("query for %s did not complete", c.review)
+	}
+
+	if e := result.QueryStatus.GetError(); e != nil && e.Code != 0 {
+		return nil, errors.Errorf("query error: %s", e.Message)
+	}
+
+	return result, nil
+}
+
+// prompt reads categories from the editor until they are valid
+func prompt(editor *readline.Editor, label string, current []msg.Category) ([]msg.Category, error) {
+	for {
+		line, err := editor.ReadLine(label + ": ")
+		if err != nil {
+			return nil, err
+		}
+
+		fields := splitList(line)
+		if len(fields) == 1 && (fields[0] == "?" || fields[0] == "help") {
+			fmt.Print(reviewHelp)
+			continue
+		}
+
+		cats, err := edit(current, fields)
+		if err == nil {
+			editor.AddHistory(line)
+			return cats, nil
+		}
+
+		if !editor.Terminal() {
+			return nil, err
+		}
+
+		zvelo.Errorf("%s\n", err)
+	}
+}
+
+func confirm(editor *readline.Editor) (bool, error) {
+	line, err := editor.ReadLine("submit suggestion? [y/N] ")
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// reviewURL shows the current categories of the url, reads the new ones and
+// submits the difference as a suggestion
+func (c *cmd) reviewURL(ctx context.Context) error {
+	result, err := c.current(ctx)
+	if err != nil {
+		return err
+	}
+
+	var before classification
+
+	if cat := result.ResponseDataset.GetCategorization(); cat != nil {
+		if cat.Error != nil && cat.Error.Code != 0 {
+			return errors.Errorf("categorization error: %s", cat.Error.Message)
+		}
+		before.Categories = cat.Value
+	}
+
+	if mal := result.ResponseDataset.GetMalicious(); mal != nil {
+		if mal.Error != nil && mal.Error.Code != 0 {
+			return errors.Errorf("malicious error: %s", mal.Error.Message)
+		}
+		before.Malicious = mal.Category
+	}
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stdout)
+	printf("URL:         %s\n", c.review)
+	printf("Categories:  %s\n", categoryNames(before.Categories, "none"))
+	printf("Malicious:   %s\n", categoryNames(before.Malicious, "CLEAN"))
+
+	interactive := len(c.categories) == 0 && len(c.malicious) == 0 && !c.notMalicious
+
+	var editor *readline.Editor
+	after := before
+
+	if interactive {
+		editor = readline.New(os.Stdin, os.Stdout)
+		editor.Complete = completeCategory
+
+		if editor.Terminal() {
+			fmt.Println("\nenter the new categories, ? for help")
+		}
+
+		if after.Categories, err = prompt(editor, "categories", before.Categories); err != nil {
+			return err
+		}
+
+		if after.Malicious, err = prompt(editor, "malicious", before.Malicious); err != nil {
+			return err
+		}
+	} else {
+		if after.Categories, err = edit(before.Categories, c.categories); err != nil {
+			return err
+		}
+
+		if len(c.malicious) > 0 && c.notMalicious {
+			return errors.New("can't suggest both malicious categories and that the url is not malicious")
+		}
+
+		malicious := []string(c.malicious)
+		if c.notMalicious {
+			malicious = []string{"none"}
+		}
+
+		if after.Malicious, err = edit(before.Malicious, malicious); err != nil {
+			return err
+		}
+	}
+
+	suggestion := reviewSuggestion(c.review, before, after)
+	if suggestion == nil {
+		fmt.Fprintln(os.Stderr, "no changes to suggest") // #nosec
+		return nil
+	}
+
+	printDiff("categories", before.Categories, after.Categories)
+	printDiff("malicious", before.Malicious, after.Malicious)
+
+	if c.dryRun {
+		return nil
+	}
+
+	if interactive && editor.Terminal() {
+		ok, err := confirm(editor)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+	}
+
+	if err = c.suggest(ctx, suggestion); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "suggestion submitted") // #nosec
+
+	return c.audit(auditEntry{
+		Time:      time.Now().UTC(),
+		URL:       c.review,
+		RequestID: result.RequestId,
+		Before:    before,
+		After:     after,
+	})
+}
+
+func printDiff(label string, before, after []msg.Category) {
+	added, removed := results.Diff(before, after)
+
+	for _, cat := range added {
+		color.Green("%-12s + %s (%s)", label+":", cat, msg.CategoryLong[cat])
+	}
+
+	for _, cat := range removed {
+		color.Red("%-12s - %s (%s)", label+":", cat, msg.CategoryLong[cat])
+	}
+}
+
+// audit appends a line recording entry to the audit log
+func (c *cmd) audit(entry auditEntry) error {
+	if err := os.MkdirAll(filepath.Dir(c.auditLog), 0700); err != nil {
+		return errors.Wrap(err, "error creating audit log directory")
+	}
+
+	f, err := os.OpenFile(c.auditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "error opening audit log")
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		_ = f.Close() // #nosec
+		return err
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		_ = f.Close() // #nosec
+		return errors.Wrap(err, "error writing audit log")
+	}
+
+	return f.Close()
+}
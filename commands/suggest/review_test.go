@@ -0,0 +1,71 @@
+package suggest
+
+import (
+	"reflect"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestEdit(t *testing.T) {
+	current := []msg.Category{msg.PORN_4, msg.NUDITY_4}
+
+	tests := []struct {
+		names []string
+		want  []msg.Category
+	}{
+		{nil, current},
+		{[]string{"none"}, []msg.Category{}},
+		{[]string{"gambling"}, []msg.Category{msg.GAMBLING_4}},
+		{[]string{"+GAMBLING", "-NUDITY"}, []msg.Category{msg.PORN_4, msg.GAMBLING_4}},
+		{[]string{"GAMBLING", "-PORN", "+PORN"}, []msg.Category{msg.NUDITY_4, msg.GAMBLING_4, msg.PORN_4}},
+		{[]string{"-PORN", "-NUDITY"}, []msg.Category{}},
+	}
+
+	for _, tt := range tests {
+		got, err := edit(current, tt.names)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %s", tt.names, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.names, got, tt.want)
+		}
+	}
+
+	if _, err := edit(current, []string{"+BOGUS"}); err == nil {
+		t.Error("expected an error for an invalid category")
+	}
+}
+
+func TestReviewSuggestion(t *testing.T) {
+	before := classification{Categories: []msg.Category{msg.PORN_4, msg.NUDITY_4}}
+
+	if s := reviewSuggestion("http://a.com", before, classification{
+		Categories: []msg.Category{msg.NUDITY_4, msg.PORN_4},
+		Malicious:  []msg.Category{},
+	}); s != nil {
+		t.Errorf("unexpected suggestion: %v", s)
+	}
+
+	s := reviewSuggestion("http://a.com", before, classification{
+		Categories: before.Categories,
+		Malicious:  []msg.Category{msg.WEAPONS_4},
+	})
+
+	if s == nil || s.Url != "http://a.com" || s.Dataset.Categorization != nil {
+		t.Fatalf("unexpected suggestion: %v", s)
+	}
+
+	if cats := s.Dataset.GetMalicious().GetCategory(); !reflect.DeepEqual(cats, []msg.Category{msg.WEAPONS_4}) {
+		t.Errorf("unexpected malicious categories: %v", cats)
+	}
+}
+
+func TestCompleteCategory(t *testing.T) {
+	got, word := completeCategory("PORN +gamb")
+	if !reflect.DeepEqual(got, []string{"+GAMBLING_4"}) || word != "+gamb" {
+		t.Errorf("got %v (%q)", got, word)
+	}
+}
@@ -2,7 +2,7 @@ package suggest
 
 import (
 	"context"
-	"time"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
@@ -11,53 +11,33 @@ import (
 	zapi "zvelo.io/go-zapi"
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/poller"
 	"zvelo.io/zapi/results"
-	"zvelo.io/zapi/tokensourcer"
 )
 
 type cmd struct {
-	debug, trace, rest bool
-	insecureSkipVerify bool
-	timeout            time.Duration
-	clients            clients.Clients
-	categories         cli.StringSlice
-	malicious          cli.StringSlice
-	notMalicious       bool
-	suggestion         msg.Suggestion
+	opts         *options.Options
+	clients      clients.Clients
+	poller       poller.Poller
+	categories   cli.StringSlice
+	malicious    cli.StringSlice
+	notMalicious bool
+	suggestion   msg.Suggestion
+	input        string
+	inputFormat  string
+	concurrency  int
+	dryRun       bool
+	review       string
+	auditLog     string
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	return append(c.clients.Flags(),
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
-		cli.BoolFlag{
-			Name:        "trace",
-			EnvVar:      "ZVELO_TRACE",
-			Usage:       "request a trace to be generated for each request",
-			Destination: &c.trace,
-		},
-		cli.BoolFlag{
-			Name:        "rest",
-			EnvVar:      "ZVELO_REST",
-			Usage:       "Use REST instead of gRPC for api requests",
-			Destination: &c.rest,
-		},
-		cli.DurationFlag{
-			Name:        "timeout",
-			EnvVar:      "ZVELO_TIMEOUT",
-			Usage:       "maximum amount of time to wait for results to complete",
-			Value:       15 * time.Minute,
-			Destination: &c.timeout,
-		},
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	flags = append(flags, c.poller.Flags()...)
+
+	return append(flags,
 		cli.StringFlag{
 			Name:        "url",
 			Usage:       "url to make suggestion for",
@@ -78,100 +58,198 @@ func (c *cmd) Flags() []cli.Flag {
 			Usage:       "suggest that the url should not be considered malicious",
 			Destination: &c.notMalicious,
 		},
+		cli.StringFlag{
+			Name:        "input",
+			Usage:       "file of suggestions to make, one per row, - reads from stdin. csv rows are url,categories,malicious categories,not malicious with categories separated by spaces. jsonl rows are objects with url, categories, malicious and not_malicious",
+			Destination: &c.input,
+		},
+		cli.StringFlag{
+			Name:        "input-format",
+			Usage:       "format of the input file, csv or jsonl (default: from the file extension, or the content)",
+			Destination: &c.inputFormat,
+		},
+		cli.IntFlag{
+			Name:        "concurrency",
+			Usage:       "maximum number of suggestions from input to submit at once",
+			Value:       4,
+			Destination: &c.concurrency,
+		},
+		cli.BoolFlag{
+			Name:        "dry-run",
+			Usage:       "only validate the suggestions, don't submit them",
+			Destination: &c.dryRun,
+		},
+		cli.StringFlag{
+			Name:        "review",
+			Usage:       "show the current categories of a url and suggest changes to them. the new categories are read interactively unless any of category, malicious-category or not-malicious are given",
+			Destination: &c.review,
+		},
+		cli.StringFlag{
+			Name:        "audit-log",
+			Usage:       "file to record the suggestions made with review (default: suggest_audit.log in the data directory)",
+			Destination: &c.auditLog,
+		},
 	)
 }
 
-func Command(appName string) cli.Command {
-	var c cmd
-	tokenSourcer := tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, "zvelo.suggest")
-	c.clients = clients.New(tokenSourcer, &c.debug, &c.insecureSkipVerify)
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients("zvelo.suggest")
+	c.poller = poller.New(opts, c.clients)
 
 	return cli.Command{
 		Name:   "suggest",
 		Usage:  "suggest new datasets for a url",
-		Before: c.setup,
+		Before: opts.Before(c.setup),
 		Action: c.action,
 		Flags:  c.Flags(),
 	}
 }
 
 func (c *cmd) setup(_ *cli.Context) error {
-	if c.suggestion.Url == "" {
-		return errors.New("url is required")
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
+	if c.poller.Transport() == poller.TransportGraphQL {
+		return errors.New("suggestions can't be made with the graphql transport")
+	}
+
+	if c.review != "" {
+		if c.suggestion.Url != "" || c.input != "" {
+			return errors.New("review can't be used with url or input")
+		}
+
+		var err error
+		if c.review, err = zvelo.NormalizeURL(c.review, false); err != nil {
+			return err
+		}
+
+		if c.auditLog == "" {
+			c.auditLog = filepath.Join(zvelo.DataDir(c.opts.AppName()), "suggest_audit.log")
+		}
+
+		return nil
 	}
 
-	var cats []msg.Category
-	for _, catName := range c.categories {
-		cat := msg.ParseCategory(catName)
-		if cat == msg.UNKNOWN_CATEGORY {
-			return errors.Errorf("invalid category: %s", catName)
+	if c.input != "" {
+		if c.suggestion.Url != "" {
+			return errors.New("url and input can't be used together")
 		}
-		cats = append(cats, cat)
+
+		if len(c.categories) > 0 || len(c.malicious) > 0 || c.notMalicious {
+			return errors.New("category, malicious-category and not-malicious can't be used with input, include them in the input instead")
+		}
+
+		if c.concurrency < 1 {
+			return errors.New("concurrency must be at least 1")
+		}
+
+		return nil
+	}
+
+	if c.suggestion.Url == "" {
+		return errors.New("url, input or review is required")
+	}
+
+	s, err := newSuggestion(c.suggestion.Url, c.categories, c.malicious, c.notMalicious)
+	if err != nil {
+		return err
+	}
+
+	c.suggestion = *s
+
+	return nil
+}
+
+// newSuggestion validates the categories and returns the suggestion for url
+func newSuggestion(url string, categories, malicious []string, notMalicious bool) (*msg.Suggestion, error) {
+	s := msg.Suggestion{Url: url}
+
+	if url == "" {
+		return nil, errors.New("url is required")
+	}
+
+	cats, err := results.ParseCategories(categories)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(cats) > 0 {
-		if c.suggestion.Dataset == nil {
-			c.suggestion.Dataset = &msg.Dataset{}
+		if s.Dataset == nil {
+			s.Dataset = &msg.Dataset{}
 		}
 
-		c.suggestion.Dataset.Categorization = &msg.Dataset_Categorization{
+		s.Dataset.Categorization = &msg.Dataset_Categorization{
 			Value: cats,
 		}
 	}
 
-	if len(c.malicious) > 0 && c.notMalicious {
-		return errors.New("can't suggest both malicious categories and that the url is not malicious")
+	if len(malicious) > 0 && notMalicious {
+		return nil, errors.New("can't suggest both malicious categories and that the url is not malicious")
 	}
 
-	var malcats []msg.Category
-	for _, catName := range c.malicious {
-		cat := msg.ParseCategory(catName)
-		if cat == msg.UNKNOWN_CATEGORY {
-			return errors.Errorf("invalid category: %s", catName)
-		}
-		malcats = append(malcats, cat)
+	malcats, err := results.ParseCategories(malicious)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(malcats) > 0 {
-		if c.suggestion.Dataset == nil {
-			c.suggestion.Dataset = &msg.Dataset{}
+		if s.Dataset == nil {
+			s.Dataset = &msg.Dataset{}
 		}
 
-		c.suggestion.Dataset.Malicious = &msg.Dataset_Malicious{
+		s.Dataset.Malicious = &msg.Dataset_Malicious{
 			Category: malcats,
 		}
 	}
 
-	if c.notMalicious {
-		if c.suggestion.Dataset == nil {
-			c.suggestion.Dataset = &msg.Dataset{}
+	if notMalicious {
+		if s.Dataset == nil {
+			s.Dataset = &msg.Dataset{}
 		}
 
-		c.suggestion.Dataset.Malicious = &msg.Dataset_Malicious{
+		s.Dataset.Malicious = &msg.Dataset_Malicious{
 			Category: []msg.Category{},
 		}
 	}
 
-	if c.suggestion.Dataset == nil {
-		return errors.New("nothing to suggest")
+	if s.Dataset == nil {
+		return nil, errors.New("nothing to suggest")
 	}
 
-	return nil
+	return &s, nil
 }
 
 func (c *cmd) action(_ *cli.Context) error {
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	ctx, cancel := c.opts.WithTimeout(context.Background())
 	defer cancel()
 
-	if c.rest {
-		return c.suggestREST(ctx)
+	if c.review != "" {
+		return c.reviewURL(ctx)
+	}
+
+	if c.input != "" {
+		return c.bulk(ctx)
+	}
+
+	if c.dryRun {
+		return nil
+	}
+
+	return c.suggest(ctx, &c.suggestion)
+}
+
+func (c *cmd) suggest(ctx context.Context, suggestion *msg.Suggestion) error {
+	if c.poller.Transport() == poller.TransportREST {
+		return c.suggestREST(ctx, suggestion)
 	}
 
-	return c.suggestGRPC(ctx)
+	return c.suggestGRPC(ctx, suggestion)
 }
 
-func (c *cmd) suggestGRPC(ctx context.Context) error {
-	if c.trace {
+func (c *cmd) suggestGRPC(ctx context.Context, suggestion *msg.Suggestion) error {
+	if c.opts.Trace {
 		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
 	}
 
@@ -180,21 +258,21 @@ func (c *cmd) suggestGRPC(ctx context.Context) error {
 		return err
 	}
 
-	if _, err = client.Suggest(ctx, &c.suggestion); err != nil {
+	if _, err = client.Suggest(ctx, suggestion); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (c *cmd) suggestREST(ctx context.Context) error {
+func (c *cmd) suggestREST(ctx context.Context, suggestion *msg.Suggestion) error {
 	var opts []zapi.CallOption
 
-	if c.trace {
+	if c.opts.Trace {
 		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
 	}
 
-	if err := c.clients.RESTv1().Suggest(ctx, &c.suggestion, opts...); err != nil {
+	if err := c.clients.RESTv1().Suggest(ctx, suggestion, opts...); err != nil {
 		return err
 	}
 
@@ -16,6 +16,7 @@ import (
 	"golang.org/x/oauth2"
 
 	zapi "zvelo.io/go-zapi"
+	"zvelo.io/zapi/options"
 	"zvelo.io/zapi/tokensourcer"
 )
 
@@ -33,6 +34,8 @@ var tokenTplStr = `
 {{end -}}
 {{- if idtoken .}}ID Token:      {{idtoken .}}
 {{end}}
+{{- if issuedtype .}}Issued Type:   {{issuedtype .}}
+{{end}}
 `
 
 var idTokenTplStr = `Issuer:        {{.Issuer}}
@@ -53,32 +56,44 @@ var tokenTpl = template.Must(template.New("token").
 			}
 			return ""
 		},
+		"issuedtype": func(i *oauth2.Token) string {
+			if s, ok := i.Extra("issued_token_type").(string); ok {
+				return s
+			}
+			return ""
+		},
 	}).
 	Parse(tokenTplStr))
 
-var idTokenTpl = template.Must(template.New("id_token").
-	Funcs(template.FuncMap{
-		"join": func(i []string) string {
-			return strings.Join(i, ", ")
-		},
-		"claims": func(i map[string]interface{}) string {
-			var buf bytes.Buffer
-			w := tabwriter.NewWriter(&buf, 0, 0, 0, ' ', 0)
-			var keys []string
-			for k := range i {
-				keys = append(keys, k)
-			}
+var delegatedTokenTplStr = `Delegated Token Claims:
+  {{claims .}}
+`
+
+var claimsFuncs = template.FuncMap{
+	"join": func(i []string) string {
+		return strings.Join(i, ", ")
+	},
+	"claims": func(i map[string]interface{}) string {
+		var buf bytes.Buffer
+		w := tabwriter.NewWriter(&buf, 0, 0, 0, ' ', 0)
+		var keys []string
+		for k := range i {
+			keys = append(keys, k)
+		}
+
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			printClaim(w, "  ", k, i[k])
+		}
+		_ = w.Flush() // #nosec
+		return strings.TrimSpace(buf.String())
+	},
+}
 
-			sort.Strings(keys)
+var idTokenTpl = template.Must(template.New("id_token").Funcs(claimsFuncs).Parse(idTokenTplStr))
 
-			for _, k := range keys {
-				printClaim(w, "  ", k, i[k])
-			}
-			_ = w.Flush() // #nosec
-			return strings.TrimSpace(buf.String())
-		},
-	}).
-	Parse(idTokenTplStr))
+var delegatedTokenTpl = template.Must(template.New("delegated_token").Funcs(claimsFuncs).Parse(delegatedTokenTplStr))
 
 func printClaim(w io.Writer, prefix, k string, v interface{}) {
 	if v == nil || v == "" {
@@ -99,36 +114,29 @@ func printClaim(w io.Writer, prefix, k string, v interface{}) {
 }
 
 type cmd struct {
-	debug              bool
-	insecureSkipVerify bool
+	opts *options.Options
 	tokensourcer.TokenSourcer
 	verifier *oidc.IDTokenVerifier
 }
 
 func (c *cmd) Flags() []cli.Flag {
-	return append(c.TokenSourcer.Flags(),
-		cli.BoolFlag{
-			Name:        "debug",
-			EnvVar:      "ZVELO_DEBUG",
-			Usage:       "enable debug logging",
-			Destination: &c.debug,
-		},
-		cli.BoolFlag{
-			Name:        "insecure-skip-verify",
-			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
-			Destination: &c.insecureSkipVerify,
-		},
+	flags := c.opts.Flags(
+		options.FlagDebug,
+		options.FlagInsecureSkipVerify,
+		options.FlagTraceFile,
+		options.FlagTraceEndpoint,
 	)
+	return append(flags, c.TokenSourcer.Flags()...)
 }
 
-func Command(appName string) cli.Command {
-	var c cmd
-	c.TokenSourcer = tokensourcer.New(appName, &c.debug, &c.insecureSkipVerify, strings.Fields(zapi.DefaultScopes)...)
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.TokenSourcer = opts.TokenSourcer(strings.Fields(zapi.DefaultScopes)...)
 
 	return cli.Command{
 		Name:   "token",
 		Usage:  "retrieve a token for use elsewhere",
-		Before: c.setup,
+		Before: opts.Before(c.setup),
 		Action: c.action,
 		Flags:  c.Flags(),
 	}
@@ -155,6 +163,16 @@ func (c *cmd) action(_ *cli.Context) error {
 		return err
 	}
 
+	if token.Extra("issued_token_type") != nil {
+		// the token was delegated via token exchange, the access token claims
+		// show who it was issued for and who is acting on their behalf
+		if claims, cerr := tokensourcer.JWTClaims(token.AccessToken); cerr == nil {
+			if err = delegatedTokenTpl.Execute(os.Stdout, claims); err != nil {
+				return err
+			}
+		}
+	}
+
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if c.verifier == nil || !ok {
 		return nil
@@ -0,0 +1,134 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"zvelo.io/zapi/results"
+)
+
+// event records that the dataset of a url changed
+type event struct {
+	Time      time.Time
+	URL       string
+	RequestID string
+	results.Change
+}
+
+func (e event) MarshalJSON() ([]byte, error) {
+	je := struct {
+		Time              time.Time `json:"time"`
+		URL               string    `json:"url"`
+		RequestID         string    `json:"request_id,omitempty"`
+		CategoriesAdded   []string  `json:"categories_added,omitempty"`
+		CategoriesRemoved []string  `json:"categories_removed,omitempty"`
+		VerdictBefore     string    `json:"verdict_before,omitempty"`
+		VerdictAfter      string    `json:"verdict_after,omitempty"`
+	}{
+		Time:              e.Time,
+		URL:               e.URL,
+		RequestID:         e.RequestID,
+		CategoriesAdded:   results.CategoryStrings(e.CategoriesAdded),
+		CategoriesRemoved: results.CategoryStrings(e.CategoriesRemoved),
+	}
+
+	if e.VerdictChanged() {
+		je.VerdictBefore = e.VerdictBefore
+		je.VerdictAfter = e.VerdictAfter
+	}
+
+	return json.Marshal(je)
+}
+
+func (e event) String() string {
+	var changes []string
+
+	for _, cat := range e.CategoriesAdded {
+		changes = append(changes, "+"+cat.String())
+	}
+
+	for _, cat := range e.CategoriesRemoved {
+		changes = append(changes, "-"+cat.String())
+	}
+
+	if e.VerdictChanged() {
+		changes = append(changes, fmt.Sprintf("%s -> %s", e.VerdictBefore, e.VerdictAfter))
+	}
+
+	return fmt.Sprintf("%s %s: %s", e.Time.Format(time.RFC3339), e.URL, strings.Join(changes, " "))
+}
+
+// emit writes e to stdout and, if configured, the event log and webhook
+func (c *cmd) emit(ctx context.Context, e event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.JSON {
+		fmt.Fprintf(os.Stdout, "%s\n", data) // #nosec
+	} else {
+		fmt.Fprintln(os.Stdout, e) // #nosec
+	}
+
+	if c.eventLog != "" {
+		if err = appendLine(c.eventLog, data); err != nil {
+			return err
+		}
+	}
+
+	if c.webhook != "" {
+		return c.post(ctx, data)
+	}
+
+	return nil
+}
+
+func appendLine(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return errors.Wrap(err, "error creating event log directory")
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600) // #nosec
+	if err != nil {
+		return errors.Wrap(err, "error opening event log")
+	}
+
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		_ = f.Close() // #nosec
+		return errors.Wrap(err, "error writing event log")
+	}
+
+	return f.Close()
+}
+
+// post sends an event to the webhook
+func (c *cmd) post(ctx context.Context, data []byte) error {
+	req, err := http.NewRequest("POST", c.webhook, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "webhook error")
+	}
+	_ = resp.Body.Close() // #nosec
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook error: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package watch
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+var jsonMarshaler = jsonpb.Marshaler{OrigName: true}
+
+// entry is the last dataset received for a url
+type entry struct {
+	Dataset *msg.Dataset
+	Checked time.Time
+	Changed time.Time
+}
+
+type jsonEntry struct {
+	Dataset json.RawMessage `json:"dataset"`
+	Checked time.Time       `json:"checked"`
+	Changed time.Time       `json:"changed,omitempty"`
+}
+
+func (e entry) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jsonMarshaler.Marshal(&buf, e.Dataset); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonEntry{
+		Dataset: buf.Bytes(),
+		Checked: e.Checked,
+		Changed: e.Changed,
+	})
+}
+
+func (e *entry) UnmarshalJSON(data []byte) error {
+	var je jsonEntry
+	if err := json.Unmarshal(data, &je); err != nil {
+		return err
+	}
+
+	var ds msg.Dataset
+	if err := jsonpb.Unmarshal(bytes.NewReader(je.Dataset), &ds); err != nil {
+		return err
+	}
+
+	*e = entry{
+		Dataset: &ds,
+		Checked: je.Checked,
+		Changed: je.Changed,
+	}
+
+	return nil
+}
+
+// state is persisted between runs so that changes can be detected across them
+type state struct {
+	URLs map[string]*entry `json:"urls"`
+}
+
+// loadState reads the state from the file name. A file that doesn't exist is
+// an empty state.
+func loadState(name string) (*state, error) {
+	s := state{URLs: map[string]*entry{}}
+
+	data, err := ioutil.ReadFile(name) // #nosec
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading state")
+	}
+
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, errors.Wrapf(err, "error parsing state from %s", name)
+	}
+
+	if s.URLs == nil {
+		s.URLs = map[string]*entry{}
+	}
+
+	return &s, nil
+}
+
+// save writes s to the file name. It is written to a temporary file first so
+// that an interrupted save doesn't lose the previous state.
+func (s *state) save(name string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return errors.Wrap(err, "error creating state directory")
+	}
+
+	tmp := name + ".tmp"
+
+	if err = ioutil.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return errors.Wrap(err, "error writing state")
+	}
+
+	return errors.Wrap(os.Rename(tmp, name), "error writing state")
+}
@@ -0,0 +1,407 @@
+package watch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	zapi "zvelo.io/go-zapi"
+	"zvelo.io/msg/mock"
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/msg/status"
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/poller"
+	"zvelo.io/zapi/results"
+)
+
+func defaultDatasets() []string {
+	return []string{msg.CATEGORIZATION.String(), msg.MALICIOUS.String()}
+}
+
+type cmd struct {
+	opts            *options.Options
+	clients         clients.Clients
+	poller          poller.Poller
+	input           string
+	every           time.Duration
+	runOnce         bool
+	stateFile       string
+	eventLog        string
+	webhook         string
+	batchSize       int
+	datasetStrings  cli.StringSlice
+	datasets        []msg.DatasetType
+	mockCategories  cli.StringSlice
+	mockMalicious   cli.StringSlice
+	mockContextOpts []mock.ContextOption
+}
+
+func (c *cmd) Flags() []cli.Flag {
+	flags := append(c.opts.Flags(options.AllFlags...), c.clients.Flags()...)
+	flags = append(flags, c.poller.Flags()...)
+
+	return append(flags,
+		cli.StringFlag{
+			Name:        "input",
+			Usage:       "file of urls to watch, one per line, - reads from stdin. the file is read again before each check so urls can be added or removed while watching",
+			Destination: &c.input,
+		},
+		cli.DurationFlag{
+			Name:        "every",
+			Usage:       "how often to query the urls again",
+			Value:       6 * time.Hour,
+			Destination: &c.every,
+		},
+		cli.BoolFlag{
+			Name:        "run-once",
+			Usage:       "check the urls once and exit instead of repeating the check",
+			Destination: &c.runOnce,
+		},
+		cli.StringFlag{
+			Name:        "state",
+			EnvVar:      "ZVELO_WATCH_STATE",
+			Usage:       "file to persist the last result of each url to between runs (default: watch_state.json in the data directory)",
+			Destination: &c.stateFile,
+		},
+		cli.StringFlag{
+			Name:        "event-log",
+			Usage:       "file to append change events to as json lines",
+			Destination: &c.eventLog,
+		},
+		cli.StringFlag{
+			Name:        "webhook",
+			EnvVar:      "ZVELO_WATCH_WEBHOOK",
+			Usage:       "url to POST each change event to as json",
+			Destination: &c.webhook,
+		},
+		cli.IntFlag{
+			Name:        "batch-size",
+			Usage:       "maximum number of urls in a single query request",
+			Value:       100,
+			Destination: &c.batchSize,
+		},
+		cli.StringSliceFlag{
+			Name:  "dataset",
+			Usage: "list of datasets to retrieve, changes are only reported for categorization and malicious (default: " + strings.Join(defaultDatasets(), ", ") + ")",
+			Value: &c.datasetStrings,
+		},
+		cli.StringSliceFlag{
+			Name:  "mock-category",
+			Usage: "when watching against the mock server, expect these categories in the categorization response (category id or category short name, may be repeated)",
+			Value: &c.mockCategories,
+		},
+		cli.StringSliceFlag{
+			Name:  "mock-malicious-category",
+			Usage: "when watching against the mock server, expect this category in the malicious response and for the verdict to be MALICIOUS (category id or category short name, may be repeated)",
+			Value: &c.mockMalicious,
+		},
+	)
+}
+
+func Command(opts *options.Options) cli.Command {
+	c := cmd{opts: opts}
+	c.clients = opts.Clients(strings.Fields(zapi.DefaultScopes)...)
+	c.poller = poller.New(opts, c.clients)
+
+	return cli.Command{
+		Name:   "watch",
+		Usage:  "periodically query urls again and report changes to their categories or malicious verdict",
+		Before: opts.Before(c.setup),
+		Action: c.action,
+		Flags:  c.Flags(),
+	}
+}
+
+func (c *cmd) setup(_ *cli.Context) error {
+	if err := c.poller.Setup(); err != nil {
+		return err
+	}
+
+	if c.input == "" {
+		return errors.New("input is required")
+	}
+
+	if c.every <= 0 {
+		return errors.New("every must be greater than 0")
+	}
+
+	if c.batchSize < 1 {
+		return errors.New("batch-size must be at least 1")
+	}
+
+	if c.input == "-" && !c.runOnce {
+		return errors.New("urls can only be read from stdin with run-once")
+	}
+
+	if c.stateFile == "" {
+		c.stateFile = filepath.Join(zvelo.DataDir(c.opts.AppName()), "watch_state.json")
+	}
+
+	if len(c.datasetStrings) == 0 {
+		c.datasetStrings = defaultDatasets()
+	}
+
+	for _, name := range c.datasetStrings {
+		dst, err := msg.NewDatasetType(strings.TrimSpace(name))
+		if err != nil {
+			return errors.Errorf("invalid dataset type: %s", name)
+		}
+
+		c.datasets = append(c.datasets, dst)
+	}
+
+	var err error
+	c.mockContextOpts, err = poller.MockOptions(c.mockCategories, c.mockMalicious)
+	return err
+}
+
+// readURLs reads the urls to watch from r, skipping empty lines and comments
+// starting with #. The urls are normalized the same as query does, and
+// duplicates are only returned once.
+func readURLs(r io.Reader) ([]string, error) {
+	var urls []string
+	seen := map[string]bool{}
+
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		u, err := zvelo.NormalizeURL(text, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		if seen[u] {
+			continue
+		}
+
+		seen[u] = true
+		urls = append(urls, u)
+	}
+
+	return urls, s.Err()
+}
+
+func (c *cmd) urls() ([]string, error) {
+	if c.input == "-" {
+		return readURLs(os.Stdin)
+	}
+
+	f, err := os.Open(c.input) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }() // #nosec
+
+	return readURLs(f)
+}
+
+func (c *cmd) action(_ *cli.Context) error {
+	s, err := loadState(c.stateFile)
+	if err != nil {
+		return err
+	}
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stderr)
+
+	for {
+		if err = c.check(s); err != nil {
+			return err
+		}
+
+		if c.runOnce {
+			return nil
+		}
+
+		printf("next check at %s\n", time.Now().Add(c.every).Format(time.RFC3339))
+		time.Sleep(c.every)
+	}
+}
+
+// check queries each url, without using the cache, reports the changes since
+// the last check and saves the new state
+func (c *cmd) check(s *state) error {
+	urls, err := c.urls()
+	if err != nil {
+		return err
+	}
+
+	ctx := mock.QueryContext(context.Background(), c.mockContextOpts...)
+	ctx, cancel := c.opts.WithTimeout(ctx)
+	defer cancel()
+
+	fetched := c.fetch(ctx, urls)
+
+	var changed int
+
+	for _, u := range urls {
+		result, ok := fetched[u]
+		if !ok {
+			continue
+		}
+
+		now := time.Now().UTC()
+
+		prev, ok := s.URLs[u]
+		if !ok {
+			s.URLs[u] = &entry{Dataset: result.ResponseDataset, Checked: now}
+			continue
+		}
+
+		prev.Checked = now
+
+		dataset := merge(prev.Dataset, result.ResponseDataset)
+
+		if prev.Dataset.Equal(dataset) {
+			continue
+		}
+
+		change := results.Compare(prev.Dataset, dataset)
+		prev.Dataset = dataset
+
+		if !change.Changed() {
+			continue
+		}
+
+		prev.Changed = now
+		changed++
+
+		err = c.emit(ctx, event{
+			Time:      now,
+			URL:       u,
+			RequestID: result.RequestId,
+			Change:    change,
+		})
+
+		if err != nil {
+			zvelo.Errorf("%s\n", err)
+		}
+	}
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stderr)
+	printf("checked %d of %d urls, %d changed\n", len(fetched), len(urls), changed)
+
+	return s.save(c.stateFile)
+}
+
+// merge returns next with each dataset that is missing from it, or that has
+// an error, replaced by the last good one from prev. A transient error then
+// isn't reported as a change, and the next good result is compared to the
+// last good one.
+func merge(prev, next *msg.Dataset) *msg.Dataset {
+	if prev == nil {
+		return next
+	}
+
+	if next == nil {
+		return prev
+	}
+
+	ds := *next
+
+	if ds.Categorization == nil || ds.Categorization.Error != nil {
+		ds.Categorization = prev.Categorization
+	}
+
+	if ds.Malicious == nil || ds.Malicious.Error != nil {
+		ds.Malicious = prev.Malicious
+	}
+
+	if ds.Echo == nil || ds.Echo.Error != nil {
+		ds.Echo = prev.Echo
+	}
+
+	if ds.Language == nil || ds.Language.Error != nil {
+		ds.Language = prev.Language
+	}
+
+	return &ds
+}
+
+// fetch queries the urls in batches and polls until their results are
+// complete. urls that couldn't be queried, or whose results have errors, are
+// not included in the returned map of url to result.
+func (c *cmd) fetch(ctx context.Context, urls []string) map[string]*msg.QueryResult {
+	requests := poller.Requests{}
+
+	for len(urls) > 0 {
+		n := c.batchSize
+		if n > len(urls) {
+			n = len(urls)
+		}
+
+		var batch []string
+		batch, urls = urls[:n], urls[n:]
+
+		if c.opts.Debug {
+			fmt.Fprintf(os.Stderr, "querying %d urls\n", len(batch)) // #nosec
+		}
+
+		// bypass the cache so the urls are categorized again
+		replies, err := c.poller.Query(ctx, &msg.QueryRequests{
+			Url:     batch,
+			Dataset: c.datasets,
+		}, true)
+
+		if err != nil {
+			zvelo.Errorf("query error: %s\n", err)
+			continue
+		}
+
+		for i, reply := range replies.Reply {
+			if i >= len(batch) {
+				break
+			}
+
+			if err = status.ErrorProto(reply.Error); err != nil {
+				zvelo.Errorf("query error (%s): %s\n", batch[i], err)
+				continue
+			}
+
+			requests[reply.RequestId] = batch[i]
+		}
+	}
+
+	var mu sync.Mutex
+	fetched := map[string]*msg.QueryResult{}
+
+	c.poller.Poll(ctx, requests, poller.HandlerFunc(func(_ context.Context, result *msg.QueryResult) poller.Requests {
+		if !zvelo.IsComplete(result) {
+			return nil
+		}
+
+		u := requests[result.RequestId]
+
+		if err := status.ErrorProto(result.QueryStatus.Error); err != nil {
+			zvelo.Errorf("result error (%s): %s\n", u, err)
+			return nil
+		}
+
+		if result.ResponseDataset == nil {
+			result.ResponseDataset = &msg.Dataset{}
+		}
+
+		mu.Lock()
+		fetched[u] = result
+		mu.Unlock()
+
+		return nil
+	}))
+
+	return fetched
+}
@@ -0,0 +1,172 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/options"
+	"zvelo.io/zapi/results"
+)
+
+func TestReadURLs(t *testing.T) {
+	urls, err := readURLs(strings.NewReader("# partners\nexample.com\n\nhttps://example.org/a\nHTTP://Example.COM:80/#top\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(urls) != 2 || urls[0] != "http://example.com/" || urls[1] != "https://example.org/a" {
+		t.Errorf("unexpected urls: %v", urls)
+	}
+
+	if _, err = readURLs(strings.NewReader("example.com\nhttp://\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zapi-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	name := filepath.Join(dir, "state", "watch_state.json")
+
+	s, err := loadState(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.URLs) != 0 {
+		t.Errorf("unexpected state: %+v", s)
+	}
+
+	checked := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	ds := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.NEWS_4}},
+		Malicious:      &msg.Dataset_Malicious{},
+	}
+
+	s.URLs["http://example.com"] = &entry{Dataset: ds, Checked: checked}
+
+	if err = s.save(name); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = loadState(name); err != nil {
+		t.Fatal(err)
+	}
+
+	e, ok := s.URLs["http://example.com"]
+	if !ok || !e.Dataset.Equal(ds) || !e.Checked.Equal(checked) || !e.Changed.IsZero() {
+		t.Errorf("unexpected state: %+v", e)
+	}
+}
+
+func TestEmit(t *testing.T) {
+	var received []map[string]interface{}
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		received = append(received, e)
+	}))
+	defer webhook.Close()
+
+	dir, err := ioutil.TempDir("", "zapi-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	c := cmd{
+		opts:     &options.Options{JSON: true},
+		webhook:  webhook.URL,
+		eventLog: filepath.Join(dir, "events.jsonl"),
+	}
+
+	e := event{
+		Time: time.Now(),
+		URL:  "http://example.com",
+		Change: results.Compare(
+			&msg.Dataset{
+				Categorization: &msg.Dataset_Categorization{},
+				Malicious:      &msg.Dataset_Malicious{},
+			},
+			&msg.Dataset{
+				Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.NEWS_4}},
+				Malicious:      &msg.Dataset_Malicious{Category: []msg.Category{msg.MAL_4}},
+			},
+		),
+	}
+
+	if err = c.emit(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 1 || received[0]["url"] != e.URL || received[0]["verdict_after"] != results.VerdictMalicious {
+		t.Errorf("unexpected webhook requests: %v", received)
+	}
+
+	if added, ok := received[0]["categories_added"].([]interface{}); !ok || len(added) != 1 || added[0] != "NEWS_4" {
+		t.Errorf("unexpected categories added: %v", received[0])
+	}
+
+	data, err := ioutil.ReadFile(c.eventLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"verdict_before":"CLEAN"`) {
+		t.Errorf("unexpected event log: %s", data)
+	}
+
+	webhook.Close()
+
+	if err = c.emit(context.Background(), e); err == nil {
+		t.Error("expected an error posting to a closed webhook")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	malicious := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.NEWS_4}},
+		Malicious:      &msg.Dataset_Malicious{Category: []msg.Category{msg.MAL_4}},
+	}
+
+	failed := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Error: &msg.Status{Code: int32(codes.Unavailable)}},
+		Malicious:      &msg.Dataset_Malicious{Error: &msg.Status{Code: int32(codes.Unavailable)}},
+	}
+
+	clean := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.NEWS_4}},
+		Malicious:      &msg.Dataset_Malicious{},
+	}
+
+	// a transient error keeps the last good datasets
+	ds := merge(malicious, failed)
+	if !ds.Equal(malicious) {
+		t.Errorf("unexpected dataset: %v", ds)
+	}
+
+	// so the flip to clean is still seen
+	if c := results.Compare(ds, merge(ds, clean)); !c.VerdictChanged() || c.VerdictBefore != results.VerdictMalicious {
+		t.Errorf("unexpected change: %+v", c)
+	}
+}
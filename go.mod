@@ -1,17 +1,25 @@
 module zvelo.io/zapi
 
 require (
+	github.com/andybalholm/brotli v1.0.2
 	github.com/coreos/go-oidc v2.0.0+incompatible
 	github.com/fatih/color v1.7.0
 	github.com/gogo/protobuf v1.1.1
+	github.com/graph-gophers/graphql-go v0.0.0-20181002230305-25d6d94fa7a7
 	github.com/mattn/go-isatty v0.0.4 // indirect
+	github.com/opentracing/opentracing-go v1.0.2
+	github.com/pkg/browser v0.0.0-20170505125900-c90ca0c84f15
 	github.com/pkg/errors v0.8.0
 	github.com/pquerna/cachecontrol v0.0.0-20180517163645-1555304b9b35 // indirect
 	github.com/segmentio/ksuid v1.0.2
 	github.com/urfave/cli v0.0.0-20180226030253-8e01ec4cd3e2
 	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793 // indirect
+	golang.org/x/net v0.0.0-20181004194319-68fc911561ed
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be
+	golang.org/x/sys v0.0.0-20181004145325-8469e314837c
 	google.golang.org/grpc v1.15.0
+	gopkg.in/square/go-jose.v2 v2.1.8
+	gopkg.in/yaml.v2 v2.4.0
 	zvelo.io/go-zapi v1.14.2
 	zvelo.io/httpsig v1.1.6
 	zvelo.io/msg v1.14.17
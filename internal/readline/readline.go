@@ -0,0 +1,337 @@
+// Package readline is a minimal line editor with history and completion for
+// interactive commands
+package readline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses ctrl-c
+var ErrInterrupt = errors.New("interrupt")
+
+// CompleteFunc is given the text before the cursor and returns the
+// candidates for completing the word that ends at the cursor along with that
+// partial word
+type CompleteFunc func(prefix string) (candidates []string, word string)
+
+// Editor reads lines from a terminal, allowing them to be edited, recalled
+// from history and completed. If the input is not a terminal, lines are read
+// as is without a prompt.
+type Editor struct {
+	History  []string
+	Complete CompleteFunc
+
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	terminal bool
+
+	// state of the line being edited
+	prompt string
+	buf    []rune
+	pos    int
+	offset int
+}
+
+// New returns an Editor that reads from in and writes to out
+func New(in *os.File, out io.Writer) *Editor {
+	fd := int(in.Fd())
+	e := newEditor(in, out, isTerminal(fd))
+	e.fd = fd
+	return e
+}
+
+func newEditor(in io.Reader, out io.Writer, terminal bool) *Editor {
+	return &Editor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		fd:       -1,
+		terminal: terminal,
+	}
+}
+
+// Terminal reports whether lines are read from a terminal
+func (e *Editor) Terminal() bool {
+	return e.terminal
+}
+
+// AddHistory appends line to the history unless it is empty or the same as
+// the most recent entry
+func (e *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if n := len(e.History); n > 0 && e.History[n-1] == line {
+		return
+	}
+
+	e.History = append(e.History, line)
+}
+
+// ReadLine reads a single line, displaying prompt when reading from a
+// terminal. It returns io.EOF when the input is closed, or the user presses
+// ctrl-d on an empty line, and ErrInterrupt when the user presses ctrl-c.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.terminal {
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = restore() }() // #nosec
+	}
+
+	return e.edit(prompt)
+}
+
+func (e *Editor) edit(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf = nil
+	e.pos = 0
+	e.offset = 0
+
+	// the current line is kept as the last entry while browsing the history
+	history := append(append([]string{}, e.History...), "")
+	histIdx := len(history) - 1
+
+	setLine := func(s string) {
+		e.buf = []rune(s)
+		e.pos = len(e.buf)
+	}
+
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.write("\r\n")
+			return string(e.buf), nil
+		case 3: // ctrl-c
+			e.write("^C\r\n")
+			return "", ErrInterrupt
+		case 4: // ctrl-d
+			if len(e.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.delete(e.pos)
+		case 1: // ctrl-a
+			e.pos = 0
+		case 5: // ctrl-e
+			e.pos = len(e.buf)
+		case 2: // ctrl-b
+			e.move(-1)
+		case 6: // ctrl-f
+			e.move(1)
+		case 11: // ctrl-k
+			e.buf = e.buf[:e.pos]
+		case 21: // ctrl-u
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case 23: // ctrl-w
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case 127, 8: // backspace
+			if e.pos > 0 {
+				e.pos--
+				e.delete(e.pos)
+			}
+		case '\t':
+			e.complete()
+		case 16, 14: // ctrl-p, ctrl-n
+			histIdx = e.browse(history, histIdx, r == 16, setLine)
+		case 27: // escape sequence
+			switch e.escape() {
+			case 'A':
+				histIdx = e.browse(history, histIdx, true, setLine)
+			case 'B':
+				histIdx = e.browse(history, histIdx, false, setLine)
+			case 'C':
+				e.move(1)
+			case 'D':
+				e.move(-1)
+			case 'H':
+				e.pos = 0
+			case 'F':
+				e.pos = len(e.buf)
+			case '~':
+				e.delete(e.pos)
+			}
+		default:
+			if r < ' ' || r == utf8.RuneError {
+				continue
+			}
+			e.insert(string(r))
+		}
+
+		e.refresh()
+	}
+}
+
+// escape reads the rest of an escape sequence and returns the key it
+// represents. home and end are returned as 'H' and 'F' and delete as '~'.
+func (e *Editor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+
+	if r < '0' || r > '9' {
+		return r
+	}
+
+	// sequences such as "\x1b[3~"
+	n := r
+	for {
+		if r, _, err = e.in.ReadRune(); err != nil || r == '~' {
+			break
+		}
+	}
+
+	switch n {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	case '3':
+		return '~'
+	}
+
+	return 0
+}
+
+func (e *Editor) browse(history []string, idx int, back bool, setLine func(string)) int {
+	history[idx] = string(e.buf)
+
+	switch {
+	case back && idx > 0:
+		idx--
+	case !back && idx < len(history)-1:
+		idx++
+	default:
+		return idx
+	}
+
+	setLine(history[idx])
+	return idx
+}
+
+func (e *Editor) move(n int) {
+	if e.pos += n; e.pos < 0 {
+		e.pos = 0
+	} else if e.pos > len(e.buf) {
+		e.pos = len(e.buf)
+	}
+}
+
+func (e *Editor) insert(s string) {
+	rs := []rune(s)
+	buf := make([]rune, 0, len(e.buf)+len(rs))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, rs...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(rs)
+}
+
+func (e *Editor) delete(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+
+	candidates, word := e.Complete(string(e.buf[:e.pos]))
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+
+	if len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		e.insert(prefix[len(word):])
+		return
+	}
+
+	// nothing more can be completed, so list the candidates
+	e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	e.offset = 0
+}
+
+// refresh redraws the line, scrolling it horizontally so that the cursor is
+// visible when it doesn't fit on the screen
+func (e *Editor) refresh() {
+	avail := 80
+	if e.fd >= 0 {
+		avail = width(e.fd)
+	}
+
+	if avail -= utf8.RuneCountInString(e.prompt) + 1; avail < 10 {
+		avail = 10
+	}
+
+	if e.pos < e.offset {
+		e.offset = e.pos
+	} else if e.pos > e.offset+avail {
+		e.offset = e.pos - avail
+	}
+
+	end := e.offset + avail
+	if end > len(e.buf) {
+		end = len(e.buf)
+	}
+
+	e.write(fmt.Sprintf("\r%s%s\x1b[K", e.prompt, string(e.buf[e.offset:end])))
+
+	if n := end - e.pos; n > 0 {
+		e.write(fmt.Sprintf("\x1b[%dD", n))
+	}
+}
+
+func (e *Editor) write(s string) {
+	_, _ = io.WriteString(e.out, s) // #nosec
+}
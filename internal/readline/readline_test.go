@@ -0,0 +1,117 @@
+package readline
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReadLineEditing(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"abc\r", "abc"},
+		{"abd\x7fc\r", "abc"},
+		{"bc\x01a\r", "abc"},
+		{"ac\x1b[Db\r", "abc"},
+		{"xabc\x01\x1b[3~\r", "abc"},
+		{"junk\x15abc\r", "abc"},
+		{"abc def\x17\x7f\r", "abc"},
+		{"héllo\r", "héllo"},
+	}
+
+	for _, tt := range tests {
+		e := newEditor(strings.NewReader(tt.input), ioutil.Discard, true)
+
+		got, err := e.ReadLine("> ")
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestReadLineHistory(t *testing.T) {
+	e := newEditor(strings.NewReader("\x1b[A\x1b[A\r\x10\x10\x0e\r"), ioutil.Discard, true)
+	e.AddHistory("first")
+	e.AddHistory("second")
+	e.AddHistory("second")
+
+	if len(e.History) != 2 {
+		t.Errorf("consecutive duplicates should not be added to history: %v", e.History)
+	}
+
+	for _, want := range []string{"first", "second"} {
+		got, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReadLineComplete(t *testing.T) {
+	e := newEditor(strings.NewReader("{ que\t\r{ q\t\t\r"), ioutil.Discard, true)
+	e.Complete = func(prefix string) ([]string, string) {
+		word := prefix[strings.LastIndex(prefix, " ")+1:]
+
+		var candidates []string
+		for _, c := range []string{"queryUrl", "queryContent"} {
+			if strings.HasPrefix(c, word) {
+				candidates = append(candidates, c)
+			}
+		}
+
+		return candidates, word
+	}
+
+	for _, want := range []string{"{ query", "{ query"} {
+		got, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReadLineEOFAndInterrupt(t *testing.T) {
+	e := newEditor(strings.NewReader("abc\x03\x04"), ioutil.Discard, true)
+
+	if _, err := e.ReadLine("> "); err != ErrInterrupt {
+		t.Errorf("expected ErrInterrupt, got %v", err)
+	}
+
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadLineNotTerminal(t *testing.T) {
+	e := newEditor(strings.NewReader("one\r\ntwo"), ioutil.Discard, false)
+
+	for _, want := range []string{"one", "two"} {
+		got, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package readline
+
+import "github.com/pkg/errors"
+
+func isTerminal(int) bool {
+	return false
+}
+
+func makeRaw(int) (func() error, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
+
+func width(int) int {
+	return 80
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+// NOTE: darwin doesn't define XDG directories, but the same layout is used
+// there so the cached graphql schema is in one predictable place on every unix
+
+package zvelo
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// https://standards.freedesktop.org/basedir-spec/basedir-spec-latest.html
+func DataDir(name string) string {
+	if dir := os.Getenv("SNAP_USER_COMMON"); dir != "" {
+		// the dir is already specific to the app, so don't append `name`
+		return dir
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, name)
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".local", "share", name)
+}
@@ -0,0 +1,118 @@
+package zvelo
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+)
+
+// trackingParams are query parameters that only identify where a visitor came
+// from and don't change the page that is returned
+var trackingParams = map[string]bool{
+	"gclid":   true,
+	"dclid":   true,
+	"fbclid":  true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_ga":     true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+func isTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// stripTrackingParams removes tracking parameters from a raw query, keeping
+// the order and encoding of the rest
+func stripTrackingParams(rawQuery string) string {
+	var keep []string
+
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+
+		name := param
+		if i := strings.Index(param, "="); i >= 0 {
+			name = param[:i]
+		}
+
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+
+		if !isTrackingParam(name) {
+			keep = append(keep, param)
+		}
+	}
+
+	return strings.Join(keep, "&")
+}
+
+// NormalizeURL returns the form of raw that is sent to zvelo-api. The scheme
+// and host are lowercased, international domain names are converted to
+// punycode, default ports and the fragment are removed and, if stripTracking
+// is set, so are tracking query parameters. urls without a scheme are assumed
+// to be http.
+func NormalizeURL(raw string, stripTracking bool) (string, error) {
+	raw = strings.TrimSpace(raw)
+
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid url %s", raw)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	host, port := u.Hostname(), u.Port()
+	if host == "" {
+		return "", errors.Errorf("invalid url %s: no host", raw)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if net.ParseIP(host) == nil {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", errors.Wrapf(err, "invalid host in url %s", raw)
+		}
+	}
+
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		// ipv6
+		host = "[" + host + "]"
+	}
+
+	if port != "" {
+		host += ":" + port
+	}
+
+	u.Host = host
+	u.Fragment = ""
+
+	if u.Path == "" && u.Opaque == "" {
+		u.Path = "/"
+	}
+
+	if stripTracking {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+		u.ForceQuery = false
+	}
+
+	return u.String(), nil
+}
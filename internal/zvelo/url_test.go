@@ -0,0 +1,38 @@
+package zvelo
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		in, out string
+		strip   bool
+	}{
+		{in: "example.com", out: "http://example.com/"},
+		{in: "HTTPS://WWW.Example.COM:443/Path?Q=1#frag", out: "https://www.example.com/Path?Q=1"},
+		{in: "http://example.com:80", out: "http://example.com/"},
+		{in: "https://example.com:80/", out: "https://example.com:80/"},
+		{in: "http://example.com./", out: "http://example.com/"},
+		{in: "http://bücher.example/", out: "http://xn--bcher-kva.example/"},
+		{in: "http://[::1]:80/a", out: "http://[::1]/a"},
+		{in: "http://[::1]:8080/a", out: "http://[::1]:8080/a"},
+		{in: "http://example.com/?utm_source=a&id=1&gclid=b", out: "http://example.com/?utm_source=a&id=1&gclid=b"},
+		{in: "http://example.com/?utm_source=a&id=1&gclid=b&UTM_Medium=c", out: "http://example.com/?id=1", strip: true},
+		{in: "http://example.com/?utm_source=a", out: "http://example.com/", strip: true},
+	}
+
+	for _, tt := range tests {
+		out, err := NormalizeURL(tt.in, tt.strip)
+		if err != nil {
+			t.Errorf("%s: %s", tt.in, err)
+			continue
+		}
+
+		if out != tt.out {
+			t.Errorf("%s: got %s, want %s", tt.in, out, tt.out)
+		}
+	}
+
+	if _, err := NormalizeURL("http:///path", false); err == nil {
+		t.Error("expected an error for a url without a host")
+	}
+}
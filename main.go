@@ -9,16 +9,23 @@ import (
 
 	"github.com/urfave/cli"
 
+	"zvelo.io/zapi/commands/bench"
 	"zvelo.io/zapi/commands/complete"
+	"zvelo.io/zapi/commands/diff"
 	"zvelo.io/zapi/commands/graphql"
 	"zvelo.io/zapi/commands/mock"
+	"zvelo.io/zapi/commands/policy"
 	"zvelo.io/zapi/commands/poll"
 	"zvelo.io/zapi/commands/query"
 	"zvelo.io/zapi/commands/receiver"
+	"zvelo.io/zapi/commands/report"
+	"zvelo.io/zapi/commands/serve"
 	"zvelo.io/zapi/commands/stream"
 	"zvelo.io/zapi/commands/suggest"
 	"zvelo.io/zapi/commands/token"
+	"zvelo.io/zapi/commands/watch"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
 )
 
 const name = "zapi"
@@ -28,7 +35,8 @@ var (
 	commit  string
 	date    string
 
-	app = cli.NewApp()
+	app  = cli.NewApp()
+	opts = options.New(name)
 )
 
 func init() {
@@ -39,20 +47,28 @@ func init() {
 	app.Usage = "client utility for zvelo api"
 	app.EnableBashCompletion = true
 	app.BashComplete = complete.Bash
+	app.Flags = opts.GlobalFlags()
+	app.After = func(*cli.Context) error { return opts.Close() }
 	app.Authors = []cli.Author{
 		{Name: "Joshua Rubin", Email: "jrubin@zvelo.com"},
 	}
 
 	app.Commands = append(app.Commands,
+		complete.BashCommand(bench.Command(opts)),
 		complete.BashCommand(complete.Command(name)),
-		complete.BashCommand(graphql.Command(name)),
+		complete.BashCommand(diff.Command(opts)),
+		complete.BashCommand(graphql.Command(opts)),
 		complete.BashCommand(mock.Command()),
-		complete.BashCommand(poll.Command(name)),
-		complete.BashCommand(query.Command(name)),
-		complete.BashCommand(receiver.Command(name)),
-		complete.BashCommand(suggest.Command(name)),
-		complete.BashCommand(stream.Command(name)),
-		complete.BashCommand(token.Command(name)),
+		complete.BashCommand(policy.Command(opts)),
+		complete.BashCommand(poll.Command(opts)),
+		complete.BashCommand(query.Command(opts)),
+		complete.BashCommand(receiver.Command(opts)),
+		complete.BashCommand(report.Command(opts)),
+		complete.BashCommand(serve.Command(opts)),
+		complete.BashCommand(suggest.Command(opts)),
+		complete.BashCommand(stream.Command(opts)),
+		complete.BashCommand(token.Command(opts)),
+		complete.BashCommand(watch.Command(opts)),
 	)
 }
 
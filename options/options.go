@@ -0,0 +1,311 @@
+package options
+
+import (
+	"context"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"zvelo.io/zapi/clients"
+	"zvelo.io/zapi/tokensourcer"
+	"zvelo.io/zapi/tracing"
+)
+
+// DefaultTimeout is the default value of the timeout option
+const DefaultTimeout = 15 * time.Minute
+
+// Options are shared by every command and may be given either before or after
+// the subcommand. Values given after the subcommand take precedence.
+type Options struct {
+	appName string
+
+	Debug              bool
+	InsecureSkipVerify bool
+	Trace              bool
+	Rest               bool
+	JSON               bool
+	Timeout            time.Duration
+	TraceFile          string
+	TraceEndpoint      string
+
+	timeoutSet    bool
+	tracer        *tracing.Tracer
+	span          opentracing.Span
+	ctx           context.Context
+	tokenSourcers []tokensourcer.TokenSourcer
+}
+
+func New(appName string) *Options {
+	return &Options{
+		appName: appName,
+		Timeout: DefaultTimeout,
+	}
+}
+
+func (o *Options) AppName() string {
+	return o.appName
+}
+
+// GlobalFlags returns the flags to be accepted before the subcommand
+func (o *Options) GlobalFlags() []cli.Flag {
+	return o.flags(true)
+}
+
+// Flag is the name of an option that a command can accept after the
+// subcommand
+type Flag string
+
+// The options that can be given after the subcommand
+const (
+	FlagDebug              Flag = "debug"
+	FlagInsecureSkipVerify Flag = "insecure-skip-verify"
+	FlagTrace              Flag = "trace"
+	FlagRest               Flag = "rest"
+	FlagJSON               Flag = "json"
+	FlagTimeout            Flag = "timeout"
+	FlagTraceFile          Flag = "trace-file"
+	FlagTraceEndpoint      Flag = "trace-endpoint"
+)
+
+// AllFlags are every option, for commands that make api requests and print
+// their results
+var AllFlags = []Flag{
+	FlagDebug,
+	FlagInsecureSkipVerify,
+	FlagTrace,
+	FlagRest,
+	FlagJSON,
+	FlagTimeout,
+	FlagTraceFile,
+	FlagTraceEndpoint,
+}
+
+// Flags returns the flags to be accepted after the subcommand. Commands only
+// accept the options they honor, so that their help doesn't advertise the
+// rest. They must be merged into o by the command's Before func, see Before.
+func (o *Options) Flags(names ...Flag) []cli.Flag {
+	want := map[string]bool{}
+	for _, name := range names {
+		want[string(name)] = true
+	}
+
+	var flags []cli.Flag
+
+	for _, flag := range o.flags(false) {
+		if want[flag.GetName()] {
+			flags = append(flags, flag)
+		}
+	}
+
+	return flags
+}
+
+func (o *Options) flags(global bool) []cli.Flag {
+	// the global flags are parsed directly into o. the command flags can't share
+	// the destinations since the command's flag set would reset them to their
+	// defaults, overwriting values given before the subcommand.
+	dest := func(b *bool) *bool {
+		if global {
+			return b
+		}
+		return nil
+	}
+
+	var timeout *time.Duration
+	if global {
+		timeout = &o.Timeout
+	}
+
+	str := func(s *string) *string {
+		if global {
+			return s
+		}
+		return nil
+	}
+
+	return []cli.Flag{
+		cli.BoolFlag{
+			Name:        "debug",
+			EnvVar:      "ZVELO_DEBUG",
+			Usage:       "enable debug logging",
+			Destination: dest(&o.Debug),
+		},
+		cli.BoolFlag{
+			Name:        "insecure-skip-verify",
+			Usage:       "accept any certificate presented by the server and any host name in that certificate. only for testing.",
+			Destination: dest(&o.InsecureSkipVerify),
+		},
+		cli.BoolFlag{
+			Name:        "trace",
+			EnvVar:      "ZVELO_TRACE",
+			Usage:       "request a trace to be generated for each request",
+			Destination: dest(&o.Trace),
+		},
+		cli.BoolFlag{
+			Name:        "rest",
+			EnvVar:      "ZVELO_REST",
+			Usage:       "Use REST instead of gRPC for api requests",
+			Destination: dest(&o.Rest),
+		},
+		cli.BoolFlag{
+			Name:        "json",
+			EnvVar:      "ZVELO_JSON",
+			Usage:       "Print raw JSON response",
+			Destination: dest(&o.JSON),
+		},
+		cli.DurationFlag{
+			Name:        "timeout",
+			EnvVar:      "ZVELO_TIMEOUT",
+			Usage:       "maximum amount of time to wait for results to complete",
+			Value:       DefaultTimeout,
+			Destination: timeout,
+		},
+		cli.StringFlag{
+			Name:        "trace-file",
+			EnvVar:      "ZVELO_TRACE_FILE",
+			Usage:       "record client side spans of api calls and append them to this file as json lines",
+			Destination: str(&o.TraceFile),
+		},
+		cli.StringFlag{
+			Name:        "trace-endpoint",
+			EnvVar:      "ZVELO_TRACE_ENDPOINT",
+			Usage:       "record client side spans of api calls and export them to this OpenTelemetry collector using otlp/http, e.g. localhost:4318",
+			Destination: str(&o.TraceEndpoint),
+		},
+	}
+}
+
+// Before returns a cli.BeforeFunc that merges options given after the
+// subcommand into o and then calls next, if it is not nil
+func (o *Options) Before(next cli.BeforeFunc) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		for name, b := range map[string]*bool{
+			"debug":                &o.Debug,
+			"insecure-skip-verify": &o.InsecureSkipVerify,
+			"trace":                &o.Trace,
+			"rest":                 &o.Rest,
+			"json":                 &o.JSON,
+		} {
+			if c.IsSet(name) {
+				*b = c.Bool(name)
+			}
+		}
+
+		for name, s := range map[string]*string{
+			"trace-file":     &o.TraceFile,
+			"trace-endpoint": &o.TraceEndpoint,
+		} {
+			if c.IsSet(name) {
+				*s = c.String(name)
+			}
+		}
+
+		if c.IsSet("timeout") {
+			o.Timeout = c.Duration("timeout")
+		}
+
+		o.timeoutSet = c.GlobalIsSet("timeout") || c.IsSet("timeout")
+
+		if err := o.setupTracing(c.Command.FullName()); err != nil {
+			return err
+		}
+
+		// only the flags of the command being run have been parsed, the token
+		// sourcers of the other commands still have their defaults
+		for _, ts := range o.tokenSourcers {
+			if err := ts.Setup(o.Context()); err != nil {
+				return err
+			}
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		return next(c)
+	}
+}
+
+// setupTracing installs a tracing.Tracer as the global tracer if spans are to
+// be exported and starts the span of the command
+func (o *Options) setupTracing(command string) error {
+	if o.tracer != nil || (o.TraceFile == "" && o.TraceEndpoint == "") {
+		return nil
+	}
+
+	if o.TraceFile != "" && o.TraceEndpoint != "" {
+		return errors.New("only one of trace-file and trace-endpoint may be given")
+	}
+
+	var exporter tracing.Exporter
+	var err error
+
+	if o.TraceFile != "" {
+		exporter, err = tracing.FileExporter(o.TraceFile)
+	} else {
+		exporter, err = tracing.OTLPExporter(o.TraceEndpoint, o.appName, o.InsecureSkipVerify)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	o.tracer = tracing.New(exporter)
+	opentracing.SetGlobalTracer(o.tracer)
+
+	o.span, o.ctx = opentracing.StartSpanFromContext(context.Background(), "zapi",
+		opentracing.Tag{Key: "zvelo.command", Value: command},
+	)
+
+	return nil
+}
+
+// Context returns the context that commands should derive theirs from. When
+// spans are being exported, it carries the span of the command.
+func (o *Options) Context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+
+	return o.ctx
+}
+
+// Close finishes the span of the command, exports any spans that have not yet
+// been exported and closes the trace file. It should be called once the
+// command has completed.
+func (o *Options) Close() error {
+	if o.tracer == nil {
+		return nil
+	}
+
+	o.span.Finish()
+
+	return errors.Wrap(o.tracer.Close(), "error exporting trace")
+}
+
+// WithTimeout returns a copy of parent that is canceled after the timeout
+// option has elapsed
+func (o *Options) WithTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, o.Timeout)
+}
+
+// TimeoutSet reports whether the timeout option was explicitly given
+func (o *Options) TimeoutSet() bool {
+	return o.timeoutSet
+}
+
+// TokenSourcer returns a tokensourcer.TokenSourcer that requests the given
+// scopes by default. Its flags are validated by Before.
+func (o *Options) TokenSourcer(scope ...string) tokensourcer.TokenSourcer {
+	ts := tokensourcer.New(o.appName, &o.Debug, &o.InsecureSkipVerify, scope...)
+	o.tokenSourcers = append(o.tokenSourcers, ts)
+	return ts
+}
+
+// Clients returns clients.Clients using a tokensourcer.TokenSourcer that
+// requests the given scopes by default
+func (o *Options) Clients(scope ...string) clients.Clients {
+	return clients.New(o.TokenSourcer(scope...), &o.Debug, &o.InsecureSkipVerify)
+}
@@ -0,0 +1,76 @@
+package options
+
+import (
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func run(t *testing.T, args ...string) *Options {
+	o := New("zapi-test")
+
+	app := cli.NewApp()
+	app.Flags = o.GlobalFlags()
+	app.Commands = []cli.Command{{
+		Name:   "cmd",
+		Flags:  o.Flags(AllFlags...),
+		Before: o.Before(nil),
+		Action: func(*cli.Context) error { return nil },
+	}}
+
+	if err := app.Run(append([]string{"zapi"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+
+	return o
+}
+
+func TestOptionsBeforeAndAfterSubcommand(t *testing.T) {
+	o := run(t, "-debug", "-timeout", "1m", "cmd", "-json", "-trace")
+
+	if !o.Debug || !o.JSON || !o.Trace || o.Rest || o.InsecureSkipVerify {
+		t.Errorf("unexpected options: %+v", o)
+	}
+
+	if o.Timeout != time.Minute || !o.TimeoutSet() {
+		t.Errorf("unexpected timeout: %s (set: %t)", o.Timeout, o.TimeoutSet())
+	}
+}
+
+func TestOptionsAfterSubcommandTakesPrecedence(t *testing.T) {
+	o := run(t, "-timeout", "1m", "cmd", "-timeout", "2m")
+
+	if o.Timeout != 2*time.Minute {
+		t.Errorf("unexpected timeout: %s", o.Timeout)
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	o := run(t, "cmd")
+
+	if o.Debug || o.JSON || o.Trace || o.Rest || o.InsecureSkipVerify {
+		t.Errorf("unexpected options: %+v", o)
+	}
+
+	if o.Timeout != DefaultTimeout || o.TimeoutSet() {
+		t.Errorf("unexpected timeout: %s (set: %t)", o.Timeout, o.TimeoutSet())
+	}
+}
+
+func TestOptionsFlagsSubset(t *testing.T) {
+	o := New("zapi-test")
+
+	flags := o.Flags(FlagTimeout, FlagJSON)
+	if len(flags) != 2 || flags[0].GetName() != "json" || flags[1].GetName() != "timeout" {
+		t.Errorf("unexpected flags: %v", flags)
+	}
+
+	if flags := o.Flags(); len(flags) != 0 {
+		t.Errorf("unexpected flags: %v", flags)
+	}
+
+	if flags := o.Flags(AllFlags...); len(flags) != len(o.GlobalFlags()) {
+		t.Errorf("expected %d flags, got %d", len(o.GlobalFlags()), len(flags))
+	}
+}
@@ -0,0 +1,51 @@
+package policy
+
+import (
+	"github.com/urfave/cli"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// Option adds a --policy flag to commands that print results so that the
+// decision for each result can be printed with it
+type Option struct {
+	file   string
+	policy *Policy
+}
+
+// Flags returns the flags used by o
+func (o *Option) Flags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:        "policy",
+			EnvVar:      "ZVELO_POLICY",
+			Usage:       "yaml or json policy file used to decide whether each result should be allowed, blocked or warned about. with json output each result is printed as an object with the result and its policy decision",
+			Destination: &o.file,
+		},
+	}
+}
+
+// Setup loads the policy, if one was given, and must be called before Decide
+func (o *Option) Setup() error {
+	if o.file == "" {
+		return nil
+	}
+
+	p, err := Load(o.file)
+	if err != nil {
+		return err
+	}
+
+	o.policy = p
+	return nil
+}
+
+// Decide returns the decision for result, or nil if no policy was given
+func (o *Option) Decide(result *msg.QueryResult) *Decision {
+	if o.policy == nil {
+		return nil
+	}
+
+	d := o.policy.Evaluate(result)
+	return &d
+}
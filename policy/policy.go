@@ -0,0 +1,412 @@
+// Package policy turns the datasets of query results into allow, block or warn
+// decisions using declarative rules
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/msg/status"
+)
+
+// Action is the decision made for a url
+type Action string
+
+// The actions that a rule can take
+const (
+	Allow Action = "allow"
+	Block Action = "block"
+	Warn  Action = "warn"
+)
+
+func (a Action) valid() bool {
+	switch a {
+	case Allow, Block, Warn:
+		return true
+	}
+	return false
+}
+
+// anyValue matches any category in categories and malicious, or any language
+const anyValue = "any"
+
+// DefaultRule is the name of the rule of decisions made with the default
+// action
+const DefaultRule = "default"
+
+// Decision is the action taken for a result and the name of the rule that
+// made it
+type Decision struct {
+	Action Action `json:"action"`
+	Rule   string `json:"rule"`
+}
+
+func (d Decision) String() string {
+	return fmt.Sprintf("%s (%s)", d.Action, d.Rule)
+}
+
+// Rule is a set of conditions and the action to take when a result matches
+// them. Each condition matches if the result has any of its values, a rule
+// matches if all of its conditions do. Conditions that aren't given always
+// match.
+type Rule struct {
+	Name     string `json:"name" yaml:"name"`
+	Action   Action `json:"action" yaml:"action"`
+	Priority int    `json:"priority" yaml:"priority"`
+
+	// Categories are the names of categories, or any to match results
+	// with any category
+	Categories []string `json:"categories" yaml:"categories"`
+
+	// Malicious are the names of malicious categories, or any to match
+	// results with a MALICIOUS verdict
+	Malicious []string `json:"malicious" yaml:"malicious"`
+
+	// Languages are language codes
+	Languages []string `json:"languages" yaml:"languages"`
+
+	// FetchCodes are http status codes, or classes of them like 4xx
+	FetchCodes []FetchCode `json:"fetch_codes" yaml:"fetch_codes"`
+
+	// Hosts restrict the rule to urls with these hosts or their subdomains
+	Hosts []string `json:"hosts" yaml:"hosts"`
+
+	categories, malicious map[msg.Category]bool
+	anyCategory           bool
+	anyMalicious          bool
+}
+
+// Override takes an action for every url with a host, or a subdomain of it,
+// regardless of the rules
+type Override struct {
+	Host   string `json:"host" yaml:"host"`
+	Action Action `json:"action" yaml:"action"`
+}
+
+// FetchCode is an http status code, like 404, or class of them, like 4xx
+type FetchCode string
+
+// UnmarshalJSON accepts both numbers and strings
+func (f *FetchCode) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err == nil {
+		*f = FetchCode(n.String())
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	*f = FetchCode(s)
+	return nil
+}
+
+func (f FetchCode) valid() bool {
+	s := strings.ToLower(string(f))
+
+	if len(s) == 3 && s[0] >= '1' && s[0] <= '5' && s[1:] == "xx" {
+		return true
+	}
+
+	n, err := strconv.Atoi(s)
+	return err == nil && n >= 100 && n <= 599
+}
+
+func (f FetchCode) match(code int32) bool {
+	s := strings.ToLower(string(f))
+
+	if strings.HasSuffix(s, "xx") {
+		return code/100 == int32(s[0]-'0')
+	}
+
+	return s == strconv.Itoa(int(code))
+}
+
+// Policy is a set of rules and host overrides
+type Policy struct {
+	// Default is the action to take when no rule matches, allow if not given
+	Default   Action     `json:"default" yaml:"default"`
+	Rules     []Rule     `json:"rules" yaml:"rules"`
+	Overrides []Override `json:"overrides" yaml:"overrides"`
+}
+
+// Load reads a policy from the file name
+func Load(name string) (*Policy, error) {
+	data, err := ioutil.ReadFile(name) // #nosec
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading policy %s", name)
+	}
+
+	return p, nil
+}
+
+// Parse parses a policy written in json or yaml
+func Parse(data []byte) (*Policy, error) {
+	var p Policy
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+		if err := yaml.UnmarshalStrict(data, &p); err != nil {
+			return nil, err
+		}
+	} else {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(&p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.compile(); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+func parseCategories(names []string) (map[msg.Category]bool, bool, error) {
+	cats := map[msg.Category]bool{}
+	anyCat := false
+
+	for _, name := range names {
+		if strings.EqualFold(name, anyValue) {
+			anyCat = true
+			continue
+		}
+
+		cat := msg.ParseCategory(name)
+		if cat == msg.UNKNOWN_CATEGORY {
+			return nil, false, errors.Errorf("invalid category: %s", name)
+		}
+
+		cats[cat] = true
+	}
+
+	return cats, anyCat, nil
+}
+
+// compile validates the policy and prepares it for evaluation
+func (p *Policy) compile() error {
+	if p.Default == "" {
+		p.Default = Allow
+	}
+
+	if !p.Default.valid() {
+		return errors.Errorf("invalid default action: %s", p.Default)
+	}
+
+	names := map[string]bool{}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		if names[r.Name] || r.Name == DefaultRule {
+			return errors.Errorf("duplicate rule name: %s", r.Name)
+		}
+		names[r.Name] = true
+
+		if !r.Action.valid() {
+			return errors.Errorf("%s: invalid action: %q", r.Name, r.Action)
+		}
+
+		var err error
+
+		if r.categories, r.anyCategory, err = parseCategories(r.Categories); err != nil {
+			return errors.Wrap(err, r.Name)
+		}
+
+		if r.malicious, r.anyMalicious, err = parseCategories(r.Malicious); err != nil {
+			return errors.Wrap(err, r.Name)
+		}
+
+		for _, f := range r.FetchCodes {
+			if !f.valid() {
+				return errors.Errorf("%s: invalid fetch code: %s", r.Name, f)
+			}
+		}
+
+		for j, host := range r.Hosts {
+			r.Hosts[j] = normalizeHost(host)
+		}
+	}
+
+	// the highest priority first, rules with the same priority are kept in
+	// the order they were given
+	sort.SliceStable(p.Rules, func(i, j int) bool {
+		return p.Rules[i].Priority > p.Rules[j].Priority
+	})
+
+	for i := range p.Overrides {
+		o := &p.Overrides[i]
+
+		if o.Host = normalizeHost(o.Host); o.Host == "" {
+			return errors.New("overrides must have a host")
+		}
+
+		if !o.Action.valid() {
+			return errors.Errorf("override %s: invalid action: %q", o.Host, o.Action)
+		}
+	}
+
+	// the most specific host first
+	sort.SliceStable(p.Overrides, func(i, j int) bool {
+		return len(p.Overrides[i].Host) > len(p.Overrides[j].Host)
+	})
+
+	return nil
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), "."), "*.")
+}
+
+// hostMatches returns true if host is pattern or a subdomain of it
+func hostMatches(host, pattern string) bool {
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+func resultHost(result *msg.QueryResult) string {
+	u := result.Url
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+
+	p, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(strings.ToLower(p.Hostname()), ".")
+}
+
+func matchCategories(cats []msg.Category, want map[msg.Category]bool, anyCat bool) bool {
+	if len(want) == 0 && !anyCat {
+		return true
+	}
+
+	if anyCat && len(cats) > 0 {
+		return true
+	}
+
+	for _, cat := range cats {
+		if want[cat] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Rule) matches(host string, result *msg.QueryResult) bool {
+	ds := result.ResponseDataset
+	if ds == nil {
+		ds = &msg.Dataset{}
+	}
+
+	if len(r.Hosts) > 0 {
+		var ok bool
+		for _, pattern := range r.Hosts {
+			if ok = hostMatches(host, pattern); ok {
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(r.Categories) > 0 {
+		if ds.Categorization == nil || !matchCategories(ds.Categorization.Value, r.categories, r.anyCategory) {
+			return false
+		}
+	}
+
+	if len(r.Malicious) > 0 {
+		if ds.Malicious == nil || !matchCategories(ds.Malicious.Category, r.malicious, r.anyMalicious) {
+			return false
+		}
+	}
+
+	if len(r.Languages) > 0 {
+		if ds.Language == nil || ds.Language.Code == "" {
+			return false
+		}
+
+		var ok bool
+		for _, lang := range r.Languages {
+			if ok = strings.EqualFold(lang, anyValue) || strings.EqualFold(lang, ds.Language.Code); ok {
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	if len(r.FetchCodes) > 0 {
+		if result.QueryStatus == nil {
+			return false
+		}
+
+		var ok bool
+		for _, f := range r.FetchCodes {
+			if ok = f.match(result.QueryStatus.FetchCode); ok {
+				break
+			}
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Evaluate returns the decision for result. Host overrides are checked first,
+// then the rules from the highest priority to the lowest. If nothing matches,
+// or the result has an error, the default action is taken.
+func (p *Policy) Evaluate(result *msg.QueryResult) Decision {
+	host := resultHost(result)
+
+	for _, o := range p.Overrides {
+		if hostMatches(host, o.Host) {
+			return Decision{Action: o.Action, Rule: "override " + o.Host}
+		}
+	}
+
+	if result.QueryStatus != nil && status.ErrorProto(result.QueryStatus.Error) != nil {
+		return Decision{Action: p.Default, Rule: DefaultRule}
+	}
+
+	for i := range p.Rules {
+		if p.Rules[i].matches(host, result) {
+			return Decision{Action: p.Rules[i].Action, Rule: p.Rules[i].Name}
+		}
+	}
+
+	return Decision{Action: p.Default, Rule: DefaultRule}
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+const testPolicy = `
+default: allow
+rules:
+  - name: malware
+    action: block
+    priority: 100
+    malicious: [any]
+  - name: gambling
+    action: block
+    categories: [GAMBLING]
+  - name: news
+    action: warn
+    categories: [NEWS_4, SPORTS_4]
+    languages: [en]
+  - name: internal errors
+    action: warn
+    priority: -1
+    fetch_codes: [5xx, 404]
+  - name: local news
+    action: allow
+    priority: 10
+    categories: [NEWS_4]
+    hosts: [example.net]
+overrides:
+  - host: example.com
+    action: block
+  - host: Safe.Example.com.
+    action: allow
+`
+
+type testResult struct {
+	url       string
+	fetchCode int32
+	errCode   int32
+	lang      string
+	malicious []msg.Category
+	cats      []msg.Category
+}
+
+func (r testResult) result() *msg.QueryResult {
+	ret := msg.QueryResult{
+		Url: r.url,
+		ResponseDataset: &msg.Dataset{
+			Categorization: &msg.Dataset_Categorization{Value: r.cats},
+			Malicious:      &msg.Dataset_Malicious{Category: r.malicious},
+			Language:       &msg.Dataset_Language{Code: r.lang},
+		},
+		QueryStatus: &msg.QueryStatus{
+			Complete:  true,
+			FetchCode: r.fetchCode,
+		},
+	}
+
+	if r.errCode != 0 {
+		ret.QueryStatus.Error = &msg.Status{Code: r.errCode}
+	}
+
+	return &ret
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		result   testResult
+		expected Decision
+	}{
+		{testResult{url: "http://example.org/"}, Decision{Allow, DefaultRule}},
+		{testResult{url: "http://example.org/", malicious: []msg.Category{msg.MAL_4}, cats: []msg.Category{msg.GAMBLING_4}}, Decision{Block, "malware"}},
+		{testResult{url: "http://example.org/", cats: []msg.Category{msg.GAMBLING_4}}, Decision{Block, "gambling"}},
+		{testResult{url: "http://example.org/", cats: []msg.Category{msg.SPORTS_4}, lang: "EN"}, Decision{Warn, "news"}},
+		{testResult{url: "http://example.org/", cats: []msg.Category{msg.SPORTS_4}, lang: "de"}, Decision{Allow, DefaultRule}},
+		{testResult{url: "http://www.example.net/", cats: []msg.Category{msg.NEWS_4}, lang: "en"}, Decision{Allow, "local news"}},
+		{testResult{url: "http://notexample.net/", cats: []msg.Category{msg.NEWS_4}, lang: "en"}, Decision{Warn, "news"}},
+		{testResult{url: "example.org/a", fetchCode: 503}, Decision{Warn, "internal errors"}},
+		{testResult{url: "example.org/a", fetchCode: 404}, Decision{Warn, "internal errors"}},
+		{testResult{url: "example.org/a", fetchCode: 403}, Decision{Allow, DefaultRule}},
+		{testResult{url: "example.org/a", errCode: 5, cats: []msg.Category{msg.GAMBLING_4}}, Decision{Allow, DefaultRule}},
+		{testResult{url: "https://a.example.com:8443/"}, Decision{Block, "override example.com"}},
+		{testResult{url: "https://a.safe.example.com/", malicious: []msg.Category{msg.MAL_4}}, Decision{Allow, "override safe.example.com"}},
+	} {
+		if d := p.Evaluate(tt.result.result()); d != tt.expected {
+			t.Errorf("%+v: expected %s, got %s", tt.result, tt.expected, d)
+		}
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	p, err := Parse([]byte(`{"default": "warn", "rules": [{"action": "block", "fetch_codes": [404]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := p.Evaluate(testResult{fetchCode: 404}.result()); d != (Decision{Block, "rule 1"}) {
+		t.Errorf("unexpected decision: %s", d)
+	}
+
+	if d := p.Evaluate(testResult{}.result()); d != (Decision{Warn, DefaultRule}) {
+		t.Errorf("unexpected decision: %s", d)
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	p, err := Parse([]byte(`
+# comment
+default: warn   # trailing comment
+rules:
+- name: don't allow news   # blocks news
+  action: block
+  categories: [NEWS_4]
+- name: 2019
+  action: "block"  # it's quoted
+  fetch_codes:
+    - 404
+    - 5xx
+overrides: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		result   testResult
+		expected Decision
+	}{
+		{testResult{cats: []msg.Category{msg.NEWS_4}}, Decision{Block, "don't allow news"}},
+		{testResult{fetchCode: 503}, Decision{Block, "2019"}},
+		{testResult{fetchCode: 200}, Decision{Warn, DefaultRule}},
+	} {
+		if d := p.Evaluate(tt.result.result()); d != tt.expected {
+			t.Errorf("%+v: expected %s, got %s", tt.result, tt.expected, d)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for data, expected := range map[string]string{
+		"default: deny":                                                 "invalid default action: deny",
+		"rules:\n- action: deny":                                        `rule 1: invalid action: "deny"`,
+		"rules:\n- action: block\n  categories: [NOPE]":                 "rule 1: invalid category: NOPE",
+		"rules:\n- action: block\n  fetch_codes: [6xx]":                 "rule 1: invalid fetch code: 6xx",
+		"rules:\n- name: a\n  action: block\n- name: a\n  action: warn": "duplicate rule name: a",
+		"rules:\n- action: block\n  category: [NEWS]":                   "field category not found",
+		"overrides:\n- action: block":                                   "overrides must have a host",
+	} {
+		_, err := Parse([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected error %q, got %v", data, expected, err)
+		}
+	}
+}
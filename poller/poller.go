@@ -4,8 +4,13 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 
 	"google.golang.org/grpc/metadata"
@@ -14,6 +19,7 @@ import (
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/clients"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/options"
 	"zvelo.io/zapi/results"
 )
 
@@ -29,30 +35,45 @@ func (f HandlerFunc) Result(ctx context.Context, results *msg.QueryResult) Reque
 
 var _ Handler = HandlerFunc(nil)
 
+// ErrorHandler is a Handler that is also told when polling for a request
+// fails. The request is not polled for again.
+type ErrorHandler interface {
+	Handler
+	PollError(ctx context.Context, reqID string, err error)
+}
+
 // Requests is a map of request id to url
 type Requests map[string]string
 
+// The transports that can be used to make requests
+const (
+	TransportGRPC    = "grpc"
+	TransportREST    = "rest"
+	TransportGraphQL = "graphql"
+)
+
 type Poller interface {
 	Poll(ctx context.Context, requests Requests, fn Handler)
 	Flags() []cli.Flag
 	Once() bool
+	PollInterval() time.Duration
+	Query(ctx context.Context, req *msg.QueryRequests, skipCache bool) (*msg.QueryReplies, error)
+	Setup() error
+	Transport() string
 }
 
 type poller struct {
-	debug   *bool
-	rest    *bool
-	trace   *bool
+	opts    *options.Options
 	clients clients.Clients
 
 	pollInterval time.Duration
 	once         bool
+	transport    string
 }
 
-func New(debug, rest, trace *bool, clients clients.Clients) Poller {
+func New(opts *options.Options, clients clients.Clients) Poller {
 	return &poller{
-		debug:   debug,
-		rest:    rest,
-		trace:   trace,
+		opts:    opts,
 		clients: clients,
 	}
 }
@@ -72,16 +93,61 @@ func (p *poller) Flags() []cli.Flag {
 			Usage:       "make just a single poll request",
 			Destination: &p.once,
 		},
+		cli.StringFlag{
+			Name:        "transport",
+			EnvVar:      "ZVELO_TRANSPORT",
+			Usage:       "transport to use for api requests (grpc, rest or graphql), default: grpc, or rest if --rest is given",
+			Destination: &p.transport,
+		},
+	}
+}
+
+// Setup validates the flags and must be called before Poll
+func (p *poller) Setup() error {
+	switch p.transport {
+	case "", TransportGRPC, TransportREST, TransportGraphQL:
+		return nil
+	}
+
+	return errors.Errorf("invalid transport: %s", p.transport)
+}
+
+// Transport returns the transport to use for api requests. --transport takes
+// precedence over --rest.
+func (p *poller) Transport() string {
+	if p.transport != "" {
+		return p.transport
 	}
+
+	if p.opts.Rest {
+		return TransportREST
+	}
+
+	return TransportGRPC
 }
 
 func (p *poller) Once() bool {
 	return p.once
 }
 
+// PollInterval returns how long to wait between polls for a result
+func (p *poller) PollInterval() time.Duration {
+	return p.pollInterval
+}
+
 func (p *poller) Poll(ctx context.Context, requests Requests, h Handler) {
+	// spans lasting from the first poll for each request until it is complete
+	spans := map[string]opentracing.Span{}
+
+	defer func() {
+		for _, span := range spans {
+			span.SetTag("complete", false)
+			span.Finish()
+		}
+	}()
+
 	// do one poll immediately
-	requests = p.pollRequests(ctx, requests, h)
+	requests = p.pollRequests(ctx, requests, h, spans)
 
 	if p.once || len(requests) == 0 {
 		return
@@ -93,7 +159,7 @@ func (p *poller) Poll(ctx context.Context, requests Requests, h Handler) {
 	for {
 		select {
 		case <-ticker.C:
-			if requests = p.pollRequests(ctx, requests, h); len(requests) == 0 {
+			if requests = p.pollRequests(ctx, requests, h, spans); len(requests) == 0 {
 				return
 			}
 		case <-ctx.Done():
@@ -102,16 +168,41 @@ func (p *poller) Poll(ctx context.Context, requests Requests, h Handler) {
 	}
 }
 
-func (p *poller) pollRequests(ctx context.Context, requests Requests, h Handler) Requests {
+func (p *poller) pollRequests(ctx context.Context, requests Requests, h Handler, spans map[string]opentracing.Span) Requests {
 	stillPending := Requests{}
 
 	for reqID, url := range requests {
-		newRequests, err := p.pollRequest(ctx, reqID, url, h)
+		span, ok := spans[reqID]
+		if !ok {
+			span, _ = opentracing.StartSpanFromContext(ctx, "poll",
+				opentracing.Tag{Key: "zvelo.request_id", Value: reqID},
+				opentracing.Tag{Key: "zvelo.url", Value: url},
+				opentracing.Tag{Key: "zvelo.transport", Value: p.Transport()},
+			)
+			spans[reqID] = span
+		}
+
+		newRequests, err := p.pollRequest(opentracing.ContextWithSpan(ctx, span), reqID, url, h)
 		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.String("event", "error"), log.Error(err))
+			span.Finish()
+			delete(spans, reqID)
+
 			zvelo.Errorf("%s\n", err)
+
+			if eh, ok := h.(ErrorHandler); ok {
+				eh.PollError(ctx, reqID, err)
+			}
 			continue
 		}
 
+		if _, pending := newRequests[reqID]; !pending {
+			span.SetTag("complete", true)
+			span.Finish()
+			delete(spans, reqID)
+		}
+
 		for reqID, url := range newRequests {
 			stillPending[reqID] = url
 		}
@@ -121,7 +212,7 @@ func (p *poller) pollRequests(ctx context.Context, requests Requests, h Handler)
 }
 
 func (p *poller) pollRequest(ctx context.Context, reqID, url string, h Handler) (Requests, error) {
-	if *p.debug {
+	if p.opts.Debug {
 		if url == "" {
 			fmt.Fprintf(os.Stderr, "polling for: %s\n", reqID) // #nosec
 		} else {
@@ -130,8 +221,12 @@ func (p *poller) pollRequest(ctx context.Context, reqID, url string, h Handler)
 	}
 
 	pollFn := p.pollGRPC
-	if *p.rest {
+
+	switch p.Transport() {
+	case TransportREST:
 		pollFn = p.pollREST
+	case TransportGraphQL:
+		pollFn = p.pollGraphQL
 	}
 
 	result, err := pollFn(ctx, reqID)
@@ -139,6 +234,11 @@ func (p *poller) pollRequest(ctx context.Context, reqID, url string, h Handler)
 		return nil, err
 	}
 
+	if result.Url == "" && strings.Contains(url, "://") {
+		// graphql results don't include the url
+		result.Url = url
+	}
+
 	newRequests := Requests{}
 
 	if !zvelo.IsComplete(result) {
@@ -153,7 +253,7 @@ func (p *poller) pollRequest(ctx context.Context, reqID, url string, h Handler)
 }
 
 func (p *poller) pollREST(ctx context.Context, reqID string) (*msg.QueryResult, error) {
-	return pollREST(ctx, p.clients.RESTv1(), reqID, *p.debug, *p.trace)
+	return pollREST(ctx, p.clients.RESTv1(), reqID, p.opts.Debug, p.opts.Trace)
 }
 
 func pollREST(ctx context.Context, client zapi.RESTv1Client, reqID string, debug, trace bool) (*msg.QueryResult, error) {
@@ -172,7 +272,7 @@ func pollREST(ctx context.Context, client zapi.RESTv1Client, reqID string, debug
 }
 
 func (p *poller) pollGRPC(ctx context.Context, reqID string) (*msg.QueryResult, error) {
-	if *p.trace {
+	if p.opts.Trace {
 		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
 	}
 
@@ -186,3 +286,16 @@ func (p *poller) pollGRPC(ctx context.Context, reqID string) (*msg.QueryResult,
 
 	return result, err
 }
+
+func (p *poller) pollGraphQL(ctx context.Context, reqID string) (*msg.QueryResult, error) {
+	if p.opts.Trace {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+	}
+
+	client, err := p.clients.GraphQLv1()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Result(ctx, reqID)
+}
@@ -0,0 +1,69 @@
+package poller
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+
+	"zvelo.io/msg/mock"
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/results"
+)
+
+// Query submits the query using the transport. When skipCache is set,
+// zvelo-api is instructed not to check its cache for results.
+func (p *poller) Query(ctx context.Context, req *msg.QueryRequests, skipCache bool) (*msg.QueryReplies, error) {
+	if skipCache {
+		ctx = metadata.AppendToOutgoingContext(ctx, "zvelo-no-cache", "1")
+	}
+
+	if p.opts.Trace {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-client-trace-id", results.TracingTag().String())
+	}
+
+	switch p.Transport() {
+	case TransportREST:
+		return p.clients.RESTv1().Query(ctx, req)
+	case TransportGraphQL:
+		client, err := p.clients.GraphQLv1()
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Query(ctx, req)
+	}
+
+	client, err := p.clients.GRPCv1(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Query(ctx, req)
+}
+
+// MockOptions returns the context options that tell the mock server to
+// respond with the categories, and with the malicious categories and a
+// MALICIOUS verdict
+func MockOptions(categories, malicious []string) ([]mock.ContextOption, error) {
+	var opts []mock.ContextOption
+
+	cats, err := results.ParseCategories(categories)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cats) > 0 {
+		opts = append(opts, mock.WithCategories(cats...))
+	}
+
+	malcats, err := results.ParseCategories(malicious)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(malcats) > 0 {
+		opts = append(opts, mock.WithMalicious(malcats...))
+	}
+
+	return opts, nil
+}
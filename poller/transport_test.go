@@ -0,0 +1,174 @@
+package poller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"zvelo.io/msg/mock"
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/options"
+)
+
+func newPoller(t *testing.T, addr, transport string) Poller {
+	opts := options.New("zapi-test")
+	opts.InsecureSkipVerify = true
+
+	c := opts.Clients()
+	p := New(opts, c)
+
+	app := cli.NewApp()
+	app.Flags = append(c.Flags(), p.Flags()...)
+	app.Action = func(*cli.Context) error { return p.Setup() }
+
+	err := app.Run([]string{"zapi-test",
+		"-mock-no-credentials",
+		"-no-cache-token",
+		"-rest-base-url", addr,
+		"-grpc-target", addr,
+		"-poll-interval", "10ms",
+		"-transport", transport,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// TestTransports queries and polls the mock server with each transport and
+// expects the same results from all of them
+func TestTransports(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_ = mock.APIv1().ServeTLS(ctx, l) // #nosec
+	}()
+
+	const u = "http://example.com/"
+
+	for _, transport := range []string{TransportGRPC, TransportREST, TransportGraphQL} {
+		p := newPoller(t, l.Addr().String(), transport)
+
+		if p.Transport() != transport {
+			t.Errorf("%s: unexpected transport %s", transport, p.Transport())
+		}
+
+		qctx := mock.QueryContext(ctx,
+			mock.WithCategories(msg.PORN_4),
+			mock.WithFetchCode(200),
+			mock.WithCompleteAfter(50*time.Millisecond),
+		)
+
+		replies, err := p.Query(qctx, &msg.QueryRequests{
+			Url:     []string{u},
+			Content: []*msg.URLContent{{Content: "some content"}},
+			Dataset: []msg.DatasetType{msg.CATEGORIZATION},
+		}, false)
+		if err != nil {
+			t.Errorf("%s: query error: %s", transport, err)
+			continue
+		}
+
+		if len(replies.Reply) != 2 {
+			t.Errorf("%s: unexpected replies: %v", transport, replies.Reply)
+			continue
+		}
+
+		var result *msg.QueryResult
+		p.Poll(qctx, Requests{replies.Reply[0].RequestId: u}, HandlerFunc(func(_ context.Context, r *msg.QueryResult) Requests {
+			result = r
+			return nil
+		}))
+
+		if result == nil || result.QueryStatus == nil || !result.QueryStatus.Complete {
+			t.Errorf("%s: result not complete: %v", transport, result)
+			continue
+		}
+
+		if result.RequestId != replies.Reply[0].RequestId || result.Url != u || result.QueryStatus.FetchCode != 200 {
+			t.Errorf("%s: unexpected result: %v", transport, result)
+		}
+
+		if cats := result.ResponseDataset.GetCategorization().GetValue(); !reflect.DeepEqual(cats, []msg.Category{msg.PORN_4}) {
+			t.Errorf("%s: unexpected categories: %v", transport, cats)
+		}
+	}
+}
+
+func TestInvalidTransport(t *testing.T) {
+	p := New(options.New("zapi-test"), nil).(*poller)
+	p.transport = "carrier-pigeon"
+
+	if err := p.Setup(); err == nil {
+		t.Error("expected an error for an invalid transport")
+	}
+}
+
+type errorHandler struct {
+	HandlerFunc
+	reqIDs []string
+}
+
+func (h *errorHandler) PollError(_ context.Context, reqID string, _ error) {
+	h.reqIDs = append(h.reqIDs, reqID)
+}
+
+func TestPollError(t *testing.T) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is listening, so every poll fails
+	addr := l.Addr().String()
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := newPoller(t, addr, TransportREST)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	h := errorHandler{HandlerFunc: func(context.Context, *msg.QueryResult) Requests {
+		t.Error("unexpected result")
+		return nil
+	}}
+
+	p.Poll(ctx, Requests{"a": "http://example.com/"}, &h)
+
+	if !reflect.DeepEqual(h.reqIDs, []string{"a"}) {
+		t.Errorf("unexpected errors for: %v", h.reqIDs)
+	}
+}
+
+func TestMockOptions(t *testing.T) {
+	opts, err := MockOptions([]string{"PORN_4"}, []string{"MAL_4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts) != 2 {
+		t.Errorf("unexpected options: %v", opts)
+	}
+
+	if opts, err = MockOptions(nil, nil); err != nil || len(opts) != 0 {
+		t.Errorf("unexpected options: %v, %v", opts, err)
+	}
+
+	if _, err = MockOptions([]string{"not-a-category"}, nil); err == nil {
+		t.Error("expected an error for an invalid category")
+	}
+}
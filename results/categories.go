@@ -0,0 +1,31 @@
+package results
+
+import (
+	"github.com/pkg/errors"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+// ParseCategories returns the categories named by their ids or short names
+func ParseCategories(names []string) ([]msg.Category, error) {
+	var cats []msg.Category
+
+	for _, name := range names {
+		cat := msg.ParseCategory(name)
+		if cat == msg.UNKNOWN_CATEGORY {
+			return nil, errors.Errorf("invalid category: %s", name)
+		}
+		cats = append(cats, cat)
+	}
+
+	return cats, nil
+}
+
+// CategoryStrings returns the names of cats
+func CategoryStrings(cats []msg.Category) []string {
+	s := make([]string, len(cats))
+	for i, cat := range cats {
+		s[i] = cat.String()
+	}
+	return s
+}
@@ -0,0 +1,27 @@
+package results
+
+import (
+	"reflect"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestParseCategories(t *testing.T) {
+	cats, err := ParseCategories([]string{"NEWS_4", "MAL_4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cats, []msg.Category{msg.NEWS_4, msg.MAL_4}) {
+		t.Errorf("unexpected categories: %v", cats)
+	}
+
+	if names := CategoryStrings(cats); !reflect.DeepEqual(names, []string{"NEWS_4", "MAL_4"}) {
+		t.Errorf("unexpected names: %v", names)
+	}
+
+	if _, err = ParseCategories([]string{"NEWS_4", "NOPE"}); err == nil || err.Error() != "invalid category: NOPE" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package results
+
+import (
+	msg "zvelo.io/msg/msgpb"
+)
+
+// Verdicts of the malicious dataset
+const (
+	VerdictClean     = "CLEAN"
+	VerdictMalicious = "MALICIOUS"
+)
+
+// Change is the difference between two datasets for the same url
+type Change struct {
+	CategoriesAdded   []msg.Category
+	CategoriesRemoved []msg.Category
+	VerdictBefore     string
+	VerdictAfter      string
+	LanguageBefore    string
+	LanguageAfter     string
+}
+
+// Changed returns true if categories were added or removed or the malicious
+// verdict flipped
+func (c Change) Changed() bool {
+	return len(c.CategoriesAdded) > 0 || len(c.CategoriesRemoved) > 0 || c.VerdictChanged()
+}
+
+// VerdictChanged returns true if the malicious verdict flipped. A missing
+// malicious dataset isn't a change.
+func (c Change) VerdictChanged() bool {
+	return c.VerdictBefore != "" && c.VerdictAfter != "" && c.VerdictBefore != c.VerdictAfter
+}
+
+// LanguageChanged returns true if the detected language changed. A missing
+// language dataset isn't a change.
+func (c Change) LanguageChanged() bool {
+	return c.LanguageBefore != "" && c.LanguageAfter != "" && c.LanguageBefore != c.LanguageAfter
+}
+
+// Verdict returns the malicious verdict of ds, or "" if it doesn't have a
+// malicious dataset
+func Verdict(ds *msg.Dataset) string {
+	if ds == nil || ds.Malicious == nil || ds.Malicious.Error != nil {
+		return ""
+	}
+
+	if len(ds.Malicious.Category) > 0 {
+		return VerdictMalicious
+	}
+
+	return VerdictClean
+}
+
+// Language returns the language code of ds, or "" if it doesn't have a
+// language dataset
+func Language(ds *msg.Dataset) string {
+	if ds == nil || ds.Language == nil || ds.Language.Error != nil {
+		return ""
+	}
+
+	return ds.Language.Code
+}
+
+// Categories returns the categories of ds and whether they are known. They
+// aren't if ds doesn't have a categorization dataset or it has an error.
+func Categories(ds *msg.Dataset) ([]msg.Category, bool) {
+	if ds == nil || ds.Categorization == nil || ds.Categorization.Error != nil {
+		return nil, false
+	}
+
+	return ds.Categorization.Value, true
+}
+
+// Contains returns true if cat is one of cats
+func Contains(cats []msg.Category, cat msg.Category) bool {
+	for _, c := range cats {
+		if c == cat {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Diff returns the categories in b that aren't in a and those in a that aren't
+// in b
+func Diff(a, b []msg.Category) (added, removed []msg.Category) {
+	for _, cat := range b {
+		if !Contains(a, cat) {
+			added = append(added, cat)
+		}
+	}
+
+	for _, cat := range a {
+		if !Contains(b, cat) {
+			removed = append(removed, cat)
+		}
+	}
+
+	return added, removed
+}
+
+// Compare returns the changes from the dataset before to the one after.
+// Categories are only compared if both have them, a missing or failed
+// categorization dataset isn't a change.
+func Compare(before, after *msg.Dataset) Change {
+	var added, removed []msg.Category
+
+	b, ok := Categories(before)
+	if a, aok := Categories(after); ok && aok {
+		added, removed = Diff(b, a)
+	}
+
+	return Change{
+		CategoriesAdded:   added,
+		CategoriesRemoved: removed,
+		VerdictBefore:     Verdict(before),
+		VerdictAfter:      Verdict(after),
+		LanguageBefore:    Language(before),
+		LanguageAfter:     Language(after),
+	}
+}
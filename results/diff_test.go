@@ -0,0 +1,57 @@
+package results
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+func TestCompare(t *testing.T) {
+	old := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.NEWS_4, msg.SPORTS_4}},
+		Malicious:      &msg.Dataset_Malicious{},
+	}
+
+	c := Compare(old, old)
+	if c.Changed() || c.VerdictBefore != VerdictClean {
+		t.Errorf("unexpected change: %+v", c)
+	}
+
+	new := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Value: []msg.Category{msg.SPORTS_4, msg.BLOG_4}},
+		Malicious:      &msg.Dataset_Malicious{Category: []msg.Category{msg.MAL_4}},
+	}
+
+	c = Compare(old, new)
+	if !c.Changed() || !c.VerdictChanged() || c.VerdictAfter != VerdictMalicious {
+		t.Errorf("unexpected change: %+v", c)
+	}
+
+	if len(c.CategoriesAdded) != 1 || c.CategoriesAdded[0] != msg.BLOG_4 {
+		t.Errorf("unexpected categories added: %v", c.CategoriesAdded)
+	}
+
+	if len(c.CategoriesRemoved) != 1 || c.CategoriesRemoved[0] != msg.NEWS_4 {
+		t.Errorf("unexpected categories removed: %v", c.CategoriesRemoved)
+	}
+
+	// a missing malicious dataset isn't a verdict change
+	c = Compare(&msg.Dataset{Categorization: new.Categorization}, new)
+	if c.Changed() {
+		t.Errorf("unexpected change: %+v", c)
+	}
+
+	// nor is a failed one, or a failed categorization dataset
+	failed := &msg.Dataset{
+		Categorization: &msg.Dataset_Categorization{Error: &msg.Status{Code: int32(codes.Unavailable)}},
+		Malicious:      &msg.Dataset_Malicious{Error: &msg.Status{Code: int32(codes.Unavailable)}},
+	}
+
+	for _, c := range []Change{Compare(old, failed), Compare(failed, new)} {
+		if c.Changed() {
+			t.Errorf("unexpected change: %+v", c)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package results
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/gogo/protobuf/jsonpb"
+	"github.com/pkg/errors"
+
+	"google.golang.org/grpc/codes"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/internal/zvelo"
+)
+
+// maxLineSize is the longest line of json that Read accepts
+const maxLineSize = 16 * 1024 * 1024
+
+var jsonUnmarshaler = jsonpb.Unmarshaler{AllowUnknownFields: true}
+
+// Saved is a result read from the json output of query, stream or receiver
+type Saved struct {
+	// URL is the url that was queried, or for redirect chains, the url as it
+	// was given to query
+	URL    string
+	Result *msg.QueryResult
+}
+
+// Read reads the results written, one per line, by query, stream or receiver
+// with --json. Lines that aren't results, like the replies to queries, are
+// skipped.
+func Read(r io.Reader) ([]Saved, error) {
+	var ret []Saved
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+
+	for line := 1; s.Scan(); line++ {
+		data := bytes.TrimSpace(s.Bytes())
+		if len(data) == 0 || data[0] != '{' {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		if _, ok := fields["reply"]; ok {
+			// the replies to a query
+			continue
+		}
+
+		var saved Saved
+
+		if raw, ok := fields["result"]; ok {
+			// a result with the url it was queried as, archived results don't
+			// have one and use the url of the result
+			if u, ok := fields["url"]; ok {
+				if err := json.Unmarshal(u, &saved.URL); err != nil {
+					return nil, errors.Wrapf(err, "line %d", line)
+				}
+			}
+
+			data = raw
+		}
+
+		var result msg.QueryResult
+		if err := jsonUnmarshaler.Unmarshal(bytes.NewReader(data), &result); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+
+		if saved.URL == "" {
+			saved.URL = result.Url
+		}
+
+		saved.Result = &result
+		ret = append(ret, saved)
+	}
+
+	return ret, s.Err()
+}
+
+// ReadFile reads the results saved in the file name, - reads from stdin
+func ReadFile(name string) ([]Saved, error) {
+	r := io.Reader(os.Stdin)
+
+	if name != "-" {
+		f, err := os.Open(name) // #nosec
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }() // #nosec
+		r = f
+	}
+
+	saved, err := Read(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", name)
+	}
+
+	return saved, nil
+}
+
+// Latest returns the result of each url in saved. If there is more than one
+// result for a url, the last complete one is used.
+func Latest(saved []Saved) map[string]*msg.QueryResult {
+	ret := map[string]*msg.QueryResult{}
+
+	for _, s := range saved {
+		if prev, ok := ret[s.URL]; ok && zvelo.IsComplete(prev) && !zvelo.IsComplete(s.Result) {
+			continue
+		}
+
+		ret[s.URL] = s.Result
+	}
+
+	return ret
+}
+
+// ErrorCode returns the name of the grpc code of the error in result, or "" if
+// it doesn't have one
+func ErrorCode(result *msg.QueryResult) string {
+	if result.QueryStatus == nil || result.QueryStatus.Error == nil || result.QueryStatus.Error.Code == 0 {
+		return ""
+	}
+
+	return codes.Code(result.QueryStatus.Error.Code).String()
+}
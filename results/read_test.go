@@ -0,0 +1,52 @@
+package results
+
+import (
+	"strings"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+)
+
+const savedResults = `{"reply":[{"request_id":"a"},{"request_id":"b"}]}
+Tracing Tag: guid:x-client-trace-id=1CSqDqsSIbuR5Vms8E6yB2ZVUjs
+{"request_id":"a","response_dataset":{"categorization":{"value":["NEWS_4"]}},"url":"http://example.com/","query_status":{"complete":true,"fetch_code":200},"unknown_field":1}
+
+{"url":"example.org","result":{"request_id":"c","url":"http://www.example.org/","query_status":{"complete":true,"error":{"code":5}}},"redirects":[{"request_id":"b","url":"http://example.org/"}]}
+{"entries":[{"file":"a.har","index":0,"url":"http://example.net/"}],"result":{"request_id":"d","url":"http://example.net/","query_status":{"complete":true}}}
+`
+
+func TestRead(t *testing.T) {
+	saved, err := Read(strings.NewReader(savedResults))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 3 {
+		t.Fatalf("unexpected results: %+v", saved)
+	}
+
+	if saved[0].URL != "http://example.com/" || saved[0].Result.ResponseDataset.Categorization.Value[0] != msg.NEWS_4 {
+		t.Errorf("unexpected result: %+v", saved[0])
+	}
+
+	if saved[1].URL != "example.org" || saved[1].Result.RequestId != "c" {
+		t.Errorf("unexpected result: %+v", saved[1])
+	}
+
+	// archived results don't have the url they were queried as
+	if saved[2].URL != "http://example.net/" || saved[2].Result.RequestId != "d" {
+		t.Errorf("unexpected result: %+v", saved[2])
+	}
+
+	if code := ErrorCode(saved[1].Result); code != "NotFound" {
+		t.Errorf("unexpected error code: %s", code)
+	}
+
+	if code := ErrorCode(saved[0].Result); code != "" {
+		t.Errorf("unexpected error code: %s", code)
+	}
+
+	if _, err = Read(strings.NewReader("{\"url\": 1}\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("expected an error for line 1, got %v", err)
+	}
+}
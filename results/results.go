@@ -2,9 +2,11 @@ package results
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"text/template"
 
 	"github.com/fatih/color"
@@ -15,6 +17,7 @@ import (
 
 	msg "zvelo.io/msg/msgpb"
 	"zvelo.io/zapi/internal/zvelo"
+	"zvelo.io/zapi/policy"
 )
 
 var jsonMarshaler = jsonpb.Marshaler{OrigName: true}
@@ -52,6 +55,23 @@ Error Code:         {{errorcode .Code}}
 {{- end}}
 {{- end}}
 
+{{define "Hop" -}}
+{{- if .RequestId}}Request ID:    {{.RequestId}}
+{{end}}
+{{- with .QueryStatus}}
+{{- if .FetchCode}}Fetch Status:  {{httpStatus .FetchCode}}
+{{end}}
+{{- if .Location}}Location:      {{.Location}}
+{{end}}
+{{- end}}
+{{- with .ResponseDataset}}
+{{- with .Categorization}}Categories:    {{range .Value}}{{.}} {{end}}
+{{end}}
+{{- with .Malicious}}Malicious:     {{if .Category}}{{range .Category}}{{.}} {{end}}{{else}}CLEAN{{end}}
+{{end}}
+{{- end}}
+{{- end}}
+
 {{define "QueryResult" -}}
 {{- if .Url}}URL/Content:        {{.Url}}
 {{end}}
@@ -80,13 +100,21 @@ var queryResultTpl = template.Must(template.New("QueryResult").Funcs(template.Fu
 }).Parse(queryResultTplStr))
 
 func Print(result *msg.QueryResult, json bool) {
+	PrintDecision(result, nil, json)
+}
+
+// PrintDecision prints result along with the policy decision made for it, if
+// there is one
+func PrintDecision(result *msg.QueryResult, d *policy.Decision, json bool) {
 	fmt.Fprintf(os.Stderr, "\nreceived result\n")
 
 	if json {
-		if err := jsonMarshaler.Marshal(os.Stdout, result); err != nil {
+		data, err := marshalDecision(result, d)
+		if err != nil {
 			zvelo.Errorf("marshal error: %s\n", err)
+			return
 		}
-		fmt.Fprintln(os.Stdout)
+		fmt.Fprintf(os.Stdout, "%s\n", data)
 		return
 	}
 
@@ -95,13 +123,206 @@ func Print(result *msg.QueryResult, json bool) {
 		zvelo.Errorf("%s\n", err)
 	}
 
+	printDecision(&buf, d)
+
 	printf := zvelo.PrintfFunc(color.FgCyan, os.Stdout)
 	printf(buf.String())
 }
 
+// marshalDecision marshals result, or if there is a decision, an object with
+// result and the decision as its "policy"
+func marshalDecision(result *msg.QueryResult, d *policy.Decision) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jsonMarshaler.Marshal(&buf, result); err != nil {
+		return nil, err
+	}
+
+	if d == nil {
+		return buf.Bytes(), nil
+	}
+
+	return json.Marshal(struct {
+		Result json.RawMessage  `json:"result"`
+		Policy *policy.Decision `json:"policy"`
+	}{buf.Bytes(), d})
+}
+
+func printDecision(buf *bytes.Buffer, d *policy.Decision) {
+	if d != nil {
+		fmt.Fprintf(buf, "Policy:             %s\n", d)
+	}
+}
+
 func TracingTag() ksuid.KSUID {
 	id := ksuid.New()
 	printf := zvelo.PrintfFunc(color.FgCyan, os.Stdout)
 	printf("Tracing Tag: guid:x-client-trace-id=%s\n", id)
 	return id
 }
+
+// Chain is the result of a url along with the results of each request made
+// while following its redirects
+type Chain struct {
+	// Results are in the order the requests were made, the first is for the
+	// url that was queried
+	Results []*msg.QueryResult
+
+	// Stopped is why the redirect in the last result wasn't followed, if it
+	// has one
+	Stopped string
+
+	// Inputs are the urls as given before they were normalized, if they
+	// differ from the url that was queried
+	Inputs []string
+
+	// Decision is what the policy decided for the last result, if there is
+	// one
+	Decision *policy.Decision
+}
+
+func (c Chain) simple() bool {
+	return len(c.Results) == 1 && c.Stopped == "" && len(c.Inputs) == 0
+}
+
+// Print prints the result of the last request in the chain, the url
+// originally requested and every request made while following the redirects.
+// Chains of a single result for an unchanged input url are printed the same as
+// any other result, json output is only an object with the url and result
+// when there were redirects or the input url differs.
+func (c Chain) Print(json bool) {
+	if len(c.Results) == 0 {
+		return
+	}
+
+	if json {
+		fmt.Fprintf(os.Stderr, "\nreceived result\n")
+		c.printJSON()
+		return
+	}
+
+	if c.simple() {
+		PrintDecision(c.Results[0], c.Decision, false)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nreceived result\n")
+
+	var buf bytes.Buffer
+	if err := queryResultTpl.ExecuteTemplate(&buf, "QueryResult", c.Results[len(c.Results)-1]); err != nil {
+		zvelo.Errorf("%s\n", err)
+	}
+
+	printDecision(&buf, c.Decision)
+
+	if c.Stopped != "" {
+		fmt.Fprintf(&buf, "Redirect Stopped:   %s\n", c.Stopped)
+	}
+
+	for _, input := range c.Inputs {
+		fmt.Fprintf(&buf, "Input URL:          %s\n", input)
+	}
+
+	if len(c.Results) > 1 {
+		fmt.Fprintf(&buf, "Original URL:       %s\n", c.Results[0].Url)
+		fmt.Fprintf(&buf, "Redirect Chain:\n")
+
+		for i, result := range c.Results {
+			fmt.Fprintf(&buf, "  %d. %s\n", i+1, result.Url)
+
+			var hop bytes.Buffer
+			if err := queryResultTpl.ExecuteTemplate(&hop, "Hop", result); err != nil {
+				zvelo.Errorf("%s\n", err)
+			}
+
+			for _, line := range strings.SplitAfter(hop.String(), "\n") {
+				if line != "" {
+					buf.WriteString("     " + line)
+				}
+			}
+		}
+	}
+
+	printf := zvelo.PrintfFunc(color.FgCyan, os.Stdout)
+	printf(buf.String())
+}
+
+// printJSON prints a json object with the final result and redirects for each
+// input url
+func (c Chain) printJSON() {
+	lines, err := c.marshalJSON()
+	if err != nil {
+		zvelo.Errorf("marshal error: %s\n", err)
+		return
+	}
+
+	for _, data := range lines {
+		fmt.Fprintf(os.Stdout, "%s\n", data)
+	}
+}
+
+// marshalJSON returns the json object printed for each input url
+func (c Chain) marshalJSON() ([][]byte, error) {
+	if c.simple() {
+		data, err := marshalDecision(c.Results[0], c.Decision)
+		if err != nil {
+			return nil, err
+		}
+
+		return [][]byte{data}, nil
+	}
+
+	marshal := func(result *msg.QueryResult) (json.RawMessage, error) {
+		var buf bytes.Buffer
+		if err := jsonMarshaler.Marshal(&buf, result); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	last, err := marshal(c.Results[len(c.Results)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		URL       string            `json:"url"`
+		Result    json.RawMessage   `json:"result"`
+		Redirects []json.RawMessage `json:"redirects,omitempty"`
+		Stopped   string            `json:"redirect_stopped,omitempty"`
+		Policy    *policy.Decision  `json:"policy,omitempty"`
+	}{
+		Result:  last,
+		Stopped: c.Stopped,
+		Policy:  c.Decision,
+	}
+
+	if len(c.Results) > 1 {
+		for _, result := range c.Results {
+			data, err := marshal(result)
+			if err != nil {
+				return nil, err
+			}
+			out.Redirects = append(out.Redirects, data)
+		}
+	}
+
+	inputs := c.Inputs
+	if len(inputs) == 0 {
+		inputs = []string{c.Results[0].Url}
+	}
+
+	var lines [][]byte
+
+	for _, input := range inputs {
+		out.URL = input
+
+		data, err := json.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, data)
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,81 @@
+package results
+
+import (
+	"bytes"
+	"testing"
+
+	msg "zvelo.io/msg/msgpb"
+	"zvelo.io/zapi/policy"
+)
+
+func TestMarshalDecision(t *testing.T) {
+	d := &policy.Decision{Action: policy.Block, Rule: "malware"}
+
+	for _, tt := range []struct {
+		result   *msg.QueryResult
+		decision *policy.Decision
+		expected string
+	}{
+		{&msg.QueryResult{RequestId: "a"}, nil, `{"request_id":"a"}`},
+		{&msg.QueryResult{RequestId: "a"}, d, `{"result":{"request_id":"a"},"policy":{"action":"block","rule":"malware"}}`},
+		{&msg.QueryResult{}, d, `{"result":{},"policy":{"action":"block","rule":"malware"}}`},
+	} {
+		data, err := marshalDecision(tt.result, tt.decision)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, data)
+		}
+	}
+
+	// results with decisions can still be read
+	saved, err := Read(bytes.NewReader([]byte(`{"result":{"request_id":"a","url":"http://example.com/"},"policy":{"action":"block","rule":"malware"}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 1 || saved[0].Result.RequestId != "a" || saved[0].URL != "http://example.com/" {
+		t.Errorf("unexpected results: %+v", saved)
+	}
+}
+
+func TestChainJSON(t *testing.T) {
+	a := &msg.QueryResult{RequestId: "a", Url: "http://example.com/"}
+	b := &msg.QueryResult{RequestId: "b", Url: "https://example.com/"}
+
+	for _, tt := range []struct {
+		chain    Chain
+		expected []string
+	}{
+		{Chain{Results: []*msg.QueryResult{a}}, []string{
+			`{"request_id":"a","url":"http://example.com/"}`,
+		}},
+		{Chain{Results: []*msg.QueryResult{a}, Decision: &policy.Decision{Action: policy.Block, Rule: "malware"}}, []string{
+			`{"result":{"request_id":"a","url":"http://example.com/"},"policy":{"action":"block","rule":"malware"}}`,
+		}},
+		{Chain{Results: []*msg.QueryResult{a}, Inputs: []string{"example.com", "EXAMPLE.COM"}}, []string{
+			`{"url":"example.com","result":{"request_id":"a","url":"http://example.com/"}}`,
+			`{"url":"EXAMPLE.COM","result":{"request_id":"a","url":"http://example.com/"}}`,
+		}},
+		{Chain{Results: []*msg.QueryResult{a, b}}, []string{
+			`{"url":"http://example.com/","result":{"request_id":"b","url":"https://example.com/"},"redirects":[{"request_id":"a","url":"http://example.com/"},{"request_id":"b","url":"https://example.com/"}]}`,
+		}},
+	} {
+		lines, err := tt.chain.marshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(lines) != len(tt.expected) {
+			t.Fatalf("expected %d lines, got %d", len(tt.expected), len(lines))
+		}
+
+		for i, line := range lines {
+			if string(line) != tt.expected[i] {
+				t.Errorf("expected %s, got %s", tt.expected[i], line)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package tokensourcer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/browser"
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+)
+
+var callbackHTMLTpl = template.Must(template.New("callback").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="UTF-8">
+  <title>zapi</title>
+</head>
+<body>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// authCodeTokenSource retrieves user credentials using the oauth2
+// authorization code flow with PKCE (RFC 7636). Unlike userauth.TokenSource it
+// does not require a client secret so that it can be used by public clients.
+type authCodeTokenSource struct {
+	sync.Mutex
+	ctx    context.Context
+	config oauth2.Config
+	addr   string
+	open   bool
+	prompt io.Writer
+
+	// debug, if set, is where the requests to the callback server are logged
+	debug io.Writer
+
+	// authCodeURL, if set, is called with the url that the user should visit
+	// instead of opening it in the browser
+	authCodeURL func(string)
+}
+
+var _ oauth2.TokenSource = (*authCodeTokenSource)(nil)
+
+func newAuthCodeTokenSource(ctx context.Context, config oauth2.Config, addr string, open bool, prompt, debug io.Writer) *authCodeTokenSource {
+	return &authCodeTokenSource{
+		ctx:    ctx,
+		config: config,
+		addr:   addr,
+		open:   open,
+		prompt: prompt,
+		debug:  debug,
+	}
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// codeChallenge returns the S256 code challenge for verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type authCodeResult struct {
+	token *oauth2.Token
+	err   error
+}
+
+func (s *authCodeTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	state := randomString(24)
+	verifier := randomString(32)
+
+	u := s.config.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting oauth2 callback listener")
+	}
+
+	ch := make(chan authCodeResult, 1)
+	server := http.Server{Handler: s.handler(state, verifier, ch)}
+
+	go func() {
+		if serr := server.Serve(l); serr != nil && serr != http.ErrServerClosed {
+			fmt.Fprintf(s.prompt, "callback listener error: %s\n", serr) // #nosec
+		}
+	}()
+
+	defer func() { _ = server.Close() }() // #nosec
+
+	switch {
+	case s.authCodeURL != nil:
+		go s.authCodeURL(u)
+	case s.open:
+		fmt.Fprintf(s.prompt, "opening in browser: %s\n", u) // #nosec
+		if err = browser.OpenURL(u); err != nil {
+			return nil, err
+		}
+	default:
+		fmt.Fprintf(s.prompt, "open this url in your browser: %s\n", u) // #nosec
+	}
+
+	select {
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	case res := <-ch:
+		return res.token, res.err
+	}
+}
+
+func (s *authCodeTokenSource) exchange(code, verifier string) (*oauth2.Token, error) {
+	return retrieveToken(s.ctx, s.config, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.config.RedirectURL},
+		"code_verifier": {verifier},
+	})
+}
+
+func (s *authCodeTokenSource) handler(state, verifier string, ch chan<- authCodeResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.debug != nil {
+			if dump, err := httputil.DumpRequest(r, true); err == nil {
+				fmt.Fprintf(s.debug, "%s\n", dump) // #nosec
+			}
+		}
+
+		q := r.URL.Query()
+
+		if q.Get("state") != state {
+			// don't return the result on the channel, this can happen when the
+			// browser requests a favicon
+			http.Error(w, "invalid state", http.StatusUnauthorized)
+			return
+		}
+
+		var res authCodeResult
+
+		defer func() {
+			select {
+			case ch <- res:
+			default:
+			}
+		}()
+
+		if code := q.Get("error"); code != "" {
+			res.err = tokenError{Code: code, Description: q.Get("error_description")}
+			http.Error(w, res.err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if res.token, res.err = s.exchange(q.Get("code"), verifier); res.err != nil {
+			res.err = errors.Wrap(res.err, "error exchanging authorization code")
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_ = callbackHTMLTpl.Execute(w, "authorization complete, you may close this window") // #nosec
+	})
+}
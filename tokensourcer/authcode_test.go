@@ -0,0 +1,206 @@
+package tokensourcer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/urfave/cli"
+	"golang.org/x/oauth2"
+)
+
+// pkceServer is a fake authorization server that requires PKCE
+type pkceServer struct {
+	sync.Mutex
+	challenges  map[string]string
+	clientID    string
+	secret      string
+	badVerifier bool
+}
+
+func (s *pkceServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "pkce required", http.StatusBadRequest)
+			return
+		}
+
+		s.Lock()
+		code := randomString(16)
+		s.challenges[code] = q.Get("code_challenge")
+		s.Unlock()
+
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		v := redirect.Query()
+		v.Set("code", code)
+		v.Set("state", q.Get("state"))
+		redirect.RawQuery = v.Encode()
+
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		fail := func(code string) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"` + code + `"}`))
+		}
+
+		id, secret, ok := r.BasicAuth()
+		switch {
+		case s.secret == "" && (ok || r.FormValue("client_id") != s.clientID):
+			fail("invalid_client")
+			return
+		case s.secret != "" && (!ok || id != s.clientID || secret != s.secret):
+			fail("invalid_client")
+			return
+		}
+
+		s.Lock()
+		challenge, found := s.challenges[r.FormValue("code")]
+		delete(s.challenges, r.FormValue("code"))
+		s.Unlock()
+
+		verifier := r.FormValue("code_verifier")
+		if s.badVerifier {
+			verifier += "x"
+		}
+
+		if !found || r.FormValue("grant_type") != "authorization_code" || codeChallenge(verifier) != challenge {
+			fail("invalid_grant")
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+
+	return mux
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+func pkceToken(t *testing.T, ps *pkceServer, debug io.Writer) (*oauth2.Token, error) {
+	ps.challenges = map[string]string{}
+
+	srv := httptest.NewServer(ps.handler())
+	defer srv.Close()
+
+	addr := freeAddr(t)
+
+	config := oauth2.Config{
+		ClientID:     ps.clientID,
+		ClientSecret: ps.secret,
+		RedirectURL:  "http://" + addr + "/callback",
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  srv.URL + "/auth",
+			TokenURL: srv.URL + "/token",
+		},
+	}
+
+	s := newAuthCodeTokenSource(context.Background(), config, addr, false, &strings.Builder{}, debug)
+	s.authCodeURL = func(u string) {
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = resp.Body.Close()
+	}
+
+	return s.Token()
+}
+
+func TestAuthCodePKCEPublicClient(t *testing.T) {
+	var debug strings.Builder
+
+	token, err := pkceToken(t, &pkceServer{clientID: "test-client"}, &debug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "test-access-token" {
+		t.Errorf("unexpected access token: %q", token.AccessToken)
+	}
+
+	if !strings.Contains(debug.String(), "GET /callback?") {
+		t.Errorf("the callback request wasn't logged: %q", debug.String())
+	}
+}
+
+func TestAuthCodePKCEConfidentialClient(t *testing.T) {
+	token, err := pkceToken(t, &pkceServer{clientID: "test-client", secret: "test-secret"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "test-access-token" {
+		t.Errorf("unexpected access token: %q", token.AccessToken)
+	}
+}
+
+func TestAuthCodePKCEVerifierMismatch(t *testing.T) {
+	_, err := pkceToken(t, &pkceServer{clientID: "test-client", badVerifier: true}, nil)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("expected invalid_grant error, got: %v", err)
+	}
+}
+
+func TestSetupPublicClientRequiresPKCE(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-use-user-credentials", "-public-client"}, true},
+		{[]string{"-use-user-credentials", "-oauth2-no-pkce"}, true},
+		{[]string{"-public-client", "-oauth2-no-pkce"}, false},
+	} {
+		debug, insecure := false, false
+		ts := New("zapi-test", &debug, &insecure)
+
+		var err error
+
+		app := cli.NewApp()
+		app.Flags = ts.Flags()
+		app.Action = func(*cli.Context) error {
+			err = ts.Setup(context.Background())
+			return nil
+		}
+
+		if runErr := app.Run(append([]string{"zapi"}, tt.args...)); runErr != nil {
+			t.Fatal(runErr)
+		}
+
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: unexpected error: %v", tt.args, err)
+		}
+	}
+}
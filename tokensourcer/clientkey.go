@@ -0,0 +1,172 @@
+package tokensourcer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long signed client assertions are valid for
+const clientAssertionLifetime = 5 * time.Minute
+
+type clientAssertionClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	Expiry    int64  `json:"exp"`
+}
+
+// clientKeyTokenSource retrieves client credentials authenticating the client
+// with private_key_jwt (RFC 7523) instead of a shared secret
+type clientKeyTokenSource struct {
+	sync.Mutex
+	ctx     context.Context
+	config  oauth2.Config
+	keyFile string
+	keyID   string
+	signer  jose.Signer
+}
+
+var _ oauth2.TokenSource = (*clientKeyTokenSource)(nil)
+
+func newClientKeyTokenSource(ctx context.Context, config oauth2.Config, keyFile, keyID string) oauth2.TokenSource {
+	// the secret is never sent when using private_key_jwt
+	config.ClientSecret = ""
+
+	return &clientKeyTokenSource{
+		ctx:     ctx,
+		config:  config,
+		keyFile: keyFile,
+		keyID:   keyID,
+	}
+}
+
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	return nil, errors.Errorf("unsupported pem block type: %s", block.Type)
+}
+
+func signatureAlgorithm(key interface{}) (jose.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return jose.ES256, nil
+		case 384:
+			return jose.ES384, nil
+		case 521:
+			return jose.ES512, nil
+		}
+	}
+
+	return "", errors.Errorf("unsupported private key type: %T", key)
+}
+
+func newAssertionSigner(keyFile, keyID string) (jose.Signer, error) {
+	data, err := ioutil.ReadFile(keyFile) // #nosec
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing client key %s", keyFile)
+	}
+
+	alg, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return jose.NewSigner(jose.SigningKey{
+		Algorithm: alg,
+		Key:       jose.JSONWebKey{Key: key, KeyID: keyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+}
+
+// assertion returns a newly signed client assertion for the token endpoint
+func (s *clientKeyTokenSource) assertion() (string, error) {
+	now := time.Now()
+
+	payload, err := json.Marshal(clientAssertionClaims{
+		Issuer:    s.config.ClientID,
+		Subject:   s.config.ClientID,
+		Audience:  s.config.Endpoint.TokenURL,
+		ID:        randomString(24),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		Expiry:    now.Add(clientAssertionLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	jws, err := s.signer.Sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return jws.CompactSerialize()
+}
+
+func (s *clientKeyTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.signer == nil {
+		var err error
+		if s.signer, err = newAssertionSigner(s.keyFile, s.keyID); err != nil {
+			return nil, err
+		}
+	}
+
+	assertion, err := s.assertion()
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing client assertion")
+	}
+
+	v := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}
+
+	if len(s.config.Scopes) > 0 {
+		v.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	return retrieveToken(s.ctx, s.config, v)
+}
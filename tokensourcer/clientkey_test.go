@@ -0,0 +1,156 @@
+package tokensourcer
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func writeKey(t *testing.T, block *pem.Block) string {
+	f, err := ioutil.TempFile("", "zapi-client-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if err = pem.Encode(f, block); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+// assertionServer is a fake token endpoint that only accepts client
+// assertions signed by pub
+func assertionServer(t *testing.T, pub crypto.PublicKey) *httptest.Server {
+	var srv *httptest.Server
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		fail := func(format string, a ...interface{}) {
+			t.Errorf(format, a...)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		}
+
+		if _, _, ok := r.BasicAuth(); ok || r.FormValue("client_secret") != "" {
+			fail("client secret should not be sent")
+			return
+		}
+
+		if r.FormValue("client_assertion_type") != clientAssertionType {
+			fail("unexpected client_assertion_type: %q", r.FormValue("client_assertion_type"))
+			return
+		}
+
+		jws, err := jose.ParseSigned(r.FormValue("client_assertion"))
+		if err != nil {
+			fail("%s", err)
+			return
+		}
+
+		if kid := jws.Signatures[0].Header.KeyID; kid != "test-key" {
+			fail("unexpected kid: %q", kid)
+			return
+		}
+
+		payload, err := jws.Verify(pub)
+		if err != nil {
+			fail("%s", err)
+			return
+		}
+
+		var claims clientAssertionClaims
+		if err = json.Unmarshal(payload, &claims); err != nil {
+			fail("%s", err)
+			return
+		}
+
+		now := time.Now().Unix()
+
+		switch {
+		case claims.Issuer != "test-client", claims.Subject != "test-client":
+			fail("unexpected iss/sub: %q/%q", claims.Issuer, claims.Subject)
+			return
+		case claims.Audience != srv.URL:
+			fail("unexpected aud: %q", claims.Audience)
+			return
+		case claims.ID == "", claims.Expiry <= now, claims.Expiry > now+int64(clientAssertionLifetime.Seconds()):
+			fail("invalid jti or exp: %#v", claims)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "test-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+
+	return srv
+}
+
+func testClientKey(t *testing.T, pub crypto.PublicKey, block *pem.Block) {
+	keyFile := writeKey(t, block)
+	defer func() { _ = os.Remove(keyFile) }()
+
+	srv := assertionServer(t, pub)
+	defer srv.Close()
+
+	config := oauth2.Config{
+		ClientID:     "test-client",
+		ClientSecret: "should-not-be-sent",
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL},
+	}
+
+	token, err := newClientKeyTokenSource(context.Background(), config, keyFile, "test-key").Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "test-access-token" {
+		t.Errorf("unexpected access token: %q", token.AccessToken)
+	}
+}
+
+func TestClientKeyRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testClientKey(t, &key.PublicKey, &pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
+
+func TestClientKeyECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testClientKey(t, &key.PublicKey, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
@@ -0,0 +1,156 @@
+package tokensourcer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+)
+
+// DefaultDeviceAuthURL is the default device authorization endpoint used by the
+// device authorization grant
+const DefaultDeviceAuthURL = "https://auth.zvelo.com/oauth2/device/auth"
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// defaultDeviceInterval is the polling interval used when the authorization
+// server does not provide one (RFC 8628 section 3.2)
+const defaultDeviceInterval = 5 * time.Second
+
+type deviceAuth struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type deviceTokenSource struct {
+	sync.Mutex
+	ctx           context.Context
+	config        oauth2.Config
+	deviceAuthURL string
+	prompt        io.Writer
+}
+
+var _ oauth2.TokenSource = (*deviceTokenSource)(nil)
+
+// newDeviceTokenSource returns an oauth2.TokenSource that retrieves user
+// credentials using the oauth2 device authorization grant (RFC 8628). The
+// verification uri and user code are written to prompt.
+func newDeviceTokenSource(ctx context.Context, config oauth2.Config, deviceAuthURL string, prompt io.Writer) oauth2.TokenSource {
+	return &deviceTokenSource{
+		ctx:           ctx,
+		config:        config,
+		deviceAuthURL: deviceAuthURL,
+		prompt:        prompt,
+	}
+}
+
+func (s *deviceTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	auth, err := s.authorize()
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(s.prompt, "to authorize this device, open this url in a browser: %s\n", auth.VerificationURIComplete) // #nosec
+		fmt.Fprintf(s.prompt, "or go to %s and enter the code: %s\n", auth.VerificationURI, auth.UserCode)                // #nosec
+	} else {
+		fmt.Fprintf(s.prompt, "to authorize this device, go to %s and enter the code: %s\n", auth.VerificationURI, auth.UserCode) // #nosec
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDeviceInterval
+	}
+
+	ctx := s.ctx
+	if auth.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(auth.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded && s.ctx.Err() == nil {
+				return nil, errors.New("device code expired before authorization was completed")
+			}
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		token, err := s.poll(ctx, auth.DeviceCode)
+		if err == nil {
+			return token, nil
+		}
+
+		terr, ok := err.(tokenError)
+		if !ok {
+			return nil, err
+		}
+
+		switch terr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, errors.Wrap(terr, "device authorization failed")
+		}
+	}
+}
+
+func (s *deviceTokenSource) authorize() (*deviceAuth, error) {
+	v := url.Values{}
+
+	if len(s.config.Scopes) > 0 {
+		v.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	resp, err := postForm(s.ctx, s.config, s.deviceAuthURL, v)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }() // #nosec
+
+	if resp.StatusCode != http.StatusOK {
+		var terr tokenError
+		if err = json.NewDecoder(resp.Body).Decode(&terr); err == nil && terr.Code != "" {
+			return nil, errors.Wrap(terr, "device authorization request failed")
+		}
+		return nil, errors.Errorf("device authorization request failed: %s", resp.Status)
+	}
+
+	var auth deviceAuth
+	if err = json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return nil, err
+	}
+
+	if auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, errors.New("invalid device authorization response")
+	}
+
+	return &auth, nil
+}
+
+func (s *deviceTokenSource) poll(ctx context.Context, deviceCode string) (*oauth2.Token, error) {
+	return retrieveToken(ctx, s.config, url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {deviceCode},
+	})
+}
@@ -0,0 +1,243 @@
+package tokensourcer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// deviceServer is a stand-in authorization server implementing the endpoints
+// required by the device authorization grant
+type deviceServer struct {
+	sync.Mutex
+	pending       int
+	deny          bool
+	polls         int
+	userCode      string
+	expiresIn     int
+	refreshes     int
+	rejectRefresh bool
+}
+
+func (s *deviceServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "test-client" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "test-device-code",
+			"user_code":        s.userCode,
+			"verification_uri": "https://auth.example.com/device",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		defer s.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.FormValue("grant_type") == "refresh_token" {
+			s.refreshes++
+
+			if s.rejectRefresh || r.FormValue("refresh_token") != "test-refresh-token" || r.FormValue("client_id") != "test-client" {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "test-refreshed-token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+			return
+		}
+
+		s.polls++
+
+		if r.FormValue("grant_type") != deviceCodeGrantType || r.FormValue("device_code") != "test-device-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+
+		if s.deny {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"access_denied"}`))
+			return
+		}
+
+		if s.pending > 0 {
+			s.pending--
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+
+		expiresIn := s.expiresIn
+		if expiresIn == 0 {
+			expiresIn = 3600
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "test-access-token",
+			"token_type":    "Bearer",
+			"expires_in":    expiresIn,
+			"refresh_token": "test-refresh-token",
+			"id_token":      "test-id-token",
+		})
+	})
+
+	return mux
+}
+
+func deviceConfig(srv *httptest.Server) oauth2.Config {
+	return oauth2.Config{
+		ClientID: "test-client",
+		Endpoint: oauth2.Endpoint{TokenURL: srv.URL + "/token"},
+		Scopes:   []string{"zvelo.dataset"},
+	}
+}
+
+func TestDeviceTokenSource(t *testing.T) {
+	ds := deviceServer{pending: 1, userCode: "ABCD-EFGH"}
+	srv := httptest.NewServer(ds.handler())
+	defer srv.Close()
+
+	var prompt bytes.Buffer
+	ts := newDeviceTokenSource(context.Background(), deviceConfig(srv), srv.URL+"/device", &prompt)
+
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token.AccessToken != "test-access-token" {
+		t.Errorf("unexpected access token: %q", token.AccessToken)
+	}
+
+	if idToken, _ := token.Extra("id_token").(string); idToken != "test-id-token" {
+		t.Errorf("unexpected id token: %q", idToken)
+	}
+
+	if ds.polls != 2 {
+		t.Errorf("expected 2 polls, got %d", ds.polls)
+	}
+
+	if !strings.Contains(prompt.String(), "ABCD-EFGH") || !strings.Contains(prompt.String(), "https://auth.example.com/device") {
+		t.Errorf("prompt is missing user code or verification uri: %q", prompt.String())
+	}
+}
+
+func TestDeviceTokenSourceDenied(t *testing.T) {
+	ds := deviceServer{deny: true, userCode: "ABCD-EFGH"}
+	srv := httptest.NewServer(ds.handler())
+	defer srv.Close()
+
+	ts := newDeviceTokenSource(context.Background(), deviceConfig(srv), srv.URL+"/device", ioutil.Discard)
+
+	if _, err := ts.Token(); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected access_denied error, got: %v", err)
+	}
+}
+
+func TestDeviceTokenSourceFileCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zapi-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	_ = os.Unsetenv("SNAP_USER_COMMON")
+	_ = os.Setenv("XDG_DATA_HOME", dir)
+
+	ds := deviceServer{userCode: "ABCD-EFGH"}
+	srv := httptest.NewServer(ds.handler())
+	defer srv.Close()
+
+	var debug, insecureSkipVerify bool
+
+	for i := 0; i < 2; i++ {
+		d := New("zapi-test", &debug, &insecureSkipVerify, "zvelo.dataset").(*data)
+		d.useDeviceFlow = true
+		d.deviceAuthURL = srv.URL + "/device"
+		d.oauth2 = deviceConfig(srv)
+
+		token, err := d.TokenSource().Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.AccessToken != "test-access-token" {
+			t.Errorf("unexpected access token: %q", token.AccessToken)
+		}
+	}
+
+	if ds.polls != 1 {
+		t.Errorf("expected the second token to come from the file cache, got %d polls", ds.polls)
+	}
+}
+
+func TestDeviceTokenSourceRefresh(t *testing.T) {
+	// the access token expires immediately so every token after the first
+	// has to be refreshed
+	ds := deviceServer{userCode: "ABCD-EFGH", expiresIn: 1}
+	srv := httptest.NewServer(ds.handler())
+	defer srv.Close()
+
+	config := deviceConfig(srv)
+	ts := newRefreshTokenSource(context.Background(), config,
+		newDeviceTokenSource(context.Background(), config, srv.URL+"/device", ioutil.Discard))
+
+	for _, expected := range []string{"test-access-token", "test-refreshed-token"} {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.AccessToken != expected {
+			t.Errorf("expected %q, got %q", expected, token.AccessToken)
+		}
+
+		// the refresh token is kept so that it is cached with the token
+		if token.RefreshToken != "test-refresh-token" {
+			t.Errorf("unexpected refresh token: %q", token.RefreshToken)
+		}
+	}
+
+	if ds.polls != 1 || ds.refreshes != 1 {
+		t.Errorf("expected 1 poll and 1 refresh, got %d and %d", ds.polls, ds.refreshes)
+	}
+
+	// the user is prompted again once the refresh token is rejected
+	ds.Lock()
+	ds.rejectRefresh = true
+	ds.Unlock()
+
+	ts.refresh = config.TokenSource(context.Background(), &oauth2.Token{RefreshToken: "test-refresh-token"})
+
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	if ds.polls != 2 || ds.refreshes != 2 {
+		t.Errorf("expected 2 polls and 2 refreshes, got %d and %d", ds.polls, ds.refreshes)
+	}
+}
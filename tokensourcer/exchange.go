@@ -0,0 +1,128 @@
+package tokensourcer
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+)
+
+// The token types used in the token exchange (RFC 8693 section 3)
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType        = "urn:ietf:params:oauth:token-type:access_token"
+	jwtTokenType           = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// exchangeTokenSource uses an oauth2 token exchange (RFC 8693) to get a token
+// for the user that subjectToken, a jwt, was issued to. Without actAs only the
+// subject_token is sent and the issued token impersonates the user. With it
+// the operator's own token from src is sent as the actor_token, so the token
+// is delegated and its act claim records the operator.
+type exchangeTokenSource struct {
+	sync.Mutex
+	ctx          context.Context
+	config       oauth2.Config
+	src          oauth2.TokenSource
+	subjectToken string
+	actAs        bool
+	log          io.Writer
+}
+
+var _ oauth2.TokenSource = (*exchangeTokenSource)(nil)
+
+func newExchangeTokenSource(ctx context.Context, config oauth2.Config, src oauth2.TokenSource, subjectToken string, actAs bool, log io.Writer) oauth2.TokenSource {
+	return &exchangeTokenSource{
+		ctx:          ctx,
+		config:       config,
+		src:          src,
+		subjectToken: subjectToken,
+		actAs:        actAs,
+		log:          log,
+	}
+}
+
+func (s *exchangeTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	v := url.Values{
+		"grant_type":           {tokenExchangeGrantType},
+		"requested_token_type": {accessTokenType},
+		"subject_token":        {s.subjectToken},
+		"subject_token_type":   {jwtTokenType},
+	}
+
+	if s.actAs {
+		// delegation, the operator is only the actor
+		operator, err := s.src.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting operator token for token exchange")
+		}
+
+		v.Set("actor_token", operator.AccessToken)
+		v.Set("actor_token_type", accessTokenType)
+	}
+
+	if len(s.config.Scopes) > 0 {
+		v.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+
+	subject := "the subject of the subject token"
+	if claims, err := JWTClaims(s.subjectToken); err == nil {
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			subject = sub
+		}
+	}
+
+	token, err := retrieveToken(s.ctx, s.config, v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "token exchange for %s failed", subject)
+	}
+
+	mode := "impersonating"
+	if s.actAs {
+		mode = "acting as"
+	}
+
+	_, _ = color.New(color.FgRed, color.Bold).Fprintf(s.log, "*** AUDITED SESSION: %s %s (delegated token expires %s) ***\n", mode, subject, expiry(token)) // #nosec
+
+	return token, nil
+}
+
+func expiry(token *oauth2.Token) string {
+	if token.Expiry.IsZero() {
+		return "never"
+	}
+
+	return fmt.Sprint(token.Expiry)
+}
+
+// JWTClaims returns the claims of a jwt without verifying its signature
+func JWTClaims(raw string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a jwt")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
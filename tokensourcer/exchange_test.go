@@ -0,0 +1,82 @@
+package tokensourcer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// testSubjectToken is an unsigned jwt for customer@example.com
+var testSubjectToken = "eyJhbGciOiJub25lIn0." +
+	base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"customer@example.com"}`)) + "."
+
+func exchangeServer(t *testing.T, actAs bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		want := map[string]string{
+			"grant_type":         tokenExchangeGrantType,
+			"subject_token":      testSubjectToken,
+			"subject_token_type": jwtTokenType,
+			"actor_token":        "",
+			"actor_token_type":   "",
+		}
+
+		if actAs {
+			want["actor_token"] = "operator-token"
+			want["actor_token_type"] = accessTokenType
+		}
+
+		for k, v := range want {
+			if got := r.FormValue(k); got != v {
+				t.Errorf("%s: got %q, want %q", k, got, v)
+			}
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":      "delegated-token",
+			"issued_token_type": accessTokenType,
+			"token_type":        "Bearer",
+			"expires_in":        300,
+		})
+	}))
+}
+
+func TestExchangeTokenSource(t *testing.T) {
+	for _, actAs := range []bool{false, true} {
+		srv := exchangeServer(t, actAs)
+
+		var log bytes.Buffer
+		config := oauth2.Config{
+			ClientID: "test-client",
+			Endpoint: oauth2.Endpoint{TokenURL: srv.URL},
+		}
+		operator := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "operator-token"})
+
+		token, err := newExchangeTokenSource(context.Background(), config, operator, testSubjectToken, actAs, &log).Token()
+		srv.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.AccessToken != "delegated-token" {
+			t.Errorf("unexpected access token: %q", token.AccessToken)
+		}
+
+		if token.Extra("issued_token_type") != accessTokenType {
+			t.Errorf("unexpected issued_token_type: %v", token.Extra("issued_token_type"))
+		}
+
+		if !strings.Contains(log.String(), "AUDITED SESSION") || !strings.Contains(log.String(), "customer@example.com") {
+			t.Errorf("delegated token use was not logged: %q", log.String())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package tokensourcer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenError is an error response from an oauth2 endpoint (RFC 6749 section
+// 5.2)
+type tokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e tokenError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+func httpClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+
+	return http.DefaultClient
+}
+
+// postForm posts v to u authenticating as the client described by config.
+// Clients without a secret are treated as public clients and only identify
+// themselves with client_id.
+func postForm(ctx context.Context, config oauth2.Config, u string, v url.Values) (*http.Response, error) {
+	if config.ClientSecret == "" {
+		v.Set("client_id", config.ClientID)
+	}
+
+	req, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	return httpClient(ctx).Do(req.WithContext(ctx))
+}
+
+// retrieveToken requests a token from the token endpoint of config. Error
+// responses from the server are returned as tokenError.
+func retrieveToken(ctx context.Context, config oauth2.Config, v url.Values) (*oauth2.Token, error) {
+	resp, err := postForm(ctx, config, config.Endpoint.TokenURL, v)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }() // #nosec
+
+	var raw map[string]interface{}
+	if err = json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, errors.Wrapf(err, "token request failed: %s", resp.Status)
+	}
+
+	if code, _ := raw["error"].(string); code != "" || resp.StatusCode != http.StatusOK {
+		desc, _ := raw["error_description"].(string)
+		if code == "" {
+			code = resp.Status
+		}
+		return nil, tokenError{Code: code, Description: desc}
+	}
+
+	return tokenFromJSON(raw)
+}
+
+func tokenFromJSON(raw map[string]interface{}) (*oauth2.Token, error) {
+	var token oauth2.Token
+
+	token.AccessToken, _ = raw["access_token"].(string)
+	token.TokenType, _ = raw["token_type"].(string)
+	token.RefreshToken, _ = raw["refresh_token"].(string)
+
+	if token.AccessToken == "" {
+		return nil, errors.New("server response missing access_token")
+	}
+
+	if expiresIn, ok := raw["expires_in"].(float64); ok && expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+
+	return token.WithExtra(raw), nil
+}
+
+// refreshTokenSource gets tokens from src, an interactive flow, and then uses
+// the refresh token that comes with them, if there is one, so that the user
+// isn't prompted again when the access token expires. src is only used again
+// if the refresh token is rejected.
+type refreshTokenSource struct {
+	sync.Mutex
+	ctx     context.Context
+	config  oauth2.Config
+	src     oauth2.TokenSource
+	refresh oauth2.TokenSource
+}
+
+var _ oauth2.TokenSource = (*refreshTokenSource)(nil)
+
+func newRefreshTokenSource(ctx context.Context, config oauth2.Config, src oauth2.TokenSource) *refreshTokenSource {
+	if config.ClientSecret == "" {
+		// the same as postForm, public clients identify themselves with
+		// client_id instead of basic auth when refreshing
+		oauth2.RegisterBrokenAuthHeaderProvider(config.Endpoint.TokenURL)
+	}
+
+	return &refreshTokenSource{
+		ctx:    ctx,
+		config: config,
+		src:    src,
+	}
+}
+
+func (s *refreshTokenSource) Token() (*oauth2.Token, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.refresh != nil {
+		token, err := s.refresh.Token()
+		if err == nil {
+			return token, nil
+		}
+
+		if _, ok := err.(*oauth2.RetrieveError); !ok {
+			return nil, errors.Wrap(err, "error refreshing token")
+		}
+
+		// the refresh token expired or was revoked
+		s.refresh = nil
+	}
+
+	token, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token.RefreshToken != "" {
+		s.refresh = s.config.TokenSource(s.ctx, token)
+	}
+
+	return token, nil
+}
@@ -3,11 +3,14 @@ package tokensourcer
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/coreos/go-oidc"
+	"github.com/pkg/errors"
 	"github.com/urfave/cli"
 
 	"golang.org/x/oauth2"
@@ -16,10 +19,13 @@ import (
 	"zvelo.io/go-zapi/clientauth"
 	"zvelo.io/go-zapi/tokensource"
 	"zvelo.io/go-zapi/userauth"
+	"zvelo.io/zapi/tracing"
 )
 
 type TokenSourcer interface {
 	Flags() []cli.Flag
+	AddScopes(...string)
+	Setup(context.Context) error
 	TokenSource() oauth2.TokenSource
 	Verifier(context.Context) (*oidc.IDTokenVerifier, error)
 }
@@ -35,9 +41,14 @@ func New(appName string, debug, insecureSkipVerify *bool, scope ...string) Token
 
 type data struct {
 	// cached data
+	mu          sync.Mutex
 	tokenSource oauth2.TokenSource
 	verifier    *oidc.IDTokenVerifier
 
+	// the spans recorded when tokens are requested are children of the span
+	// in ctx
+	ctx context.Context
+
 	// passed to constructor
 	appName            string
 	debug              *bool
@@ -45,9 +56,17 @@ type data struct {
 
 	// from flags
 	accessToken        string
+	clientKey          string
+	clientKeyID        string
+	impersonate        string
+	actAs              bool
 	oauth2             oauth2.Config
 	mockNoCredentials  bool
 	useUserCredentials bool
+	useDeviceFlow      bool
+	publicClient       bool
+	noPKCE             bool
+	deviceAuthURL      string
 	redirectURL        string
 	callbackAddr       string
 	noOpenBrowser      bool
@@ -93,12 +112,36 @@ func (d *data) Flags() []cli.Flag {
 			Usage:       "oauth2 client secret",
 			Destination: &d.oauth2.ClientSecret,
 		},
+		cli.StringFlag{
+			Name:        "client-key",
+			EnvVar:      "ZVELO_CLIENT_KEY",
+			Usage:       "pem encoded private key file used to authenticate the client with private_key_jwt instead of client-secret",
+			Destination: &d.clientKey,
+		},
+		cli.StringFlag{
+			Name:        "client-key-id",
+			EnvVar:      "ZVELO_CLIENT_KEY_ID",
+			Usage:       "key id (kid) of the client-key registered with the authorization server",
+			Destination: &d.clientKeyID,
+		},
 		cli.StringFlag{
 			Name:        "access-token",
 			EnvVar:      "ZVELO_ACCESS_TOKEN",
-			Usage:       "explicitly provide an access token. this should rarely be used as it will override client-id, client-secret and user-credentials",
+			Usage:       "explicitly provide an access token. this should rarely be used as it will override client-id, client-secret, client-key, user-credentials and device-credentials",
 			Destination: &d.accessToken,
 		},
+		cli.StringFlag{
+			Name:        "impersonate",
+			EnvVar:      "ZVELO_IMPERSONATE",
+			Usage:       "exchange `SUBJECT_TOKEN`, a jwt issued to the user to impersonate, for a token that impersonates them (oauth2 token exchange, RFC 8693). all use is logged to stderr",
+			Destination: &d.impersonate,
+		},
+		cli.BoolFlag{
+			Name:        "act-as",
+			EnvVar:      "ZVELO_ACT_AS",
+			Usage:       "with impersonate, request a token delegated to the subject instead, sending the operator's token as the actor_token so the token's act claim records who is acting on behalf of the subject",
+			Destination: &d.actAs,
+		},
 		cli.BoolFlag{
 			Name:        "mock-no-credentials",
 			Usage:       "when querying against the mock server, which does not require credentials, do not attempt to get a token",
@@ -107,9 +150,34 @@ func (d *data) Flags() []cli.Flag {
 		cli.BoolFlag{
 			Name:        "use-user-credentials",
 			EnvVar:      "ZVELO_USE_USER_CREDENTIALS",
-			Usage:       "use user, 3 legged oauth2, credentials instead of client credentials",
+			Usage:       "use user, 3 legged oauth2, credentials instead of client credentials. the authorization code flow uses pkce by default, see oauth2-no-pkce",
 			Destination: &d.useUserCredentials,
 		},
+		cli.BoolFlag{
+			Name:        "public-client",
+			EnvVar:      "ZVELO_PUBLIC_CLIENT",
+			Usage:       "authenticate as a public oauth2 client, never sending the client secret, when using user or device credentials",
+			Destination: &d.publicClient,
+		},
+		cli.BoolFlag{
+			Name:        "oauth2-no-pkce",
+			EnvVar:      "ZVELO_OAUTH2_NO_PKCE",
+			Usage:       "use the authorization code flow without pkce, as before pkce became the default, with user credentials. not permitted with public-client",
+			Destination: &d.noPKCE,
+		},
+		cli.BoolFlag{
+			Name:        "use-device-credentials",
+			EnvVar:      "ZVELO_USE_DEVICE_CREDENTIALS",
+			Usage:       "use user credentials obtained with the oauth2 device authorization grant, for when a browser or callback listener isn't available",
+			Destination: &d.useDeviceFlow,
+		},
+		cli.StringFlag{
+			Name:        "device-auth-url",
+			EnvVar:      "ZVELO_DEVICE_AUTH_URL",
+			Usage:       "oauth2 device authorization url",
+			Value:       DefaultDeviceAuthURL,
+			Destination: &d.deviceAuthURL,
+		},
 		cli.StringFlag{
 			Name:        "oauth2-callback-url",
 			EnvVar:      "ZVELO_OAUTH2_CALLBACK_URL",
@@ -145,6 +213,35 @@ func (d *data) Flags() []cli.Flag {
 	}
 }
 
+// Setup validates the flags and must be called before TokenSource. Tokens
+// requested by TokenSource are traced as part of the span in ctx.
+func (d *data) Setup(ctx context.Context) error {
+	d.ctx = ctx
+
+	if d.publicClient && d.noPKCE {
+		return errors.New("oauth2-no-pkce is not permitted with public-client")
+	}
+
+	return nil
+}
+
+func (d *data) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+
+	return d.ctx
+}
+
+// AddScopes adds scopes to those requested by default. It must be called before
+// TokenSource.
+func (d *data) AddScopes(scope ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.defaultScopes = append(d.defaultScopes, scope...)
+}
+
 func (d *data) scopes() []string {
 	var s []string
 
@@ -160,21 +257,61 @@ func (d *data) scopes() []string {
 	return scopes
 }
 
+// clientConfig returns the oauth2.Config used for user credentials and token
+// exchange. Public clients never send the client secret.
+func (d *data) clientConfig(scopes []string) oauth2.Config {
+	config := d.oauth2
+	config.Scopes = scopes
+	config.RedirectURL = d.redirectURL
+
+	if d.publicClient {
+		config.ClientSecret = ""
+	}
+
+	return config
+}
+
+// TokenSource returns the token source for the flags. It is created on the
+// first call and every call returns the same one, so all clients share its
+// tokens. It is nil when using mock-no-credentials.
 func (d *data) TokenSource() oauth2.TokenSource {
-	scopes := d.scopes()
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	if d.tokenSource != nil || d.mockNoCredentials {
-		return nil
+	if d.tokenSource == nil && !d.mockNoCredentials {
+		d.tokenSource = d.newTokenSource()
 	}
 
-	var cacheName string
+	return d.tokenSource
+}
+
+func (d *data) newTokenSource() oauth2.TokenSource {
+	scopes := d.scopes()
+
+	var ts oauth2.TokenSource
+	var cacheName, kind string
 
 	if d.accessToken != "" {
-		d.tokenSource = oauth2.StaticTokenSource(&oauth2.Token{
+		ts = oauth2.StaticTokenSource(&oauth2.Token{
 			AccessToken: d.accessToken,
 		})
+	} else if d.useDeviceFlow {
+		cacheName, kind = "user", "device"
+		config := d.clientConfig(scopes)
+		ts = newRefreshTokenSource(context.Background(), config,
+			newDeviceTokenSource(context.Background(), config, d.deviceAuthURL, os.Stderr))
+	} else if d.useUserCredentials && !d.noPKCE {
+		cacheName, kind = "user", "authorization_code"
+		var debug io.Writer
+		if *d.debug {
+			debug = os.Stderr
+		}
+
+		config := d.clientConfig(scopes)
+		ts = newRefreshTokenSource(context.Background(), config,
+			newAuthCodeTokenSource(context.Background(), config, d.callbackAddr, !d.noOpenBrowser, os.Stderr, debug))
 	} else if d.useUserCredentials {
-		cacheName = "user"
+		cacheName, kind = "user", "authorization_code"
 		userOpts := []userauth.Option{
 			userauth.WithRedirectURL(d.redirectURL),
 			userauth.WithScope(scopes...),
@@ -190,10 +327,15 @@ func (d *data) TokenSource() oauth2.TokenSource {
 			userOpts = append(userOpts, userauth.WithDebug(os.Stderr))
 		}
 
-		d.tokenSource = userauth.TokenSource(context.Background(), d.oauth2.ClientID, d.oauth2.ClientSecret, userOpts...)
+		ts = userauth.TokenSource(context.Background(), d.oauth2.ClientID, d.oauth2.ClientSecret, userOpts...)
+	} else if d.clientKey != "" {
+		cacheName, kind = "client", "client_key"
+		config := d.oauth2
+		config.Scopes = scopes
+		ts = newClientKeyTokenSource(context.Background(), config, d.clientKey, d.clientKeyID)
 	} else {
-		cacheName = "client"
-		d.tokenSource = clientauth.ClientCredentials(
+		cacheName, kind = "client", "client_credentials"
+		ts = clientauth.ClientCredentials(
 			context.Background(),
 			d.oauth2.ClientID,
 			d.oauth2.ClientSecret,
@@ -202,21 +344,28 @@ func (d *data) TokenSource() oauth2.TokenSource {
 		)
 	}
 
-	if d.tokenSource != nil {
+	if ts != nil {
 		if d.accessToken == "" {
+			ts = tracing.TokenSource(d.context(), kind, ts)
+
 			if !d.noCacheToken {
-				d.tokenSource = tokensource.FileCache(d.tokenSource, d.appName, cacheName, scopes...)
+				ts = tokensource.FileCache(ts, d.appName, cacheName, scopes...)
 			}
 
-			d.tokenSource = oauth2.ReuseTokenSource(nil, d.tokenSource)
+			ts = oauth2.ReuseTokenSource(nil, ts)
+		}
+
+		if d.impersonate != "" {
+			exchange := newExchangeTokenSource(context.Background(), d.clientConfig(scopes), ts, d.impersonate, d.actAs, os.Stderr)
+			ts = oauth2.ReuseTokenSource(nil, tracing.TokenSource(d.context(), "token_exchange", exchange))
 		}
 
 		if *d.debug {
-			d.tokenSource = tokensource.Debug(os.Stderr, d.tokenSource)
+			ts = tokensource.Debug(os.Stderr, ts)
 		}
 	}
 
-	return d.tokenSource
+	return ts
 }
 
 func (d *data) Verifier(ctx context.Context) (*oidc.IDTokenVerifier, error) {
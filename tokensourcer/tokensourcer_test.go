@@ -0,0 +1,57 @@
+package tokensourcer
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAddScopes(t *testing.T) {
+	var debug, insecureSkipVerify bool
+
+	d := New("zapi-test", &debug, &insecureSkipVerify, "zvelo.dataset").(*data)
+	d.AddScopes("zvelo.stream")
+
+	if scopes := d.scopes(); !reflect.DeepEqual(scopes, []string{"zvelo.dataset", "zvelo.stream"}) {
+		t.Errorf("unexpected scopes: %v", scopes)
+	}
+
+	// scopes given with --scope replace the defaults
+	d.scopesFlag = []string{"zvelo.suggest"}
+
+	if scopes := d.scopes(); !reflect.DeepEqual(scopes, []string{"zvelo.suggest"}) {
+		t.Errorf("unexpected scopes: %v", scopes)
+	}
+}
+
+func TestTokenSourceShared(t *testing.T) {
+	var debug, insecureSkipVerify bool
+
+	d := New("zapi-test", &debug, &insecureSkipVerify).(*data)
+	d.accessToken = "token"
+
+	// clients are created concurrently and must all get the same token source
+	sources := make(chan oauth2.TokenSource, 10)
+	for i := 0; i < cap(sources); i++ {
+		go func() { sources <- d.TokenSource() }()
+	}
+
+	first := <-sources
+	if first == nil {
+		t.Fatal("expected a token source")
+	}
+
+	for i := 1; i < cap(sources); i++ {
+		if ts := <-sources; ts != first {
+			t.Error("expected the same token source from every call")
+		}
+	}
+
+	d = New("zapi-test", &debug, &insecureSkipVerify).(*data)
+	d.mockNoCredentials = true
+
+	if ts := d.TokenSource(); ts != nil {
+		t.Errorf("unexpected token source: %v", ts)
+	}
+}
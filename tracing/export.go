@@ -0,0 +1,363 @@
+package tracing
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+)
+
+// DefaultOTLPPath is appended to otlp endpoints that don't include a path
+const DefaultOTLPPath = "/v1/traces"
+
+type jsonLog struct {
+	Time   time.Time              `json:"time"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+type jsonSpan struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_span_id,omitempty"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	DurationMS float64                `json:"duration_ms"`
+	Tags       map[string]interface{} `json:"tags,omitempty"`
+	Logs       []jsonLog              `json:"logs,omitempty"`
+}
+
+func parentID(d *SpanData) string {
+	if d.ParentID == [8]byte{} {
+		return ""
+	}
+
+	return hex.EncodeToString(d.ParentID[:])
+}
+
+type fileExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type closingFileExporter struct {
+	*fileExporter
+	f *os.File
+}
+
+// Close closes the trace file
+func (e closingFileExporter) Close() error {
+	return e.f.Close()
+}
+
+// FileExporter returns an Exporter that appends each span to the file name as
+// a line of json. The Exporter is an io.Closer that closes the file.
+func FileExporter(name string) (Exporter, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // #nosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening trace file")
+	}
+
+	return closingFileExporter{fileExporter: &fileExporter{w: f}, f: f}, nil
+}
+
+// WriterExporter returns an Exporter that writes each span to w as a line of
+// json
+func WriterExporter(w io.Writer) Exporter {
+	return &fileExporter{w: w}
+}
+
+func (e *fileExporter) Export(spans []*SpanData) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+
+	for _, d := range spans {
+		s := jsonSpan{
+			TraceID:    hex.EncodeToString(d.Context.TraceID[:]),
+			SpanID:     hex.EncodeToString(d.Context.SpanID[:]),
+			ParentID:   parentID(d),
+			Name:       d.Name,
+			Start:      d.Start,
+			End:        d.End,
+			DurationMS: float64(d.Duration()) / float64(time.Millisecond),
+			Tags:       d.Tags,
+		}
+
+		for _, l := range d.Logs {
+			s.Logs = append(s.Logs, jsonLog{Time: l.Time, Fields: l.Fields})
+		}
+
+		if err := enc.Encode(s); err != nil {
+			return errors.Wrap(err, "error encoding span")
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, err := e.w.Write(buf.Bytes())
+	return errors.Wrap(err, "error writing spans")
+}
+
+// the otlp types are the parts of the json encoding of
+// ExportTraceServiceRequest
+// (https://github.com/open-telemetry/opentelemetry-proto) needed to export
+// spans
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// otlp span kinds and status codes
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpKindClient   = 3
+	otlpKindProducer = 4
+	otlpKindConsumer = 5
+
+	otlpStatusError = 2
+)
+
+func otlpKind(kind interface{}) int {
+	switch fmt.Sprint(kind) {
+	case string(ext.SpanKindRPCClientEnum):
+		return otlpKindClient
+	case string(ext.SpanKindRPCServerEnum):
+		return otlpKindServer
+	case string(ext.SpanKindProducerEnum):
+		return otlpKindProducer
+	case string(ext.SpanKindConsumerEnum):
+		return otlpKindConsumer
+	}
+
+	return otlpKindInternal
+}
+
+func otlpAttributeValue(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		s := fmt.Sprint(v)
+		return otlpValue{IntValue: &s}
+	case float32:
+		f := float64(v)
+		return otlpValue{DoubleValue: &f}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	}
+
+	s := fmt.Sprint(v)
+	return otlpValue{StringValue: &s}
+}
+
+func otlpAttributes(m map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute{Key: k, Value: otlpAttributeValue(m[k])})
+	}
+
+	return attrs
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newOTLPSpan(d *SpanData) otlpSpan {
+	s := otlpSpan{
+		TraceID:           hex.EncodeToString(d.Context.TraceID[:]),
+		SpanID:            hex.EncodeToString(d.Context.SpanID[:]),
+		ParentSpanID:      parentID(d),
+		Name:              d.Name,
+		Kind:              otlpKind(d.Tags[string(ext.SpanKind)]),
+		StartTimeUnixNano: unixNano(d.Start),
+		EndTimeUnixNano:   unixNano(d.End),
+	}
+
+	tags := map[string]interface{}{}
+	for k, v := range d.Tags {
+		if k != string(ext.SpanKind) {
+			tags[k] = v
+		}
+	}
+	s.Attributes = otlpAttributes(tags)
+
+	if isErr, _ := d.Tags[string(ext.Error)].(bool); isErr {
+		s.Status.Code = otlpStatusError
+	}
+
+	for _, l := range d.Logs {
+		e := otlpEvent{
+			TimeUnixNano: unixNano(l.Time),
+			Name:         "log",
+		}
+
+		fields := map[string]interface{}{}
+		for k, v := range l.Fields {
+			if k == "event" {
+				e.Name = fmt.Sprint(v)
+				continue
+			}
+			fields[k] = v
+		}
+		e.Attributes = otlpAttributes(fields)
+
+		s.Events = append(s.Events, e)
+	}
+
+	return s
+}
+
+type otlpExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// OTLPEndpoint returns the url spans are posted to for an otlp/http endpoint.
+// The default path is used if endpoint doesn't include one.
+func OTLPEndpoint(endpoint string) (string, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid otlp endpoint")
+	}
+
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultOTLPPath
+	}
+
+	return u.String(), nil
+}
+
+// OTLPExporter returns an Exporter that posts spans to an OpenTelemetry
+// collector using otlp/http with json encoding. service is reported as the
+// service.name of the spans.
+func OTLPExporter(endpoint, service string, insecureSkipVerify bool) (Exporter, error) {
+	u, err := OTLPEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpExporter{
+		url:     u,
+		service: service,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: insecureSkipVerify, // #nosec
+				},
+			},
+		},
+	}, nil
+}
+
+func (e *otlpExporter) Export(spans []*SpanData) error {
+	var ss otlpScopeSpans
+	ss.Scope.Name = "zvelo.io/zapi/tracing"
+
+	for _, d := range spans {
+		ss.Spans = append(ss.Spans, newOTLPSpan(d))
+	}
+
+	rs := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{ss}}
+	rs.Resource.Attributes = otlpAttributes(map[string]interface{}{"service.name": e.service})
+
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{rs}}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "error encoding spans")
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error exporting spans")
+	}
+	defer func() { _ = resp.Body.Close() }() // #nosec
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body) // #nosec
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("error exporting spans: %s", resp.Status)
+	}
+
+	return nil
+}
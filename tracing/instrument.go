@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+
+	"golang.org/x/oauth2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// setError marks span as failed with err
+func setError(span opentracing.Span, err error) {
+	ext.Error.Set(span, true)
+	span.LogFields(log.String("event", "error"), log.Error(err))
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+// Transport returns an http.RoundTripper that records a client span for each
+// request made with base, as a child of the span in the request's context,
+// and propagates it to the server with the traceparent header
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return transport{base: base}
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	span, ctx := opentracing.StartSpanFromContext(req.Context(), "HTTP "+req.Method,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: string(ext.Component), Value: "net/http"},
+		opentracing.Tag{Key: string(ext.HTTPMethod), Value: req.Method},
+		opentracing.Tag{Key: string(ext.HTTPUrl), Value: req.URL.String()},
+	)
+	defer span.Finish()
+
+	// per RoundTripper contract, req must not be modified
+	r := req.WithContext(ctx)
+	r.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	_ = span.Tracer().Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(r.Header)) // #nosec
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		setError(span, err)
+		return nil, err
+	}
+
+	ext.HTTPStatusCode.Set(span, uint16(resp.StatusCode))
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		ext.Error.Set(span, true)
+	}
+
+	return resp, nil
+}
+
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Set(key, val string) {
+	metadata.MD(c).Set(key, val)
+}
+
+// startRPC starts a client span for a grpc call and adds it to the outgoing
+// metadata of the returned context
+func startRPC(ctx context.Context, method string) (opentracing.Span, context.Context) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, method,
+		ext.SpanKindRPCClient,
+		opentracing.Tag{Key: string(ext.Component), Value: "grpc"},
+	)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+
+	if err := span.Tracer().Inject(span.Context(), opentracing.TextMap, metadataCarrier(md)); err == nil {
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+
+	return span, ctx
+}
+
+func finishRPC(span opentracing.Span, err error) {
+	if err != nil {
+		span.SetTag("rpc.grpc.status_code", status.Code(err).String())
+		setError(span, err)
+	}
+
+	span.Finish()
+}
+
+// UnaryClientInterceptor returns a grpc.UnaryClientInterceptor that records a
+// client span for each call and propagates it with the traceparent metadata
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		span, ctx := startRPC(ctx, method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		finishRPC(span, err)
+		return err
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	once sync.Once
+	span opentracing.Span
+	done chan struct{}
+}
+
+func (s *clientStream) finish(err error) {
+	s.once.Do(func() {
+		finishRPC(s.span, err)
+		close(s.done)
+	})
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+
+	if err == io.EOF {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+
+	return err
+}
+
+// StreamClientInterceptor returns a grpc.StreamClientInterceptor that records
+// a client span lasting the life of each stream and propagates it with the
+// traceparent metadata
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		span, ctx := startRPC(ctx, method)
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			finishRPC(span, err)
+			return nil, err
+		}
+
+		s := &clientStream{ClientStream: cs, span: span, done: make(chan struct{})}
+
+		// the stream may be abandoned without being read to the end, in which
+		// case it finishes when its context is done
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.finish(ctx.Err())
+			case <-s.done:
+			}
+		}()
+
+		return s, nil
+	}
+}
+
+type tokenSource struct {
+	ctx  context.Context
+	name string
+	src  oauth2.TokenSource
+}
+
+// TokenSource returns an oauth2.TokenSource that records a span each time src
+// is asked for a token. name identifies the kind of token source. oauth2
+// doesn't pass a context to Token, so the spans are children of the span in
+// ctx, if there is one.
+func TokenSource(ctx context.Context, name string, src oauth2.TokenSource) oauth2.TokenSource {
+	return tokenSource{ctx: ctx, name: name, src: src}
+}
+
+func (s tokenSource) Token() (*oauth2.Token, error) {
+	span, _ := opentracing.StartSpanFromContext(s.ctx, "oauth2.Token", opentracing.Tag{Key: "oauth2.token_source", Value: s.name})
+	defer span.Finish()
+
+	token, err := s.src.Token()
+	if err != nil {
+		setError(span, err)
+		return nil, err
+	}
+
+	return token, nil
+}
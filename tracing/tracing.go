@@ -0,0 +1,430 @@
+// Package tracing records client side spans for api calls and exports them to
+// an OTLP collector or a local file. The Tracer implements opentracing.Tracer
+// and propagates span contexts with the W3C traceparent header.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// TraceParentHeader is the W3C trace context header used to propagate spans
+const TraceParentHeader = "traceparent"
+
+// flushSize is the number of finished spans that are buffered before they are
+// exported
+const flushSize = 512
+
+// SpanContext identifies a span within a trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+var _ opentracing.SpanContext = SpanContext{}
+
+// ForeachBaggageItem satisfies opentracing.SpanContext. Baggage is not
+// supported.
+func (c SpanContext) ForeachBaggageItem(func(k, v string) bool) {}
+
+// TraceParent returns c formatted as a traceparent header value
+func (c SpanContext) TraceParent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+
+	return fmt.Sprintf("00-%x-%x-%s", c.TraceID, c.SpanID, flags)
+}
+
+// ParseTraceParent parses a traceparent header value
+func ParseTraceParent(s string) (SpanContext, error) {
+	var c SpanContext
+
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	if _, err := hex.Decode(c.TraceID[:], []byte(parts[1])); err != nil {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	if _, err := hex.Decode(c.SpanID[:], []byte(parts[2])); err != nil {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	if c.TraceID == [16]byte{} || c.SpanID == [8]byte{} {
+		return c, opentracing.ErrSpanContextCorrupted
+	}
+
+	c.Sampled = flags[0]&1 == 1
+
+	return c, nil
+}
+
+// Log is an event recorded during a span
+type Log struct {
+	Time   time.Time
+	Fields map[string]interface{}
+}
+
+// SpanData is a finished span as it is exported
+type SpanData struct {
+	Context  SpanContext
+	ParentID [8]byte
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Tags     map[string]interface{}
+	Logs     []Log
+}
+
+// Duration is how long the span took
+func (d *SpanData) Duration() time.Duration {
+	return d.End.Sub(d.Start)
+}
+
+// An Exporter sends finished spans somewhere they can be examined
+type Exporter interface {
+	Export([]*SpanData) error
+}
+
+// Tracer is an opentracing.Tracer that buffers finished spans and sends them to
+// its exporter
+type Tracer struct {
+	exporter Exporter
+
+	mu       sync.Mutex
+	finished []*SpanData
+	err      error
+}
+
+var _ opentracing.Tracer = (*Tracer)(nil)
+
+// New returns a Tracer that exports spans with exporter
+func New(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+// Enabled reports whether the global tracer is a Tracer, i.e. whether spans
+// are being recorded
+func Enabled() bool {
+	_, ok := opentracing.GlobalTracer().(*Tracer)
+	return ok
+}
+
+func randomID(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// StartSpan satisfies opentracing.Tracer
+func (t *Tracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var o opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+
+	s := span{
+		tracer: t,
+		data: SpanData{
+			Name:  operationName,
+			Start: o.StartTime,
+			Tags:  map[string]interface{}{},
+		},
+	}
+
+	if s.data.Start.IsZero() {
+		s.data.Start = time.Now()
+	}
+
+	for k, v := range o.Tags {
+		s.data.Tags[k] = v
+	}
+
+	for _, ref := range o.References {
+		if parent, ok := ref.ReferencedContext.(SpanContext); ok {
+			s.data.Context.TraceID = parent.TraceID
+			s.data.ParentID = parent.SpanID
+			break
+		}
+	}
+
+	if s.data.Context.TraceID == [16]byte{} {
+		randomID(s.data.Context.TraceID[:])
+	}
+
+	randomID(s.data.Context.SpanID[:])
+	s.data.Context.Sampled = true
+
+	return &s
+}
+
+// Inject satisfies opentracing.Tracer. The TextMap and HTTPHeaders formats are
+// supported.
+func (t *Tracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	c, ok := sm.(SpanContext)
+	if !ok {
+		return opentracing.ErrInvalidSpanContext
+	}
+
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return opentracing.ErrUnsupportedFormat
+	}
+
+	w, ok := carrier.(opentracing.TextMapWriter)
+	if !ok {
+		return opentracing.ErrInvalidCarrier
+	}
+
+	w.Set(TraceParentHeader, c.TraceParent())
+
+	return nil
+}
+
+// Extract satisfies opentracing.Tracer. The TextMap and HTTPHeaders formats
+// are supported.
+func (t *Tracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	if format != opentracing.TextMap && format != opentracing.HTTPHeaders {
+		return nil, opentracing.ErrUnsupportedFormat
+	}
+
+	r, ok := carrier.(opentracing.TextMapReader)
+	if !ok {
+		return nil, opentracing.ErrInvalidCarrier
+	}
+
+	var value string
+
+	err := r.ForeachKey(func(key, val string) error {
+		if strings.EqualFold(key, TraceParentHeader) {
+			value = val
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if value == "" {
+		return nil, opentracing.ErrSpanContextNotFound
+	}
+
+	return ParseTraceParent(value)
+}
+
+func (t *Tracer) finish(d *SpanData) {
+	t.mu.Lock()
+	t.finished = append(t.finished, d)
+
+	var spans []*SpanData
+	if len(t.finished) >= flushSize {
+		spans, t.finished = t.finished, nil
+	}
+	t.mu.Unlock()
+
+	if spans != nil {
+		t.export(spans)
+	}
+}
+
+func (t *Tracer) export(spans []*SpanData) {
+	if err := t.exporter.Export(spans); err != nil {
+		t.mu.Lock()
+		if t.err == nil {
+			t.err = err
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Flush exports any spans that have finished but not yet been exported. It
+// returns the first error encountered exporting spans, if any.
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	spans := t.finished
+	t.finished = nil
+	t.mu.Unlock()
+
+	if len(spans) > 0 {
+		t.export(spans)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+// Close flushes any spans that have not yet been exported and then closes the
+// exporter, if it is an io.Closer
+func (t *Tracer) Close() error {
+	err := t.Flush()
+
+	if c, ok := t.exporter.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+type span struct {
+	tracer *Tracer
+
+	mu       sync.Mutex
+	data     SpanData
+	finished bool
+}
+
+var _ opentracing.Span = (*span)(nil)
+
+func (s *span) Finish() {
+	s.FinishWithOptions(opentracing.FinishOptions{})
+}
+
+func (s *span) FinishWithOptions(opts opentracing.FinishOptions) {
+	s.mu.Lock()
+
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+
+	s.finished = true
+
+	for _, r := range opts.LogRecords {
+		s.logFields(r.Timestamp, r.Fields...)
+	}
+
+	for _, ld := range opts.BulkLogData {
+		r := ld.ToLogRecord()
+		s.logFields(r.Timestamp, r.Fields...)
+	}
+
+	s.data.End = opts.FinishTime
+	if s.data.End.IsZero() {
+		s.data.End = time.Now()
+	}
+
+	d := s.data
+	s.mu.Unlock()
+
+	s.tracer.finish(&d)
+}
+
+func (s *span) Context() opentracing.SpanContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.Context
+}
+
+func (s *span) SetOperationName(operationName string) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Name = operationName
+	return s
+}
+
+func (s *span) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Tags[key] = value
+	return s
+}
+
+// logFields must be called with s.mu held
+func (s *span) logFields(ts time.Time, fields ...log.Field) {
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	l := Log{
+		Time:   ts,
+		Fields: make(map[string]interface{}, len(fields)),
+	}
+
+	for _, f := range fields {
+		l.Fields[f.Key()] = f.Value()
+	}
+
+	s.data.Logs = append(s.data.Logs, l)
+}
+
+func (s *span) LogFields(fields ...log.Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logFields(time.Time{}, fields...)
+}
+
+func (s *span) LogKV(alternatingKeyValues ...interface{}) {
+	fields, err := log.InterleavedKVToFields(alternatingKeyValues...)
+	if err != nil {
+		fields = []log.Field{log.Error(err), log.String("function", "LogKV")}
+	}
+
+	s.LogFields(fields...)
+}
+
+func (s *span) SetBaggageItem(restrictedKey, value string) opentracing.Span {
+	return s
+}
+
+func (s *span) BaggageItem(restrictedKey string) string {
+	return ""
+}
+
+func (s *span) Tracer() opentracing.Tracer {
+	return s.tracer
+}
+
+func (s *span) LogEvent(event string) {
+	s.Log(opentracing.LogData{Event: event})
+}
+
+func (s *span) LogEventWithPayload(event string, payload interface{}) {
+	s.Log(opentracing.LogData{Event: event, Payload: payload})
+}
+
+func (s *span) Log(ld opentracing.LogData) {
+	r := ld.ToLogRecord()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logFields(r.Timestamp, r.Fields...)
+}
@@ -0,0 +1,403 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	opentracing "github.com/opentracing/opentracing-go"
+
+	"golang.org/x/oauth2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type memExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func (e *memExporter) Export(spans []*SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memExporter) byName(name string) *SpanData {
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestTraceParent(t *testing.T) {
+	const tp = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+
+	c, err := ParseTraceParent(tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(c.TraceID[:]) != "0af7651916cd43dd8448eb211c80319c" || !c.Sampled {
+		t.Errorf("unexpected span context: %+v", c)
+	}
+
+	if s := c.TraceParent(); s != tp {
+		t.Errorf("unexpected traceparent: %s", s)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+		"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra",
+		"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+		"00-0af7651916cd43dd8448eb211c80319g-b7ad6b7169203331-01",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var received string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceParentHeader)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	var e memExporter
+	tracer := New(&e)
+
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if req.Header.Get(TraceParentHeader) != "" {
+		t.Error("the original request was modified")
+	}
+
+	parent.Finish()
+
+	if err = tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, s := e.byName("parent"), e.byName("HTTP GET")
+	if p == nil || s == nil {
+		t.Fatalf("unexpected spans: %v", e.spans)
+	}
+
+	if s.Context.TraceID != p.Context.TraceID || s.ParentID != p.Context.SpanID {
+		t.Errorf("span is not a child of its parent: %+v", s)
+	}
+
+	if received != s.Context.TraceParent() {
+		t.Errorf("unexpected traceparent: %q", received)
+	}
+
+	if s.Tags["http.status_code"] != uint16(http.StatusNotFound) || s.Tags["error"] != true {
+		t.Errorf("unexpected tags: %v", s.Tags)
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var e memExporter
+	tracer := New(&e)
+
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	var md metadata.MD
+
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-client-trace-id", "a")
+
+	if err := UnaryClientInterceptor()(ctx, "/zvelo.msg.APIv1/Query", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := e.byName("/zvelo.msg.APIv1/Query")
+	if s == nil {
+		t.Fatalf("unexpected spans: %v", e.spans)
+	}
+
+	if tp := md[TraceParentHeader]; len(tp) != 1 || tp[0] != s.Context.TraceParent() {
+		t.Errorf("unexpected metadata: %v", md)
+	}
+
+	if len(md["x-client-trace-id"]) != 1 {
+		t.Errorf("existing metadata was lost: %v", md)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	var requests []otlpRequest
+
+	// a stand-in for an OpenTelemetry collector
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != DefaultOTLPPath || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requests = append(requests, req)
+	}))
+	defer collector.Close()
+
+	exporter, err := OTLPExporter(strings.TrimPrefix(collector.URL, "http://"), "zapi-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := New(exporter)
+
+	root := tracer.StartSpan("root")
+	child := tracer.StartSpan("child", opentracing.ChildOf(root.Context()), opentracing.Tag{Key: "span.kind", Value: "client"})
+	child.SetTag("error", true)
+	child.LogKV("event", "error", "message", "failed")
+	child.Finish()
+	root.Finish()
+
+	if err = tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || len(requests[0].ResourceSpans) != 1 || len(requests[0].ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+
+	rs := requests[0].ResourceSpans[0]
+	if a := rs.Resource.Attributes; len(a) != 1 || a[0].Key != "service.name" || *a[0].Value.StringValue != "zapi-test" {
+		t.Errorf("unexpected resource: %+v", rs.Resource)
+	}
+
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+
+	c, r := spans[0], spans[1]
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID || r.ParentSpanID != "" {
+		t.Errorf("unexpected ids: %+v, %+v", c, r)
+	}
+
+	if c.Kind != otlpKindClient || r.Kind != otlpKindInternal || c.Status.Code != otlpStatusError {
+		t.Errorf("unexpected kind or status: %+v", c)
+	}
+
+	if len(c.Events) != 1 || c.Events[0].Name != "error" || c.Events[0].Attributes[0].Key != "message" {
+		t.Errorf("unexpected events: %+v", c.Events)
+	}
+
+	collector.Close()
+	root = tracer.StartSpan("root")
+	root.Finish()
+
+	if err = tracer.Flush(); err == nil {
+		t.Error("expected an error exporting to a closed collector")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := New(WriterExporter(&buf))
+
+	root := tracer.StartSpan("root", opentracing.Tag{Key: "zvelo.urls", Value: 2})
+	tracer.StartSpan("child", opentracing.ChildOf(root.Context())).Finish()
+	root.Finish()
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected output: %s", buf.String())
+	}
+
+	var child, parent jsonSpan
+	if err := json.Unmarshal([]byte(lines[0]), &child); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &parent); err != nil {
+		t.Fatal(err)
+	}
+
+	if child.Name != "child" || child.ParentID != parent.SpanID || child.TraceID != parent.TraceID {
+		t.Errorf("unexpected spans: %+v, %+v", child, parent)
+	}
+
+	if parent.Tags["zvelo.urls"] != float64(2) {
+		t.Errorf("unexpected tags: %v", parent.Tags)
+	}
+}
+
+type tokenFunc func() (*oauth2.Token, error)
+
+func (f tokenFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+func TestTokenSource(t *testing.T) {
+	var e memExporter
+	tracer := New(&e)
+
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	root := tracer.StartSpan("root")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+
+	ts := TokenSource(ctx, "client_credentials", tokenFunc(func() (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: "a"}, nil
+	}))
+
+	if _, err := ts.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	root.Finish()
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := e.byName("oauth2.Token")
+	if s == nil {
+		t.Fatalf("unexpected spans: %v", e.spans)
+	}
+
+	if rc := root.Context().(SpanContext); s.ParentID != rc.SpanID || s.Context.TraceID != rc.TraceID {
+		t.Errorf("token span is not a child of the root span: %+v", s)
+	}
+}
+
+type eofStream struct {
+	grpc.ClientStream
+}
+
+func (eofStream) RecvMsg(interface{}) error {
+	return io.EOF
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	var e memExporter
+	tracer := New(&e)
+
+	prev := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(prev)
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return eofStream{}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cs, err := StreamClientInterceptor()(ctx, &grpc.StreamDesc{ServerStreams: true}, nil, "/zvelo.msg.APIv1/Stream", streamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cs.RecvMsg(nil); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the stream is finished when it ends, not when its context is done
+	select {
+	case <-cs.(*clientStream).done:
+	case <-time.After(time.Second):
+		t.Fatal("stream was not finished")
+	}
+
+	if err = tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := e.byName("/zvelo.msg.APIv1/Stream"); s == nil || s.Tags["error"] != nil {
+		t.Errorf("unexpected spans: %v", e.spans)
+	}
+}
+
+func TestFileExporterClose(t *testing.T) {
+	f, err := ioutil.TempFile("", "zapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }() // #nosec
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	exporter, err := FileExporter(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracer := New(exporter)
+	tracer.StartSpan("a").Finish()
+
+	if err = tracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil || !strings.Contains(string(data), `"name":"a"`) {
+		t.Errorf("unexpected trace file: %s, %v", data, err)
+	}
+
+	if err = exporter.(io.Closer).Close(); err == nil {
+		t.Error("expected the trace file to already be closed")
+	}
+}